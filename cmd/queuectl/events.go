@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"queuectl/internal/duration"
+	"queuectl/internal/storage"
+)
+
+// eventsCmd prints the audit log of job state transitions.
+func eventsCmd(store storage.Store, args []string) {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	jobID := flags.Int64("job", 0, "only show events of this job")
+	since := flags.String("since", "", "only show events newer than this age, e.g. 1h or 7d")
+	follow := flags.Bool("follow", false, "keep printing new events as they happen")
+	_ = flags.Parse(args)
+
+	filter := storage.EventFilter{JobID: *jobID}
+	if *since != "" {
+		age, err := duration.Parse(*since)
+		if err != nil {
+			usageError("%v", err)
+		}
+		filter.Since = time.Now().Add(-age)
+	}
+
+	if err := streamEvents(context.Background(), store, filter, *follow, time.Second, os.Stdout); err != nil {
+		fatal("list events", err)
+	}
+}
+
+// streamEvents writes the events matching f to w. With follow it then
+// polls every interval for newer ones until ctx is done.
+func streamEvents(ctx context.Context, store storage.Store, f storage.EventFilter, follow bool, interval time.Duration, w io.Writer) error {
+	for {
+		events, err := store.ListEvents(f)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			printEvent(w, e)
+			f.AfterID = e.ID
+		}
+		if !follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func printEvent(w io.Writer, e storage.Event) {
+	from := e.From
+	if from == "" {
+		from = "-"
+	}
+	fmt.Fprintf(w, "%s job=%d %s -> %s actor=%s", e.CreatedAt.Format(time.RFC3339), e.JobID, from, e.To, e.Actor)
+	if e.Reason != "" {
+		fmt.Fprintf(w, " reason=%q", e.Reason)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queuectl/internal/storage"
+)
+
+// syncBuffer is a bytes.Buffer streamEvents can write to while the test
+// reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStreamEventsFilters(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for _, e := range []storage.Event{
+		{JobID: 1, To: "pending", Actor: "cli", CreatedAt: time.Now().Add(-48 * time.Hour)},
+		{JobID: 1, From: "pending", To: "running", Actor: "worker-1", Reason: "claimed"},
+		{JobID: 2, To: "pending", Actor: "cli"},
+	} {
+		if err := store.InsertEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter storage.EventFilter
+		want   []string
+	}{
+		{"all", storage.EventFilter{}, []string{"job=1 - -> pending", "job=1 pending -> running", "job=2 - -> pending"}},
+		{"job", storage.EventFilter{JobID: 1}, []string{"job=1 - -> pending", `running actor=worker-1 reason="claimed"`}},
+		{"since", storage.EventFilter{Since: time.Now().Add(-24 * time.Hour)}, []string{"job=1 pending -> running", "job=2"}},
+		{"job and since", storage.EventFilter{JobID: 2, Since: time.Now().Add(-time.Hour)}, []string{"job=2 - -> pending actor=cli"}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := streamEvents(context.Background(), store, tt.filter, false, time.Millisecond, &out); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != len(tt.want) {
+			t.Errorf("%s: got %d lines, want %d:\n%s", tt.name, len(lines), len(tt.want), out.String())
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(lines[i], want) {
+				t.Errorf("%s: line %d %q, want it to contain %q", tt.name, i, lines[i], want)
+			}
+		}
+	}
+}
+
+func TestStreamEventsFollow(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.InsertEvent(storage.Event{JobID: 1, To: "pending", Actor: "cli"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out syncBuffer
+	done := make(chan error)
+	go func() {
+		done <- streamEvents(ctx, store, storage.EventFilter{JobID: 1}, true, 5*time.Millisecond, &out)
+	}()
+
+	waitFor := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for strings.Count(out.String(), "\n") < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("waiting for %d events, have:\n%s", n, out.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(1)
+	_ = store.InsertEvent(storage.Event{JobID: 2, To: "pending", Actor: "cli"})
+	_ = store.InsertEvent(storage.Event{JobID: 1, From: "pending", To: "running", Actor: "worker-1"})
+	waitFor(2)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "job=1 pending -> running") {
+		t.Errorf("followed events, each once and only of job 1:\n%s", out.String())
+	}
+}
@@ -2,191 +2,675 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/user"
 	"strconv"
 	"strings"
 	"time"
 
+	"queuectl/internal/api"
+	"queuectl/internal/archive"
+	"queuectl/internal/backoff"
+	"queuectl/internal/bench"
+	"queuectl/internal/duration"
 	"queuectl/internal/job"
+	"queuectl/internal/logging"
+	"queuectl/internal/metrics"
+	"queuectl/internal/notify"
+	"queuectl/internal/output"
 	"queuectl/internal/queue"
+	"queuectl/internal/retention"
 	"queuectl/internal/storage"
+	"queuectl/internal/wakeup"
+	"queuectl/internal/web"
 	"queuectl/internal/worker"
 )
 
-const dbPath = "queue.db"
+// dbPath is the SQLite file or postgres:// URL given with --db.
+var dbPath string
+
+// followLogLevel is false when --log-level pinned the level, so long
+// running commands must not let the log_level config override it.
+var followLogLevel bool
+
+// sqliteOnly lists the commands that need features only the SQLite
+// store has: files, snapshots and the web/API server.
+var sqliteOnly = map[string]bool{
+	"serve": true, "inspect": true, "archive": true,
+	"backup": true, "restore": true, "db": true,
+}
+
+// backend is a Store that also backs the storage metrics, retention and
+// notifications, as both the SQLite and Postgres stores do.
+type backend interface {
+	storage.Store
+	metrics.Stats
+	retention.Store
+	notify.Store
+}
 
 func main() {
-	if len(os.Args) < 2 {
+	global := flag.NewFlagSet("queuectl", flag.ExitOnError)
+	global.Usage = usage
+	logFormat := global.String("log-format", envOr("QUEUECTL_LOG_FORMAT", "text"), "log output: text or json")
+	logLevel := global.String("log-level", os.Getenv("QUEUECTL_LOG_LEVEL"), "log level; overrides the log_level config")
+	global.StringVar(&dbPath, "db", envOr("QUEUECTL_DB", "queue.db"), "SQLite file or postgres:// URL")
+	format := global.String("output", envOr("QUEUECTL_OUTPUT", string(output.Table)), "result format: table, json or yaml")
+	_ = global.Parse(os.Args[1:])
+
+	f, err := output.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	outputFormat = f
+
+	if err := logging.Setup(*logFormat, os.Stderr); err != nil {
+		fatal("setup logging", err)
+	}
+	if *logLevel != "" {
+		if err := logging.SetLevel(*logLevel); err != nil {
+			fatal("setup logging", err)
+		}
+	}
+	followLogLevel = *logLevel == ""
+
+	if global.NArg() < 1 {
 		usage()
+		os.Exit(2)
+	}
+
+	cmd := global.Arg(0)
+	args := global.Args()[1:]
+
+	// agents never open the database; everything goes through the server
+	if cmd == "agent" {
+		agentCmd(args)
 		return
 	}
 
-	cmd := os.Args[1]
+	if sqliteOnly[cmd] && storage.IsPostgresURL(dbPath) {
+		fmt.Fprintf(os.Stderr, "queuectl %s needs a SQLite database; it is not available with --db postgres://\n", cmd)
+		os.Exit(1)
+	}
+
+	// db manages migrations itself, so it must not migrate on open
+	if cmd == "db" {
+		dbCmd(args)
+		return
+	}
+	// bench runs against a temporary database of its own
+	if cmd == "bench" {
+		if *logLevel == "" {
+			_ = logging.SetLevel("error") // failing jobs would log one warning each
+		}
+		benchCmd(args)
+		return
+	}
 
-	db, err := storage.OpenDB(dbPath)
+	store, lite, err := openStore(dbPath)
+	if errors.Is(err, storage.ErrNewerSchema) {
+		fmt.Fprintf(os.Stderr, "%v\nupgrade queuectl, or roll the database back with a newer build's `queuectl db down`\n", err)
+		os.Exit(1)
+	}
 	if err != nil {
-		log.Fatalf("open db: %v", err)
+		fatal("open db", err)
+	}
+	defer store.Close()
+
+	// the SQLite read pool and write connection, nil for Postgres
+	var db, writer *sql.DB
+	if lite != nil {
+		db, writer = lite.DB(), lite.Writer()
 	}
-	defer db.Close()
 
-	q := queue.NewQueue(db)
+	if *logLevel == "" {
+		if err := logging.LoadLevel(store); err != nil {
+			slog.Warn("load log level", "err", err)
+		}
+	}
+
+	q := queue.NewQueue(store).WithActor(cliActor())
+
+	// Postgres wakes workers in other processes through its own trigger
+	sig := wakeup.New("")
+	if db != nil {
+		sig = wakeup.New(dbPath)
+	}
+	q.OnEnqueue(func(int64) { sig.Notify() })
 
 	switch cmd {
 	case "enqueue":
-		enqueueCmd(q, os.Args[2:])
+		enqueueCmd(q, args)
 	case "worker":
-		workerCmd(db,q, os.Args[2:])
+		workerCmd(store, q, sig, args)
 	case "jobs":
-		jobsCmd(db)
+		jobsCmd(store)
 	case "dlq":
-		dlqCmd(db, os.Args[2:])
+		dlqCmd(store, q, args)
 
 	case "flush":
-	flushCmd(q, os.Args[2:])
+	flushCmd(q, args)
 	case "config":
-    configCmd(db, os.Args[2:])
+    configCmd(store, args)
 	case "status":
-    statusCmd(db, q)
+    statusCmd(store, q)
 	case "list":
-    listJobsCmd(db, os.Args[2:])
+    listJobsCmd(store, args)
+	case "serve":
+		serveCmd(store, db, q, args)
+	case "events":
+		eventsCmd(store, args)
+	case "notify":
+		notifyCmd(store, args)
+	case "inspect":
+		inspectCmd(db, q, args)
+	case "prune":
+		pruneCmd(store, args)
+	case "archive":
+		archiveCmd(db, writer, args)
+	case "backup":
+		backupCmd(db, args)
+	case "restore":
+		restoreCmd(db, writer, args)
 
 
 	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
 		usage()
+		os.Exit(2)
+	}
+}
+
+// openStore opens the store named by --db. lite is the same store when
+// it is SQLite, nil for Postgres.
+func openStore(target string) (store backend, lite *storage.SQLiteStore, err error) {
+	if storage.IsPostgresURL(target) {
+		s, err := storage.OpenPostgres(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, nil, nil
 	}
+	s, err := storage.OpenSQLiteStore(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s, nil
+}
+
+// cliActor names the local user in the events table.
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli:" + os.Getenv("USER")
+}
+
+// fatal logs err and exits non-zero.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// usageError prints a usage or bad-argument message to stderr and exits
+// 2, the status flag parsing uses for bad input.
+func usageError(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(2)
+}
+
+// failf reports an operation that could not be done, such as a missing
+// job, on stderr and exits 1.
+func failf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }
 
 func usage() {
-	fmt.Println(`queuectl <cmd> [args]
+	fmt.Fprint(os.Stderr, `queuectl [--db FILE|postgres://...] [--log-format text|json] [--log-level L] [--output table|json|yaml] <cmd> [args]
 commands:
-  enqueue <command> [--retries N]      Enqueue a job with optional max retries
-  worker start [--concurrency N]      Start worker(s) to process jobs
-  worker stop                          Stop all running workers gracefully
-  jobs                                 List active jobs by state (pending, running, failed, completed)
-  dlq list                             List dead jobs (jobs exceeding max retries)
-  dlq retry <dead_job_id>              Retry a job from the dead-letter queue
-  flush [pending|dead|all]             Remove jobs from the queue or DLQ
-  config                               Show all configuration values
-  config get <key>                     Get a specific configuration value
-  config set <key> <value>             Set a configuration value
-  status                               Show queue status and worker states
-  list [--state <state>]               List jobs filtered by state (pending, running, failed, completed)
+  enqueue [flags] <command>                      Enqueue a job (--retries, --queue, --backoff, --retry-on, --no-retry-on, --retry-later-on, --tags)
+  worker start [--concurrency N] [--prefetch N]  Start worker(s) to process jobs
+  worker stop                                    Stop all running workers gracefully
+  serve [--addr localhost:8080] [--token T]      Serve the agent API and web dashboard
+  agent --server URL [--concurrency N]           Run workers that lease jobs from a remote server
+  jobs                                           List active jobs by state (pending, running, failed, completed)
+  dlq list                                       List dead jobs (jobs exceeding max retries)
+  dlq show <dead_job_id>                         Show a DLQ entry with its full error, attempt logs and history
+  dlq edit <dead_job_id> [flags]                 Fix a DLQ entry before retrying it (--command, --queue, --retries)
+  dlq delete <dead_job_id>                       Drop a DLQ entry without retrying it
+  dlq retry [--keep-attempts] <dead_job_id>      Retry a job from the dead-letter queue
+  dlq retry [--all] [--filter F] [--since 1d]    Retry DLQ entries in bulk (F: cmd~X, error~X, queue=Q, reason=R)
+  flush [pending|dead|all]                       Remove jobs from the queue or DLQ
+  config                                         Show all configuration values
+  config get <key>                               Get a specific configuration value
+  config set <key> <value>                       Set a configuration value
+  status                                         Show queue status and worker states
+  events [--job ID] [--since 1h] [--follow]      Show the job state transition audit log
+  notify add webhook|slack <url>                 Send DLQ and failure-rate alerts to a webhook or Slack
+  notify add smtp <host:port> --from A --to B    Send alerts by email through an SMTP relay
+  notify list|remove <id>|test                   Manage notification sinks
+  prune [--completed] [--dead] [flags]           Delete old jobs (--older-than 24h, --dry-run; default age: retention.* config)
+  archive --before DATE --out FILE [--delete]    Export old completed and dead jobs to JSONL (.gz)
+  archive restore <file>                         Load an archive into the read-only archived_jobs table
+  db migrate|status|down [--to N]                Apply, list or roll back schema migrations
+  bench [--jobs N] [--workers M] [flags]         Measure throughput and claim latency on a temporary database
+  backup --out FILE                              Write a consistent snapshot of the database
+  restore --from FILE                            Replace the database with a snapshot (workers must be stopped)
+  inspect <job_id>                               Show a job with its effective retry settings
+  list [filters] [--sort F] [--limit N]          List jobs a page at a time (--after C; filters: --state, --queue, --cmd, --cmd-regex, --error, --tag, --attempts-gt, --created-after/before, --updated-after/before)
 `)
 }
 
 
 func enqueueCmd(q *queue.Queue, args []string) {
 	flags := flag.NewFlagSet("enqueue", flag.ExitOnError)
-	retries := flags.Int("retries", 3, "max retries")
+	retries := flags.Int("retries", job.InheritRetries, "max retries (default: queue.<name>.max_retries, then max_retries config)")
+	queueName := flags.String("queue", job.DefaultQueue, "queue to put the job on")
+	backoffSpec := flags.String("backoff", "", "retry backoff, e.g. fixed:30s, linear:10s or exp:2,max=10m,jitter=full")
+	retryOn := flags.String("retry-on", "", "only retry these exit codes, e.g. 75,111")
+	noRetryOn := flags.String("no-retry-on", "", "exit codes that fail permanently and go straight to the DLQ")
+	retryLaterOn := flags.String("retry-later-on", "", "exit codes that retry later without counting an attempt")
+	tags := flags.String("tags", "", "comma separated tags to find the job by, e.g. nightly,db")
 	_ = flags.Parse(args)
 
+	var policy job.RetryPolicy
+	for _, f := range []struct {
+		flag, value string
+		dst         *[]int
+	}{
+		{"retry-on", *retryOn, &policy.RetryOn},
+		{"no-retry-on", *noRetryOn, &policy.NoRetryOn},
+		{"retry-later-on", *retryLaterOn, &policy.RetryLaterOn},
+	} {
+		codes, err := job.ParseExitCodes(f.value)
+		if err != nil {
+			usageError("--%s: %v", f.flag, err)
+		}
+		*f.dst = codes
+	}
+
+	if *backoffSpec != "" {
+		if _, err := backoff.Parse(*backoffSpec, nil); err != nil {
+			usageError("%v", err)
+		}
+	}
+	tagList, err := job.ParseTags(*tags)
+	if err != nil {
+		usageError("--tags: %v", err)
+	}
+
 	rest := flags.Args()
 	if len(rest) < 1 {
-		fmt.Println("enqueue requires a command string")
-		return
+		usageError("usage: queuectl enqueue [flags] <command>")
 	}
 	cmd := strings.Join(rest, " ")
-	j, err := q.Push(cmd, *retries)
-	if err != nil {
-		log.Fatalf("push: %v", err)
+	j := job.NewJob(cmd, *retries)
+	j.Queue = *queueName
+	j.Backoff = *backoffSpec
+	j.Retry = policy
+	j.Tags = tagList
+	if err := q.Enqueue(j); err != nil {
+		fatal("push", err)
 	}
 	fmt.Printf("enqueued id=%d cmd=%s\n", j.ID, j.Command)
 }
 
 // simple worker loop that executes commands using a fake handler.
 // Replace runJobHandler with real business logic.
-func workerCmd(db *sql.DB,q *queue.Queue, args []string) {
+func workerCmd(store backend, q *queue.Queue, sig *wakeup.Signal, args []string) {
 	if len(args) == 0 {
-		fmt.Println("Usage: queuectl worker start|stop [--concurrency N]")
-		return
+		usageError("usage: queuectl worker start|stop [--concurrency N] [--prefetch N]")
 	}
 
 	switch args[0] {
 	case "start":
 		flags := flag.NewFlagSet("worker start", flag.ExitOnError)
 		concurrency := flags.Int("concurrency", 1, "number of worker goroutines")
+		metricsAddr := flags.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090")
+		prefetch := flags.Int("prefetch", 0, "claim up to N jobs per query and buffer the ones not started yet")
 		_ = flags.Parse(args[1:])
 
-		worker.Start(db,q, *concurrency)
+		serveMetrics(*metricsAddr)
+		if followLogLevel {
+			go logging.Follow(store, 5*time.Second)
+		}
+		metrics.RegisterStorage(store)
+		startNotifier(store, q)
+		go retention.Run(store, 10*time.Minute)
+		go q.RunRedrive(time.Minute)
+		// jobs of workers that crashed, here or on another host, including
+		// ones they had prefetched but not started
+		go q.RunReclaim(queue.DefaultLease)
+		if err := sig.Listen(); err != nil {
+			slog.Warn("listen for wakeups, falling back to polling", "err", err)
+		}
+		defer sig.Close()
+		src := worker.NewLocalSource(store, q, sig)
+		src.SetPrefetch(*prefetch)
+		worker.Start(src, *concurrency)
 
 	case "stop":
 		fmt.Println("Sending stop signal to workers...")
 		if err := worker.SignalStop(); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
+			failf("stop workers: %v", err)
 		}
+		sig.Notify() // workers check the stop file when they wake
 		fmt.Println("Workers will stop gracefully.")
 	default:
-		fmt.Println("Unknown worker command. Use: start | stop")
+		usageError("usage: queuectl worker start|stop [--concurrency N] [--prefetch N]")
+	}
+}
+
+
+
+// serveCmd runs the HTTP API that remote agents lease jobs from, plus the
+// web dashboard.
+func serveCmd(store backend, db *sql.DB, q *queue.Queue, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "listen address; other hosts need --token")
+	token := flags.String("token", os.Getenv("QUEUECTL_TOKEN"), "shared token agents and browsers must present")
+	lease := flags.Duration("lease", queue.DefaultLease, "requeue jobs whose worker stopped heartbeating for this long")
+	_ = flags.Parse(args)
+	if *lease <= 0 {
+		usageError("--lease must be positive, got %s", *lease)
+	}
+	if *token == "" && !loopbackAddr(*addr) {
+		usageError("--addr %s is reachable from other hosts; set --token (or QUEUECTL_TOKEN) or listen on localhost", *addr)
+	}
+
+	srv := api.NewServer(store, q, *token, *lease)
+	go srv.Reap()
+	if followLogLevel {
+		go logging.Follow(store, 5*time.Second)
+	}
+	startNotifier(store, q)
+	go q.RunRedrive(time.Minute)
+	go retention.Run(store, 10*time.Minute)
+	metrics.RegisterStorage(store)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", srv.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", api.RequireToken(*token, web.Handler(db, q)))
+
+	slog.Info("serving agent API and dashboard", "addr", *addr)
+	fatal("serve", http.ListenAndServe(*addr, mux))
+}
+
+// loopbackAddr reports whether a listen address only accepts connections
+// from this host. An empty host listens on every interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
+// agentCmd runs workers on this host against a remote `queuectl serve`.
+func agentCmd(args []string) {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	server := flags.String("server", "", "server URL, e.g. http://host:8080")
+	token := flags.String("token", os.Getenv("QUEUECTL_TOKEN"), "shared token for the server")
+	concurrency := flags.Int("concurrency", 1, "number of worker goroutines")
+	metricsAddr := flags.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090")
+	_ = flags.Parse(args)
+
+	if *server == "" {
+		usageError("usage: queuectl agent --server URL [--concurrency N]")
+	}
 
+	serveMetrics(*metricsAddr)
+	worker.Start(api.NewClient(*server, *token), *concurrency)
+}
+
+// serveMetrics exposes /metrics in the background when addr is set.
+func serveMetrics(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	go func() {
+		fatal("serve metrics", http.ListenAndServe(addr, mux))
+	}()
+}
 
-func jobsCmd(db *sql.DB) {
-	activeStates := []string{"pending", "running", "failed", "completed"}
+func jobsCmd(store storage.Store) {
+	activeStates := []job.JobState{job.Pending, job.Running, job.Failed, job.Completed}
+	var all []job.Job
 	for _, s := range activeStates {
-		js, err := storage.GetJobsByState(db, job.JobState(s))
+		js, err := store.ListJobs(s)
 		if err != nil {
-			log.Fatalf("get jobs: %v", err)
-		}
-		if len(js) == 0 {
-			continue
-		}
-		fmt.Printf("=== %s ===\n", s)
-		for _, j := range js {
-			fmt.Printf("id=%d cmd=%s attempts=%d scheduled_at=%s updated_at=%s\n", j.ID, j.Command, j.Attempts, j.ScheduledAt.Format(time.RFC3339), j.UpdatedAt.Format(time.RFC3339))
+			fatal("get jobs", err)
 		}
+		all = append(all, js...)
 	}
+	render(newJobList(all))
 }
 
-func dlqCmd(db *sql.DB, args []string) {
+func dlqCmd(store storage.Store, q *queue.Queue, args []string) {
 	if len(args) == 0 {
-		fmt.Println("usage: queuectl dlq [list|retry <id>]")
-		return
+		usageError("usage: queuectl dlq [list|show|edit|delete|retry]")
 	}
 
 	switch args[0] {
 	case "list":
-		ds, err := storage.ListDeadJobs(db)
+		ds, err := store.FindDeadJobs(storage.DeadJobFilter{})
 		if err != nil {
-			log.Fatalf("list dead jobs: %v", err)
+			fatal("list dead jobs", err)
 		}
-		if len(ds) == 0 {
-			fmt.Println("no dead jobs")
-			return
+		render(newDeadJobList(ds))
+
+	case "show":
+		d := deadJobArg(store, args)
+		dlqShow(store, q, d)
+
+	case "edit":
+		d := deadJobArg(store, args)
+		flags := flag.NewFlagSet("dlq edit", flag.ExitOnError)
+		command := flags.String("command", d.Command, "replacement command")
+		queueName := flags.String("queue", d.Queue, "move the job to this queue")
+		retries := flags.Int("retries", d.MaxRetries, "max retries once replayed (-1 inherits the queue or global default)")
+		flags.Parse(args[2:])
+		if strings.TrimSpace(*command) == "" || *retries < job.InheritRetries {
+			usageError("command must not be empty and retries must be >= -1")
 		}
-		fmt.Println("=== dead jobs ===")
-		for _, d := range ds {
-			fmt.Printf("id=%d orig=%v cmd=%s attempts=%d failed_at=%s\n",
-				d.ID, d.OrigID, d.Command, d.Attempts, d.FailedAt.Format(time.RFC3339))
+		d.Command, d.Queue, d.MaxRetries = *command, *queueName, *retries
+		if err := q.EditDead(d); err != nil {
+			failf("edit failed: %v", err)
 		}
+		fmt.Printf("updated dead job %d; replay it with: queuectl dlq retry %d\n", d.ID, d.ID)
 
-	case "retry":
-		if len(args) < 2 {
-			fmt.Println("usage: queuectl dlq retry <dead_job_id>")
-			return
+	case "delete":
+		d := deadJobArg(store, args)
+		if err := q.DeleteDead(d.ID); err != nil {
+			failf("delete failed: %v", err)
 		}
+		fmt.Printf("deleted dead job %d\n", d.ID)
+
+	case "retry":
+		dlqRetryCmd(store, q, args[1:])
+
+	default:
+		usageError("usage: queuectl dlq [list|show|edit|delete|retry]")
+	}
+}
+
+// deadJobArg loads the DLQ entry named by args[1], exiting if it is
+// missing or does not exist.
+func deadJobArg(store storage.Store, args []string) *storage.DeadJob {
+	if len(args) < 2 {
+		usageError("usage: queuectl dlq %s <dead_job_id>", args[0])
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		usageError("invalid job id: %s", args[1])
+	}
+	d, err := store.GetDeadJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		failf("dead job %d not found", id)
+	}
+	if err != nil {
+		fatal("get dead job", err)
+	}
+	return d
+}
+
+func deadReason(r job.DeadReason) string {
+	if r == "" {
+		return "unknown"
+	}
+	return string(r)
+}
+
+// dlqShow prints a DLQ entry in full: the untruncated last error, the
+// output of every attempt and the job's state history.
+func dlqShow(store storage.Store, q *queue.Queue, d *storage.DeadJob) {
+	maxRetries, source := q.EffectiveMaxRetries(&job.Job{MaxRetries: d.MaxRetries, Queue: d.Queue})
+	fmt.Printf("dead job:     %d\n", d.ID)
+	fmt.Printf("job id:       %d\n", d.OrigID.Int64)
+	fmt.Printf("queue:        %s\n", d.Queue)
+	fmt.Printf("command:      %s\n", d.Command)
+	fmt.Printf("reason:       %s\n", deadReason(d.Reason))
+	fmt.Printf("attempts:     %d (max_retries %d from %s)\n", d.Attempts, maxRetries, source)
+	fmt.Printf("created_at:   %s\n", d.CreatedAt.Format(time.RFC3339))
+	fmt.Printf("failed_at:    %s\n", d.FailedAt.Format(time.RFC3339))
+	if d.Replays > 0 {
+		fmt.Printf("replays:      %d (previous DLQ entry %d)\n", d.Replays, d.RetriedFrom.Int64)
+	}
+	if d.ReplayedAs.Valid {
+		fmt.Printf("retried as:   job %d\n", d.ReplayedAs.Int64)
+	}
+	fmt.Printf("last_error:\n%s\n", strings.TrimRight(d.LastError.String, "\n"))
+
+	if !d.OrigID.Valid {
+		return
+	}
+	logs, err := store.ListJobLogs(d.OrigID.Int64)
+	if err != nil {
+		fatal("list job logs", err)
+	}
+	for _, l := range logs {
+		fmt.Printf("\n--- attempt %d (worker %d, %s) ---\n%s\n", l.Attempt, l.WorkerID, l.CreatedAt.Format(time.RFC3339), strings.TrimRight(l.Output, "\n"))
+	}
+	events, err := store.ListEvents(storage.EventFilter{JobID: d.OrigID.Int64})
+	if err != nil {
+		fatal("list events", err)
+	}
+	fmt.Println("\n--- history ---")
+	for _, e := range events {
+		printEvent(os.Stdout, e)
+	}
+}
+
+// dlqRetryCmd requeues one DLQ entry by id, or every entry matching
+// --filter/--since (or --all) for bulk replays after an outage.
+func dlqRetryCmd(store storage.Store, q *queue.Queue, args []string) {
+	flags := flag.NewFlagSet("dlq retry", flag.ExitOnError)
+	all := flags.Bool("all", false, "retry every DLQ entry")
+	filterExpr := flags.String("filter", "", "only entries matching cmd~TEXT, error~TEXT, queue=NAME or reason=REASON")
+	since := flags.String("since", "", "only entries that failed within this age, e.g. 1d")
+	keepAttempts := flags.Bool("keep-attempts", false, "keep the attempt count instead of starting over")
+	flags.Parse(args)
 
-		id, err := strconv.Atoi(args[1])
+	if flags.NArg() == 1 && !*all && *filterExpr == "" && *since == "" {
+		id, err := strconv.Atoi(flags.Arg(0))
 		if err != nil {
-			fmt.Println("invalid job id:", args[1])
-			return
+			usageError("invalid job id: %s", flags.Arg(0))
+		}
+		newID, err := q.RetryDead(id, *keepAttempts)
+		if err != nil {
+			failf("retry failed: %v", err)
 		}
+		fmt.Printf("retried dead job %d as job %d\n", id, newID)
+		return
+	}
+	if flags.NArg() != 0 || (!*all && *filterExpr == "" && *since == "") {
+		usageError("usage: queuectl dlq retry [--keep-attempts] <dead_job_id> | --all | [--filter EXPR] [--since AGE]")
+	}
 
-		if err := storage.RetryDeadJob(db, id); err != nil {
-			fmt.Printf("retry failed: %v\n", err)
-			return
+	filter, err := parseDeadFilter(*filterExpr)
+	if err != nil {
+		usageError("%v", err)
+	}
+	if *since != "" {
+		age, err := duration.Parse(*since)
+		if err != nil {
+			usageError("%v", err)
 		}
+		filter.Since = time.Now().Add(-age)
+	}
 
-		fmt.Printf("retried dead job %d\n", id)
+	ds, err := store.FindDeadJobs(filter)
+	if err != nil {
+		fatal("list dead jobs", err)
+	}
+	retried, failed := 0, 0
+	for _, d := range ds {
+		newID, err := q.RetryDead(int(d.ID), *keepAttempts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "retry of dead job %d failed: %v\n", d.ID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("retried dead job %d as job %d\n", d.ID, newID)
+		retried++
+	}
+	fmt.Printf("retried %d dead jobs, %d failed\n", retried, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
 
-	default:
-		fmt.Println("usage: queuectl dlq [list|retry <id>]")
+// parseDeadFilter turns "cmd~backup", "error~timeout", "queue=emails" or
+// "reason=timeout" into a DLQ filter. An empty expression matches
+// everything.
+func parseDeadFilter(expr string) (storage.DeadJobFilter, error) {
+	var f storage.DeadJobFilter
+	if expr == "" {
+		return f, nil
 	}
+	if field, value, ok := strings.Cut(expr, "~"); ok {
+		switch field {
+		case "cmd", "command":
+			f.Command = value
+			return f, nil
+		case "error":
+			f.Error = value
+			return f, nil
+		}
+	}
+	if field, value, ok := strings.Cut(expr, "="); ok {
+		switch field {
+		case "queue":
+			f.Queue = value
+			return f, nil
+		case "reason":
+			f.Reason = job.DeadReason(value)
+			return f, nil
+		}
+	}
+	return f, fmt.Errorf("invalid filter %q: want cmd~TEXT, error~TEXT, queue=NAME or reason=REASON", expr)
 }
 
 
@@ -194,140 +678,623 @@ func dlqCmd(db *sql.DB, args []string) {
 
 func flushCmd(q *queue.Queue, args []string) {
 	if len(args) < 1 {
-		fmt.Println("usage: queuectl flush [pending|dead|all]")
-		return
+		usageError("usage: queuectl flush [pending|dead|all]")
 	}
 
 	kind := args[0]
 
 	if err := q.Flush(kind); err != nil {
-		fmt.Printf("flush failed: %v\n", err)
-		return
+		failf("flush failed: %v", err)
 	}
 
 	fmt.Printf("flushed %s jobs\n", kind)
 }
-func configCmd(db *sql.DB, args []string) {
+func configCmd(store storage.Store, args []string) {
 	if len(args) == 0 {
 		// list all
-		cfg, err := storage.ConfigList(db)
+		cfg, err := store.ConfigList()
 		if err != nil {
-			log.Fatalf("config list: %v", err)
-		}
-		if len(cfg) == 0 {
-			fmt.Println("no config values set")
-			return
-		}
-		for k, v := range cfg {
-			fmt.Printf("%s = %s\n", k, v)
+			fatal("config list", err)
 		}
+		render(configView(cfg))
 		return
 	}
 
 	switch args[0] {
 	case "get":
 		if len(args) < 2 {
-			fmt.Println("usage: queuectl config get <key>")
-			return
+			usageError("usage: queuectl config get <key>")
 		}
-		val, err := storage.ConfigGet(db, args[1])
+		val, err := store.ConfigGet(args[1])
 		if err != nil {
-			log.Fatalf("config get: %v", err)
+			fatal("config get", err)
 		}
-		if val == "" {
-			fmt.Printf("%s not set\n", args[1])
-			return
-		}
-		fmt.Println(val)
+		render(&configValue{Key: args[1], Value: val, Set: val != ""})
 
 
 	case "set":
 		if len(args) < 3 {
-			fmt.Println("usage: queuectl config set <key> <value>")
-			return
+			usageError("usage: queuectl config set <key> <value>")
+		}
+		if err := validateConfig(args[1], args[2]); err != nil {
+			usageError("%v", err)
 		}
-		if err := storage.ConfigSet(db, args[1], args[2]); err != nil {
-			log.Fatalf("config set: %v", err)
+		if err := store.ConfigSet(args[1], args[2]); err != nil {
+			fatal("config set", err)
 		}
 		fmt.Printf("%s set to %s\n", args[1], args[2])
 
 	default:
-		fmt.Println("usage: queuectl config [get|set]")
+		usageError("usage: queuectl config [get|set]")
 	}
 }
 
-func statusCmd(db *sql.DB, q *queue.Queue) {
-    counts := map[job.JobState]int{}
-    states := []job.JobState{job.Pending, job.Running, job.Failed, job.Completed, job.Dead}
+// validateConfig rejects values that would only fail later inside a worker.
+func validateConfig(key, value string) error {
+	switch key {
+	case "log_level":
+		return logging.SetLevel(value)
+	case "backoff":
+		_, err := backoff.Parse(value, nil)
+		return err
+	case "max_backoff":
+		_, err := time.ParseDuration(value)
+		return err
+	}
+	if key == retention.ConfigKey(retention.Completed) || key == retention.ConfigKey(retention.Dead) {
+		_, err := duration.Parse(value)
+		return err
+	}
+	if key == "redrive_after" || strings.HasPrefix(key, "queue.") && strings.HasSuffix(key, ".redrive_after") {
+		_, err := duration.Parse(value)
+		return err
+	}
+	if key == "redrive_max" || strings.HasPrefix(key, "queue.") && strings.HasSuffix(key, ".redrive_max") ||
+		key == "max_retries" || strings.HasPrefix(key, "queue.") && strings.HasSuffix(key, ".max_retries") {
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer", key)
+		}
+	}
+	return nil
+}
 
-    for _, s := range states {
-        n, err := storage.CountJobsByState(db, s)
+func statusCmd(store storage.Store, q *queue.Queue) {
+    var v statusView
+    counts := map[job.JobState]*int{
+        job.Pending: &v.Jobs.Pending, job.Running: &v.Jobs.Running, job.Failed: &v.Jobs.Failed,
+        job.Completed: &v.Jobs.Completed, job.Dead: &v.Jobs.Dead,
+    }
+    for s, n := range counts {
+        c, err := store.CountJobs(s)
         if err != nil {
-            log.Fatalf("count jobs: %v", err)
+            fatal("count jobs", err)
         }
-        counts[s] = n
+        *n = c
     }
 
-    next, err := storage.GetNextScheduledJob(db)
+    next, err := store.NextScheduledJob()
     if err != nil && err != sql.ErrNoRows {
-        log.Fatalf("fetch next job: %v", err)
+        fatal("fetch next job", err)
     }
-
-    cfg, _ := storage.ConfigList(db)
-
-    fmt.Println("=== Queue Status ===")
-    fmt.Printf("Pending: %d\n", counts[job.Pending])
-    fmt.Printf("Running: %d\n", counts[job.Running])
-    fmt.Printf("Failed: %d\n", counts[job.Failed])
-    fmt.Printf("Completed: %d\n", counts[job.Completed])
-    fmt.Printf("Dead (DLQ): %d\n", counts[job.Dead])
     if next != nil {
-        fmt.Printf("Next Scheduled Job: ID=%d at %s\n", next.ID, next.ScheduledAt.Format(time.RFC3339))
-    } else {
-        fmt.Println("Next Scheduled Job: none")
+        v.NextScheduled = &nextJob{ID: next.ID, ScheduledAt: next.ScheduledAt}
     }
 
-    fmt.Println("\n=== Config ===")
-    for k, v := range cfg {
-        fmt.Printf("%s = %s\n", k, v)
-    }
+    redrives, _ := q.RedriveStatuses()
+    v.Redrive = newRedriveViews(redrives)
 
-    fmt.Println("\n=== Workers ===")
-    workers, _ := worker.GetAllWorkerStatus(db)
-    for _, w := range workers {
-        fmt.Printf("worker-%d: state=%s job_id=%d updated=%s\n", w.ID, w.State, w.CurrentJobID, w.UpdatedAt.Format(time.RFC3339))
+    cfg, _ := store.ConfigList()
+    v.Config = configView(cfg)
+    if v.Config == nil {
+        v.Config = configView{}
     }
+
+    workers, _ := store.ListWorkers()
+    v.Workers = newWorkerViews(workers)
+
+    render(&v)
 }
 
 
 
-func listJobsCmd(db *sql.DB, args []string) {
-    flags := flag.NewFlagSet("list", flag.ExitOnError)
-    state := flags.String("state", "", "filter jobs by state (pending, running, failed, completed)")
-    _ = flags.Parse(args)
+// listJobsCmd prints the jobs matching its filters, a page at a time.
+// When a page is full it also prints the --after cursor of the next one.
+func listJobsCmd(store storage.Store, args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	state := flags.String("state", "", "filter jobs by state (pending, running, failed, completed)")
+	queueName := flags.String("queue", "", "only jobs on this queue")
+	command := flags.String("cmd", "", "only commands containing this text")
+	commandRegexp := flags.String("cmd-regex", "", "only commands matching this regular expression")
+	errText := flags.String("error", "", "only jobs whose last error contains this text")
+	tag := flags.String("tag", "", "only jobs with this tag")
+	attemptsGT := flags.Int("attempts-gt", -1, "only jobs with more than this many attempts")
+	createdAfter := flags.String("created-after", "", "only jobs created at or after this time (age like 2h or 7d, YYYY-MM-DD or RFC3339)")
+	createdBefore := flags.String("created-before", "", "only jobs created before this time")
+	updatedAfter := flags.String("updated-after", "", "only jobs updated at or after this time")
+	updatedBefore := flags.String("updated-before", "", "only jobs updated before this time")
+	sortSpec := flags.String("sort", "id", "sort by "+strings.Join(storage.JobSortFields, ", ")+"; prefix with - for descending")
+	limit := flags.Int("limit", 100, "jobs per page; 0 for all")
+	after := flags.String("after", "", "cursor printed with the previous page")
+	_ = flags.Parse(args)
 
-    // If no state given, show all
-    if *state == "" {
-        jobsCmd(db)
-        return
-    }
+	order, err := storage.ParseJobSort(*sortSpec)
+	if err != nil {
+		usageError("%v", err)
+	}
+	f := storage.JobFilter{
+		State: job.JobState(*state), Queue: *queueName, Command: *command, CommandRegexp: *commandRegexp,
+		Error: *errText, Tag: *tag, MinAttempts: *attemptsGT + 1, Sort: order, Limit: *limit, After: *after,
+	}
+	for _, t := range []struct {
+		flag, value string
+		dst         *time.Time
+	}{
+		{"created-after", *createdAfter, &f.CreatedAfter},
+		{"created-before", *createdBefore, &f.CreatedBefore},
+		{"updated-after", *updatedAfter, &f.UpdatedAfter},
+		{"updated-before", *updatedBefore, &f.UpdatedBefore},
+	} {
+		if t.value == "" {
+			continue
+		}
+		if *t.dst, err = parseTimeArg(t.value); err != nil {
+			usageError("--%s: %v", t.flag, err)
+		}
+	}
+	if err := f.Check(); err != nil {
+		usageError("%v", err)
+	}
 
-    js, err := storage.GetJobsByState(db, job.JobState(*state))
-    if err != nil {
-        log.Fatalf("get jobs: %v", err)
-    }
-    if len(js) == 0 {
-        fmt.Printf("No jobs in state: %s\n", *state)
-        return
-    }
+	js, err := store.FindJobs(f)
+	if err != nil {
+		fatal("find jobs", err)
+	}
+	l := newJobList(js)
+	if f.Limit > 0 && len(js) == f.Limit {
+		l.Next = order.Cursor(&js[len(js)-1])
+	}
+	render(l)
+}
 
-    fmt.Printf("=== %s ===\n", *state)
-    for _, j := range js {
-        fmt.Printf(
-            "id=%d cmd=%s attempts=%d scheduled_at=%s updated_at=%s\n",
-            j.ID, j.Command, j.Attempts,
-            j.ScheduledAt.Format(time.RFC3339),
-            j.UpdatedAt.Format(time.RFC3339),
-        )
-    }
+// parseTimeArg reads a time flag: an age such as 2h or 7d, counted back
+// from now, a date (YYYY-MM-DD, UTC) or an RFC3339 time.
+func parseTimeArg(s string) (time.Time, error) {
+	if d, err := duration.Parse(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want an age like 2h or 7d, YYYY-MM-DD or RFC3339)", s)
+}
+
+
+// startNotifier sends alerts for dead jobs and failing queues from
+// long-running processes.
+func startNotifier(store notify.Store, q *queue.Queue) {
+	n := notify.New(store)
+	q.OnDead(n.JobDead)
+	q.OnEscalate(n.Escalated)
+	go n.Run()
+	go n.WatchFailureRate(time.Minute)
+}
+
+func notifyCmd(store notify.Store, args []string) {
+	if len(args) == 0 {
+		usageError("usage: queuectl notify [add|list|remove|test]")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			usageError("usage: queuectl notify add webhook|slack|smtp <target> [--from A --to B,C]")
+		}
+		flags := flag.NewFlagSet("notify add", flag.ExitOnError)
+		from := flags.String("from", "queuectl@localhost", "sender address (smtp)")
+		to := flags.String("to", "", "comma separated recipients (smtp)")
+		_ = flags.Parse(args[3:])
+
+		sink := storage.Sink{Kind: args[1], Target: args[2], EmailFrom: *from, EmailTo: *to}
+		if _, err := notify.NewSender(sink, nil); err != nil {
+			usageError("%v", err)
+		}
+		if sink.Kind == "smtp" && *to == "" {
+			usageError("smtp sinks need --to")
+		}
+		id, err := store.InsertSink(sink)
+		if err != nil {
+			fatal("add sink", err)
+		}
+		fmt.Printf("added %s sink id=%d\n", sink.Kind, id)
+
+	case "list":
+		sinks, err := store.ListSinks()
+		if err != nil {
+			fatal("list sinks", err)
+		}
+		if len(sinks) == 0 {
+			fmt.Println("no notification sinks")
+			return
+		}
+		for _, s := range sinks {
+			fmt.Printf("id=%d kind=%s target=%s", s.ID, s.Kind, s.Target)
+			if s.Kind == "smtp" {
+				fmt.Printf(" from=%s to=%s", s.EmailFrom, s.EmailTo)
+			}
+			fmt.Println()
+		}
+
+	case "remove":
+		if len(args) < 2 {
+			usageError("usage: queuectl notify remove <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			usageError("invalid sink id: %s", args[1])
+		}
+		if err := store.DeleteSink(id); err != nil {
+			failf("remove failed: %v", err)
+		}
+		fmt.Printf("removed sink %d\n", id)
+
+	case "test":
+		err := notify.New(store).Send(notify.Message{
+			Event: "test",
+			Title: "test notification",
+			Text:  "queuectl notification sinks are working",
+		})
+		if err != nil {
+			failf("test failed: %v", err)
+		}
+		fmt.Println("test notification sent")
+
+	default:
+		usageError("usage: queuectl notify [add|list|remove|test]")
+	}
+}
+
+
+// inspectCmd prints everything known about one job, including the
+// effective retry limit after applying queue and global defaults.
+func inspectCmd(db *sql.DB, q *queue.Queue, args []string) {
+	if len(args) < 1 {
+		usageError("usage: queuectl inspect <job_id>")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		usageError("invalid job id: %s", args[0])
+	}
+
+	v := &inspectView{Archived: []archivedView{}}
+	j, err := storage.GetJobByID(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		d, derr := storage.GetDeadJobByOrigID(db, id)
+		if derr != nil {
+			inspectArchived(db, id, v)
+			return
+		}
+		j = &job.Job{
+			ID: id, Command: d.Command, State: job.Dead, Attempts: d.Attempts, MaxRetries: d.MaxRetries,
+			CreatedAt: d.CreatedAt, UpdatedAt: d.FailedAt, LastError: d.LastError.String, Queue: d.Queue,
+			Tags: d.Tags,
+		}
+		v.DeadJobID = d.ID
+	} else if err != nil {
+		fatal("get job", err)
+	}
+
+	maxRetries, source := q.EffectiveMaxRetries(j)
+	v.Job = &jobDetail{
+		jobView:             newJobView(j),
+		EffectiveMaxRetries: maxRetries,
+		MaxRetriesFrom:      source,
+		Backoff:             j.Backoff,
+		RetryOn:             codes(j.Retry.RetryOn),
+		NoRetryOn:           codes(j.Retry.NoRetryOn),
+		RetryLaterOn:        codes(j.Retry.RetryLaterOn),
+		Replays:             j.Replays,
+		RetriedFrom:         j.RetriedFrom,
+	}
+	render(v)
+}
+
+// pruneCmd deletes completed jobs and DLQ entries older than
+// --older-than, or than their retention.* config when it is omitted.
+func pruneCmd(store retention.Store, args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	completed := flags.Bool("completed", false, "prune completed jobs")
+	dead := flags.Bool("dead", false, "prune DLQ entries")
+	olderThan := flags.String("older-than", "", "age cutoff, e.g. 24h or 7d (default: retention.<kind> config)")
+	dryRun := flags.Bool("dry-run", false, "only report what would be deleted")
+	batch := flags.Int("batch", retention.DefaultBatch, "rows deleted per transaction")
+	_ = flags.Parse(args)
+
+	var kinds []retention.Kind
+	if *completed {
+		kinds = append(kinds, retention.Completed)
+	}
+	if *dead {
+		kinds = append(kinds, retention.Dead)
+	}
+	if len(kinds) == 0 {
+		kinds = retention.Kinds
+	}
+
+	for _, k := range kinds {
+		var age time.Duration
+		if *olderThan != "" {
+			d, err := duration.Parse(*olderThan)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "--older-than: %v\n", err)
+				os.Exit(2)
+			}
+			age = d
+		} else {
+			d, ok, err := retention.Period(store, k)
+			if err != nil {
+				fatal("read retention period", err)
+			}
+			if !ok {
+				fmt.Printf("%s: no %s set, skipping (use --older-than)\n", k, retention.ConfigKey(k))
+				continue
+			}
+			age = d
+		}
+
+		if *dryRun {
+			n, err := retention.Count(store, k, age)
+			if err != nil {
+				fatal("count prunable jobs", err)
+			}
+			fmt.Printf("%s: would delete %d older than %s\n", k, n, age)
+			continue
+		}
+		n, err := retention.Prune(store, k, age, *batch)
+		if err != nil {
+			fatal("prune", err)
+		}
+		fmt.Printf("%s: deleted %d older than %s\n", k, n, age)
+	}
+}
+
+// inspectArchived prints the restored archive records of a job that is
+// no longer in the queue or the DLQ.
+func inspectArchived(db *sql.DB, id int64, v *inspectView) {
+	records, err := storage.ArchivedJobsByJobID(db, id)
+	if err != nil {
+		fatal("get archived job", err)
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(os.Stderr, "job %d not found\n", id)
+		os.Exit(1)
+	}
+	for _, a := range records {
+		v.Archived = append(v.Archived, archivedView{
+			Kind: a.Kind, ID: a.ID, JobID: a.JobID, Queue: a.Queue, Command: a.Command, State: a.State,
+			Attempts: a.Attempts, CreatedAt: a.CreatedAt, FinishedAt: a.FinishedAt, LastError: a.LastError,
+		})
+	}
+	render(v)
+}
+
+// archiveCmd exports completed and dead jobs to a JSON Lines archive,
+// optionally deleting them afterwards, or restores an archive into the
+// archived_jobs table. It reads from db and writes through writer.
+func archiveCmd(db, writer *sql.DB, args []string) {
+	if len(args) > 0 && args[0] == "restore" {
+		if len(args) < 2 {
+			usageError("usage: queuectl archive restore <file.jsonl[.gz]>")
+		}
+		r, err := archive.Open(args[1])
+		if err != nil {
+			fatal("open archive", err)
+		}
+		defer r.Close()
+		n, err := archive.Restore(writer, r)
+		if err != nil {
+			fatal("restore archive", err)
+		}
+		fmt.Printf("restored %d records into archived_jobs\n", n)
+		return
+	}
+
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	beforeFlag := flags.String("before", "", "archive jobs finished before this date (YYYY-MM-DD or RFC3339)")
+	out := flags.String("out", "", "archive file to create, gzipped if it ends in .gz")
+	del := flags.Bool("delete", false, "delete the archived jobs once the file is written")
+	_ = flags.Parse(args)
+	if *beforeFlag == "" || *out == "" {
+		usageError("usage: queuectl archive --before 2026-10-01 --out archive.jsonl.gz [--delete]")
+	}
+	before, err := time.Parse("2006-01-02", *beforeFlag)
+	if err != nil {
+		if before, err = time.Parse(time.RFC3339, *beforeFlag); err != nil {
+			usageError("invalid --before date: %s", *beforeFlag)
+		}
+	}
+
+	w, err := archive.Create(*out)
+	if err != nil {
+		fatal("create archive", err)
+	}
+	res, err := archive.Export(db, w, before)
+	if err != nil {
+		w.Close()
+		os.Remove(*out)
+		fatal("export archive", err)
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(*out)
+		fatal("write archive", err)
+	}
+	fmt.Printf("archived %d completed and %d dead jobs to %s\n", res.Completed, res.Dead, *out)
+
+	if *del {
+		n, err := archive.Delete(writer, res)
+		if err != nil {
+			fatal("delete archived jobs", err)
+		}
+		fmt.Printf("deleted %d archived jobs\n", n)
+	}
+}
+
+// backupCmd snapshots the database while workers keep running.
+func backupCmd(db *sql.DB, args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "", "snapshot file to create")
+	_ = flags.Parse(args)
+	if *out == "" {
+		usageError("usage: queuectl backup --out snap.db")
+	}
+	if err := storage.Backup(db, *out); err != nil {
+		fatal("backup", err)
+	}
+	version, _ := storage.CurrentVersion(db)
+	fmt.Printf("backed up to %s (schema version %d)\n", *out, version)
+}
+
+// restoreCmd replaces the database with a snapshot. It refuses while any
+// worker is alive, since they would keep writing to the old data.
+func restoreCmd(db, writer *sql.DB, args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := flags.String("from", "", "snapshot file made by queuectl backup")
+	_ = flags.Parse(args)
+	if *from == "" {
+		usageError("usage: queuectl restore --from snap.db")
+	}
+
+	alive, err := worker.AliveWorkers(db)
+	if err != nil {
+		fatal("list workers", err)
+	}
+	if len(alive) > 0 {
+		fmt.Fprintf(os.Stderr, "refusing to restore: %d workers are alive, stop them first (queuectl worker stop)\n", len(alive))
+		for _, w := range alive {
+			fmt.Fprintf(os.Stderr, "  worker-%d: state=%s updated=%s\n", w.ID, w.State, w.UpdatedAt.Format(time.RFC3339))
+		}
+		os.Exit(1)
+	}
+
+	version, err := storage.Restore(writer, *from)
+	if err != nil {
+		fatal("restore", err)
+	}
+	if version == 0 {
+		fmt.Printf("warning: %s has no schema version, it was not made by queuectl backup\n", *from)
+	}
+	fmt.Printf("restored from %s (schema version %d), integrity check ok\n", *from, version)
+}
+
+// benchCmd runs synthetic jobs through in-process workers on a temporary
+// database and prints what it measured.
+func benchCmd(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	var o bench.Options
+	flags.IntVar(&o.Jobs, "jobs", 1000, "jobs to enqueue")
+	flags.IntVar(&o.Workers, "workers", 4, "worker goroutines")
+	flags.IntVar(&o.Prefetch, "prefetch", 0, "claim up to N jobs per query, as in worker start")
+	flags.DurationVar(&o.JobTime, "job-time", 0, "how long each job sleeps, e.g. 50ms")
+	flags.Float64Var(&o.FailRate, "fail-rate", 0, "fraction of jobs that fail, 0 to 1")
+	flags.Float64Var(&o.Rate, "rate", 0, "enqueues per second (default: as fast as possible)")
+	flags.StringVar(&o.Dir, "dir", "", "directory for the temporary database (default: system temp dir)")
+	_ = flags.Parse(args)
+
+	r, err := bench.Run(o)
+	if err != nil {
+		fatal("bench", err)
+	}
+	fmt.Printf("jobs:         %d (%d failed)\n", r.Jobs, r.Failed)
+	fmt.Printf("workers:      %d (prefetch %d)\n", o.Workers, o.Prefetch)
+	fmt.Printf("elapsed:      %s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Printf("enqueue:      %.0f jobs/s\n", r.EnqueueRate)
+	fmt.Printf("completion:   %.0f jobs/s\n", r.CompleteRate)
+	fmt.Printf("claim p50:    %s\n", r.ClaimP50.Round(time.Microsecond))
+	fmt.Printf("claim p99:    %s\n", r.ClaimP99.Round(time.Microsecond))
+	fmt.Printf("lock errors:  %d\n", r.LockErrors)
+}
+
+// dbCmd applies, lists or rolls back schema migrations.
+func dbCmd(args []string) {
+	if len(args) == 0 {
+		usageError("usage: queuectl db migrate|status|down [--to N]")
+	}
+	db, err := storage.Open(dbPath)
+	if err != nil {
+		fatal("open db", err)
+	}
+	defer db.Close()
+
+	current, err := storage.CurrentVersion(db)
+	if err != nil {
+		fatal("read schema version", err)
+	}
+	latest := storage.LatestVersion()
+
+	switch args[0] {
+	case "status":
+		applied, err := storage.AppliedMigrations(db)
+		if err != nil {
+			fatal("list migrations", err)
+		}
+		at := map[int]time.Time{}
+		for _, a := range applied {
+			at[a.Version] = a.AppliedAt
+		}
+		fmt.Printf("schema version %d, this queuectl knows up to %d\n", current, latest)
+		if current > latest {
+			fmt.Println("the database is newer than this queuectl; workers will refuse to start")
+		}
+		for _, m := range storage.Migrations {
+			status := "pending"
+			if t, ok := at[m.Version]; ok {
+				status = "applied " + t.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", m.Version, m.Name, status)
+		}
+
+	case "migrate":
+		done, err := storage.MigrateTo(db, storage.Migrations, latest)
+		for _, v := range done {
+			fmt.Printf("applied %04d\n", v)
+		}
+		if err != nil {
+			fatal("migrate", err)
+		}
+		if len(done) == 0 {
+			fmt.Printf("already at schema version %d\n", current)
+		}
+
+	case "down":
+		if current <= 1 {
+			fmt.Println("nothing to roll back: the baseline migration cannot be rolled back")
+			return
+		}
+		flags := flag.NewFlagSet("db down", flag.ExitOnError)
+		to := flags.Int("to", current-1, "schema version to roll back to")
+		_ = flags.Parse(args[1:])
+		if *to < 1 || *to >= current {
+			usageError("--to must be between 1 and %d", current-1)
+		}
+		alive, err := worker.AliveWorkers(db)
+		if err != nil {
+			fatal("list workers", err)
+		}
+		if len(alive) > 0 {
+			fmt.Fprintf(os.Stderr, "refusing to roll back: %d workers are alive, stop them first\n", len(alive))
+			os.Exit(1)
+		}
+		done, err := storage.MigrateTo(db, storage.Migrations, *to)
+		for _, v := range done {
+			fmt.Printf("rolled back %04d\n", v)
+		}
+		if err != nil {
+			fatal("roll back", err)
+		}
+
+	default:
+		usageError("usage: queuectl db migrate|status|down [--to N]")
+	}
 }
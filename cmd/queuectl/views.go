@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/output"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+// outputFormat is the --output format.
+var outputFormat = output.Table
+
+// render prints a command result in the --output format.
+func render(v any) {
+	if err := output.Render(os.Stdout, outputFormat, v); err != nil {
+		fatal("render output", err)
+	}
+}
+
+// The types below are what status, jobs, list, dlq list, config and
+// inspect print. Their json/yaml names are a stable interface for
+// scripts: fields are always present, with zero values rather than
+// omitted, and slices are empty rather than null.
+
+type jobView struct {
+	ID          int64     `json:"id" yaml:"id"`
+	Queue       string    `json:"queue" yaml:"queue"`
+	Command     string    `json:"command" yaml:"command"`
+	State       string    `json:"state" yaml:"state"`
+	Attempts    int       `json:"attempts" yaml:"attempts"`
+	MaxRetries  int       `json:"max_retries" yaml:"max_retries"` // -1 inherits the queue or global default
+	CreatedAt   time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" yaml:"updated_at"`
+	ScheduledAt time.Time `json:"scheduled_at" yaml:"scheduled_at"`
+	LastError   string    `json:"last_error" yaml:"last_error"`
+	Tags        []string  `json:"tags" yaml:"tags"`
+}
+
+func newJobView(j *job.Job) jobView {
+	v := jobView{
+		ID: j.ID, Queue: j.Queue, Command: j.Command, State: string(j.State), Attempts: j.Attempts,
+		MaxRetries: j.MaxRetries, CreatedAt: j.CreatedAt, UpdatedAt: j.UpdatedAt, ScheduledAt: j.ScheduledAt,
+		LastError: j.LastError, Tags: j.Tags,
+	}
+	if v.Tags == nil {
+		v.Tags = []string{}
+	}
+	return v
+}
+
+type jobList struct {
+	Jobs []jobView `json:"jobs" yaml:"jobs"`
+	Next string    `json:"next" yaml:"next"` // list --after cursor of the next page, "" on the last
+}
+
+func newJobList(js []job.Job) *jobList {
+	l := &jobList{Jobs: make([]jobView, 0, len(js))}
+	for i := range js {
+		l.Jobs = append(l.Jobs, newJobView(&js[i]))
+	}
+	return l
+}
+
+func (l *jobList) WriteTable(w io.Writer) {
+	if len(l.Jobs) == 0 {
+		fmt.Fprintln(w, "no jobs")
+		return
+	}
+	fmt.Fprintln(w, "ID\tSTATE\tQUEUE\tATTEMPTS\tSCHEDULED\tUPDATED\tTAGS\tCOMMAND")
+	for _, j := range l.Jobs {
+		tags := job.FormatTags(j.Tags)
+		if tags == "" {
+			tags = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", j.ID, j.State, j.Queue, j.Attempts,
+			output.Time(j.ScheduledAt), output.Time(j.UpdatedAt), tags, j.Command)
+	}
+	if l.Next != "" {
+		fmt.Fprintf(w, "\nmore jobs: --after %s\n", l.Next)
+	}
+}
+
+type deadJobView struct {
+	ID         int64     `json:"id" yaml:"id"`
+	OrigID     int64     `json:"orig_id" yaml:"orig_id"` // 0 for entries from before ids were kept
+	Queue      string    `json:"queue" yaml:"queue"`
+	Command    string    `json:"command" yaml:"command"`
+	Reason     string    `json:"reason" yaml:"reason"`
+	Attempts   int       `json:"attempts" yaml:"attempts"`
+	MaxRetries int       `json:"max_retries" yaml:"max_retries"`
+	Replays    int       `json:"replays" yaml:"replays"`
+	Escalated  bool      `json:"escalated" yaml:"escalated"`
+	CreatedAt  time.Time `json:"created_at" yaml:"created_at"`
+	FailedAt   time.Time `json:"failed_at" yaml:"failed_at"`
+	LastError  string    `json:"last_error" yaml:"last_error"`
+	Tags       []string  `json:"tags" yaml:"tags"`
+}
+
+type deadJobList struct {
+	DeadJobs []deadJobView `json:"dead_jobs" yaml:"dead_jobs"`
+}
+
+func newDeadJobList(ds []storage.DeadJob) *deadJobList {
+	l := &deadJobList{DeadJobs: make([]deadJobView, 0, len(ds))}
+	for _, d := range ds {
+		l.DeadJobs = append(l.DeadJobs, deadJobView{
+			ID: d.ID, OrigID: d.OrigID.Int64, Queue: d.Queue, Command: d.Command, Reason: deadReason(d.Reason),
+			Attempts: d.Attempts, MaxRetries: d.MaxRetries, Replays: d.Replays, Escalated: d.Escalated,
+			CreatedAt: d.CreatedAt, FailedAt: d.FailedAt, LastError: d.LastError.String, Tags: d.Tags,
+		})
+		if d.Tags == nil {
+			l.DeadJobs[len(l.DeadJobs)-1].Tags = []string{}
+		}
+	}
+	return l
+}
+
+func (l *deadJobList) WriteTable(w io.Writer) {
+	if len(l.DeadJobs) == 0 {
+		fmt.Fprintln(w, "no dead jobs")
+		return
+	}
+	fmt.Fprintln(w, "ID\tORIG\tQUEUE\tREASON\tATTEMPTS\tFAILED\tCOMMAND")
+	for _, d := range l.DeadJobs {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%s\t%s\n", d.ID, d.OrigID, d.Queue, d.Reason, d.Attempts,
+			output.Time(d.FailedAt), d.Command)
+	}
+}
+
+// configView is every config value by key. JSON and YAML sort map keys
+// on their own; the table sorts them here.
+type configView map[string]string
+
+func (c configView) WriteTable(w io.Writer) {
+	if len(c) == 0 {
+		fmt.Fprintln(w, "no config values set")
+		return
+	}
+	fmt.Fprintln(w, "KEY\tVALUE")
+	c.writeRows(w)
+}
+
+func (c configView) writeRows(w io.Writer) {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\n", k, c[k])
+	}
+}
+
+type configValue struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+	Set   bool   `json:"set" yaml:"set"`
+}
+
+func (c *configValue) WriteTable(w io.Writer) {
+	if !c.Set {
+		fmt.Fprintf(w, "%s not set\n", c.Key)
+		return
+	}
+	fmt.Fprintln(w, c.Value)
+}
+
+type statusView struct {
+	Jobs          jobCounts     `json:"jobs" yaml:"jobs"`
+	NextScheduled *nextJob      `json:"next_scheduled" yaml:"next_scheduled"` // null when nothing is waiting
+	Redrive       []redriveView `json:"redrive" yaml:"redrive"`
+	Config        configView    `json:"config" yaml:"config"`
+	Workers       []workerView  `json:"workers" yaml:"workers"`
+}
+
+type jobCounts struct {
+	Pending   int `json:"pending" yaml:"pending"`
+	Running   int `json:"running" yaml:"running"`
+	Failed    int `json:"failed" yaml:"failed"`
+	Completed int `json:"completed" yaml:"completed"`
+	Dead      int `json:"dead" yaml:"dead"`
+}
+
+type nextJob struct {
+	ID          int64     `json:"id" yaml:"id"`
+	ScheduledAt time.Time `json:"scheduled_at" yaml:"scheduled_at"`
+}
+
+type redriveView struct {
+	Queue     string `json:"queue" yaml:"queue"`
+	After     string `json:"after" yaml:"after"`
+	Max       int    `json:"max" yaml:"max"`
+	Waiting   int    `json:"waiting" yaml:"waiting"`
+	Due       int    `json:"due" yaml:"due"`
+	Escalated int    `json:"escalated" yaml:"escalated"`
+	Skipped   int    `json:"skipped" yaml:"skipped"`
+}
+
+func newRedriveViews(rs []queue.RedriveStatus) []redriveView {
+	vs := make([]redriveView, 0, len(rs))
+	for _, r := range rs {
+		vs = append(vs, redriveView{
+			Queue: r.Queue, After: r.Policy.After.String(), Max: r.Policy.Max,
+			Waiting: r.Waiting, Due: r.Due, Escalated: r.Escalated, Skipped: r.Skipped,
+		})
+	}
+	return vs
+}
+
+type workerView struct {
+	ID        int       `json:"id" yaml:"id"`
+	State     string    `json:"state" yaml:"state"`
+	JobID     int64     `json:"job_id" yaml:"job_id"` // 0 when idle
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+func newWorkerViews(ws []storage.WorkerStatus) []workerView {
+	vs := make([]workerView, 0, len(ws))
+	for _, w := range ws {
+		vs = append(vs, workerView{ID: w.ID, State: w.State, JobID: w.CurrentJobID, UpdatedAt: w.UpdatedAt})
+	}
+	return vs
+}
+
+func (s *statusView) WriteTable(w io.Writer) {
+	fmt.Fprintln(w, "=== Queue Status ===")
+	fmt.Fprintf(w, "Pending:\t%d\n", s.Jobs.Pending)
+	fmt.Fprintf(w, "Running:\t%d\n", s.Jobs.Running)
+	fmt.Fprintf(w, "Failed:\t%d\n", s.Jobs.Failed)
+	fmt.Fprintf(w, "Completed:\t%d\n", s.Jobs.Completed)
+	fmt.Fprintf(w, "Dead (DLQ):\t%d\n", s.Jobs.Dead)
+	if s.NextScheduled != nil {
+		fmt.Fprintf(w, "Next Scheduled Job:\tID=%d at %s\n", s.NextScheduled.ID, output.Time(s.NextScheduled.ScheduledAt))
+	} else {
+		fmt.Fprintln(w, "Next Scheduled Job:\tnone")
+	}
+
+	if len(s.Redrive) > 0 {
+		fmt.Fprintln(w, "\n=== DLQ Redrive ===")
+		fmt.Fprintln(w, "QUEUE\tAFTER\tMAX\tWAITING\tDUE\tESCALATED\tSKIPPED")
+		for _, r := range s.Redrive {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", r.Queue, r.After, r.Max, r.Waiting, r.Due, r.Escalated, r.Skipped)
+		}
+	}
+
+	fmt.Fprintln(w, "\n=== Config ===")
+	s.Config.writeRows(w)
+
+	fmt.Fprintln(w, "\n=== Workers ===")
+	if len(s.Workers) > 0 {
+		fmt.Fprintln(w, "WORKER\tSTATE\tJOB\tUPDATED")
+	}
+	for _, wk := range s.Workers {
+		fmt.Fprintf(w, "worker-%d\t%s\t%d\t%s\n", wk.ID, wk.State, wk.JobID, output.Time(wk.UpdatedAt))
+	}
+}
+
+// inspectView is one job as inspect finds it: live, in the DLQ (then
+// DeadJobID is set) or only in the archive (then Job is null).
+type inspectView struct {
+	Job       *jobDetail     `json:"job" yaml:"job"`
+	DeadJobID int64          `json:"dead_job_id" yaml:"dead_job_id"`
+	Archived  []archivedView `json:"archived" yaml:"archived"`
+}
+
+type jobDetail struct {
+	jobView             `yaml:",inline"`
+	EffectiveMaxRetries int    `json:"effective_max_retries" yaml:"effective_max_retries"`
+	MaxRetriesFrom      string `json:"max_retries_from" yaml:"max_retries_from"`
+	Backoff             string `json:"backoff" yaml:"backoff"`
+	RetryOn             []int  `json:"retry_on" yaml:"retry_on"`
+	NoRetryOn           []int  `json:"no_retry_on" yaml:"no_retry_on"`
+	RetryLaterOn        []int  `json:"retry_later_on" yaml:"retry_later_on"`
+	Replays             int    `json:"replays" yaml:"replays"`
+	RetriedFrom         int64  `json:"retried_from" yaml:"retried_from"`
+}
+
+type archivedView struct {
+	Kind       string    `json:"kind" yaml:"kind"`
+	ID         int64     `json:"id" yaml:"id"`
+	JobID      int64     `json:"job_id" yaml:"job_id"`
+	Queue      string    `json:"queue" yaml:"queue"`
+	Command    string    `json:"command" yaml:"command"`
+	State      string    `json:"state" yaml:"state"`
+	Attempts   int       `json:"attempts" yaml:"attempts"`
+	CreatedAt  time.Time `json:"created_at" yaml:"created_at"`
+	FinishedAt time.Time `json:"finished_at" yaml:"finished_at"`
+	LastError  string    `json:"last_error" yaml:"last_error"`
+}
+
+// codes keeps empty exit code lists as [] in JSON.
+func codes(cs []int) []int {
+	if cs == nil {
+		return []int{}
+	}
+	return cs
+}
+
+func (v *inspectView) WriteTable(w io.Writer) {
+	if j := v.Job; j != nil {
+		if v.DeadJobID != 0 {
+			fmt.Fprintf(w, "(in DLQ as dead job %d)\n", v.DeadJobID)
+		}
+		fmt.Fprintf(w, "id:\t%d\n", j.ID)
+		fmt.Fprintf(w, "queue:\t%s\n", j.Queue)
+		fmt.Fprintf(w, "command:\t%s\n", j.Command)
+		fmt.Fprintf(w, "state:\t%s\n", j.State)
+		fmt.Fprintf(w, "attempts:\t%d\n", j.Attempts)
+		fmt.Fprintf(w, "max_retries:\t%d (from %s)\n", j.EffectiveMaxRetries, j.MaxRetriesFrom)
+		if len(j.Tags) > 0 {
+			fmt.Fprintf(w, "tags:\t%s\n", job.FormatTags(j.Tags))
+		}
+		if j.Backoff != "" {
+			fmt.Fprintf(w, "backoff:\t%s\n", j.Backoff)
+		}
+		if len(j.RetryOn) > 0 {
+			fmt.Fprintf(w, "retry_on:\t%s\n", job.FormatExitCodes(j.RetryOn))
+		}
+		if len(j.NoRetryOn) > 0 {
+			fmt.Fprintf(w, "no_retry_on:\t%s\n", job.FormatExitCodes(j.NoRetryOn))
+		}
+		if len(j.RetryLaterOn) > 0 {
+			fmt.Fprintf(w, "retry_later:\t%s\n", job.FormatExitCodes(j.RetryLaterOn))
+		}
+		fmt.Fprintf(w, "created_at:\t%s\n", output.Time(j.CreatedAt))
+		fmt.Fprintf(w, "updated_at:\t%s\n", output.Time(j.UpdatedAt))
+		if j.State != string(job.Dead) && j.State != string(job.Completed) {
+			fmt.Fprintf(w, "scheduled_at:\t%s\n", output.Time(j.ScheduledAt))
+		}
+		if j.Replays > 0 {
+			fmt.Fprintf(w, "replays:\t%d (last from DLQ entry %d)\n", j.Replays, j.RetriedFrom)
+		}
+		if j.LastError != "" {
+			fmt.Fprintf(w, "last_error:\t%s\n", j.LastError)
+		}
+	}
+	for _, a := range v.Archived {
+		fmt.Fprintf(w, "(archived %s record %d)\n", a.Kind, a.ID)
+		fmt.Fprintf(w, "id:\t%d\n", a.JobID)
+		fmt.Fprintf(w, "queue:\t%s\n", a.Queue)
+		fmt.Fprintf(w, "command:\t%s\n", a.Command)
+		fmt.Fprintf(w, "state:\t%s\n", a.State)
+		fmt.Fprintf(w, "attempts:\t%d\n", a.Attempts)
+		fmt.Fprintf(w, "created_at:\t%s\n", output.Time(a.CreatedAt))
+		fmt.Fprintf(w, "finished_at:\t%s\n", output.Time(a.FinishedAt))
+		if a.LastError != "" {
+			fmt.Fprintf(w, "last_error:\t%s\n", a.LastError)
+		}
+	}
+}
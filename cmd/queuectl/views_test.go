@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+// TestViewJSONNames pins the JSON field names scripts rely on. Renaming a
+// field here is a breaking change for --output json users.
+func TestViewJSONNames(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	j := job.Job{ID: 7, Queue: "emails", Command: "echo hi", State: job.Failed, Attempts: 2, MaxRetries: 3,
+		CreatedAt: at, UpdatedAt: at, ScheduledAt: at, LastError: "boom", Tags: []string{"nightly"}}
+	const jobJSON = `{"id":7,"queue":"emails","command":"echo hi","state":"failed","attempts":2,"max_retries":3,` +
+		`"created_at":"2026-10-01T12:00:00Z","updated_at":"2026-10-01T12:00:00Z","scheduled_at":"2026-10-01T12:00:00Z",` +
+		`"last_error":"boom","tags":["nightly"]}`
+
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"job list", &jobList{Jobs: []jobView{newJobView(&j)}, Next: "7"}, `{"jobs":[` + jobJSON + `],"next":"7"}`},
+		{"empty job list", newJobList(nil), `{"jobs":[],"next":""}`},
+		{"dead job list", newDeadJobList([]storage.DeadJob{{ID: 3, Command: "false", FailedAt: at, CreatedAt: at}}),
+			`{"dead_jobs":[{"id":3,"orig_id":0,"queue":"","command":"false","reason":"unknown","attempts":0,` +
+				`"max_retries":0,"replays":0,"escalated":false,"created_at":"2026-10-01T12:00:00Z",` +
+				`"failed_at":"2026-10-01T12:00:00Z","last_error":"","tags":[]}]}`},
+		{"config", configView{"max_retries": "3"}, `{"max_retries":"3"}`},
+		{"config value", &configValue{Key: "backoff", Value: "exp:2", Set: true}, `{"key":"backoff","value":"exp:2","set":true}`},
+		{"status", &statusView{
+			Jobs:          jobCounts{Pending: 1, Running: 2, Failed: 3, Completed: 4, Dead: 5},
+			NextScheduled: &nextJob{ID: 7, ScheduledAt: at},
+			Redrive:       []redriveView{{Queue: "emails", After: "1h0m0s", Max: 2, Waiting: 1}},
+			Config:        configView{},
+			Workers:       newWorkerViews([]storage.WorkerStatus{{ID: 1, State: "busy", CurrentJobID: 7, UpdatedAt: at}}),
+		}, `{"jobs":{"pending":1,"running":2,"failed":3,"completed":4,"dead":5},` +
+			`"next_scheduled":{"id":7,"scheduled_at":"2026-10-01T12:00:00Z"},` +
+			`"redrive":[{"queue":"emails","after":"1h0m0s","max":2,"waiting":1,"due":0,"escalated":0,"skipped":0}],` +
+			`"config":{},"workers":[{"id":1,"state":"busy","job_id":7,"updated_at":"2026-10-01T12:00:00Z"}]}`},
+		{"inspect", &inspectView{
+			Job: &jobDetail{jobView: newJobView(&j), EffectiveMaxRetries: 3, MaxRetriesFrom: "job", Backoff: "exp:2",
+				RetryOn: codes(nil), NoRetryOn: []int{2}, RetryLaterOn: codes(nil), Replays: 1, RetriedFrom: 4},
+			DeadJobID: 9,
+			Archived:  []archivedView{},
+		}, `{"job":{` + jobJSON[1:len(jobJSON)-1] + `,"effective_max_retries":3,"max_retries_from":"job","backoff":"exp:2",` +
+			`"retry_on":[],"no_retry_on":[2],"retry_later_on":[],"replays":1,"retried_from":4},"dead_job_id":9,"archived":[]}`},
+		{"archived", archivedView{Kind: "completed", ID: 1, JobID: 7, Queue: "default", Command: "echo", State: "completed",
+			Attempts: 1, CreatedAt: at, FinishedAt: at},
+			`{"kind":"completed","id":1,"job_id":7,"queue":"default","command":"echo","state":"completed","attempts":1,` +
+				`"created_at":"2026-10-01T12:00:00Z","finished_at":"2026-10-01T12:00:00Z","last_error":""}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.v)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+// newTestServer serves the agent API for a fresh database.
+func newTestServer(t *testing.T, token string, lease time.Duration) (*Server, *storage.SQLiteStore, *httptest.Server) {
+	t.Helper()
+	store, err := storage.OpenSQLiteStore(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	srv := NewServer(store, queue.NewQueue(store), token, lease)
+	hs := httptest.NewServer(srv.Handler())
+	t.Cleanup(hs.Close)
+	return srv, store, hs
+}
+
+func enqueue(t *testing.T, store storage.Store, cmds ...string) {
+	t.Helper()
+	q := queue.NewQueue(store)
+	for _, cmd := range cmds {
+		if _, err := q.Push(cmd, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLeaseCycle(t *testing.T) {
+	_, store, hs := newTestServer(t, "", time.Minute)
+	c := NewClient(hs.URL, "")
+	enqueue(t, store, "echo a", "echo b")
+
+	a, err := c.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Register()
+	if err != nil || b == a {
+		t.Fatalf("second worker id %d, %v; first was %d", b, err, a)
+	}
+
+	j, err := c.Pull(a)
+	if err != nil || j == nil || j.Command != "echo a" || j.WorkerID != a {
+		t.Fatalf("lease: %+v, %v", j, err)
+	}
+	// the lease alone marks the worker busy, before any heartbeat
+	ws, _ := store.ListWorkers()
+	if ws[0].ID != a || ws[0].State != "running" || ws[0].CurrentJobID != j.ID {
+		t.Errorf("worker after lease: %+v", ws[0])
+	}
+	if err := c.Heartbeat(a, "running", j.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Log(j, a, "a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ack(a, j); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetJob(j.ID); got.State != job.Completed {
+		t.Errorf("acked job is %s", got.State)
+	}
+	if logs, _ := store.ListJobLogs(j.ID); len(logs) != 1 || logs[0].WorkerID != a || logs[0].Output != "a\n" {
+		t.Errorf("logs %+v", logs)
+	}
+
+	k, err := c.Pull(b)
+	if err != nil || k == nil {
+		t.Fatalf("second lease: %+v, %v", k, err)
+	}
+	if err := c.Reject(b, k, 1, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetJob(k.ID); got.State != job.Failed || got.Attempts != 1 || got.LastError != "boom" {
+		t.Errorf("rejected job %+v", got)
+	}
+
+	if none, err := c.Pull(a); none != nil || err != nil {
+		t.Errorf("lease from an empty queue: %+v, %v", none, err)
+	}
+}
+
+func TestResultFromOtherWorker(t *testing.T) {
+	_, store, hs := newTestServer(t, "", time.Minute)
+	c := NewClient(hs.URL, "")
+	enqueue(t, store, "echo a")
+	owner, _ := c.Register()
+	other, _ := c.Register()
+
+	j, err := c.Pull(owner)
+	if err != nil || j == nil {
+		t.Fatalf("lease: %+v, %v", j, err)
+	}
+	if err := c.Ack(other, j); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("ack by another worker: %v, want 409", err)
+	}
+	if err := c.Reject(other, j, 1, "boom"); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("reject by another worker: %v, want 409", err)
+	}
+	if err := c.Ack(owner, j); err != nil {
+		t.Errorf("ack by the owner: %v", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	_, _, hs := newTestServer(t, "s3cret", time.Minute)
+
+	for _, token := range []string{"", "wrong"} {
+		if _, err := NewClient(hs.URL, token).Register(); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("token %q: %v, want 401", token, err)
+		}
+	}
+	if _, err := NewClient(hs.URL, "s3cret").Register(); err != nil {
+		t.Errorf("right token: %v", err)
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	srv, store, hs := newTestServer(t, "", 50*time.Millisecond)
+	c := NewClient(hs.URL, "")
+	enqueue(t, store, "sleep 60")
+
+	// the agent leases a job and dies before its first heartbeat
+	id, _ := c.Register()
+	j, err := c.Pull(id)
+	if err != nil || j == nil {
+		t.Fatalf("lease: %+v, %v", j, err)
+	}
+	if err := srv.ReapExpiredLeases(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetJob(j.ID); got.State != job.Running {
+		t.Fatalf("job reaped before its lease ran out: %s", got.State)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := srv.ReapExpiredLeases(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.GetJob(j.ID)
+	if got.State != job.Failed || got.Attempts != 1 || !strings.Contains(got.LastError, "lease expired") {
+		t.Errorf("expired job %+v", got)
+	}
+	if ws, _ := store.ListWorkers(); ws[0].State != "lost" {
+		t.Errorf("worker %+v, want lost", ws[0])
+	}
+
+	// the agent was only slow and reports back after all
+	if err := c.Ack(id, j); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("late ack: %v, want 409", err)
+	}
+	if got, _ := store.GetJob(j.ID); got.State != job.Failed {
+		t.Errorf("late ack changed the job to %s", got.State)
+	}
+}
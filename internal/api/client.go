@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// Client talks to a `queuectl serve` instance. It implements worker.Source
+// so remote agents run the same worker loop as local workers.
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// NewClient creates a client for the server at base, e.g. http://host:8080.
+func NewClient(base, token string) *Client {
+	return &Client{
+		base:  strings.TrimRight(base, "/"),
+		token: token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *Client) Register() (int, error) {
+	var resp registerResponse
+	if _, err := c.post("/api/v1/workers", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) Pull(workerID int) (*job.Job, error) {
+	var j job.Job
+	ok, err := c.post("/api/v1/lease", workerRequest{WorkerID: workerID}, &j)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (c *Client) Ack(workerID int, j *job.Job) error {
+	_, err := c.post(fmt.Sprintf("/api/v1/jobs/%d/ack", j.ID), workerRequest{WorkerID: workerID}, nil)
+	return err
+}
+
+func (c *Client) Reject(workerID int, j *job.Job, exitCode int, lastError string) error {
+	req := rejectRequest{WorkerID: workerID, ExitCode: exitCode, Error: lastError}
+	_, err := c.post(fmt.Sprintf("/api/v1/jobs/%d/reject", j.ID), req, nil)
+	return err
+}
+
+func (c *Client) Log(j *job.Job, workerID int, output string) error {
+	req := logRequest{Attempt: j.Attempts + 1, WorkerID: workerID, Output: output}
+	_, err := c.post(fmt.Sprintf("/api/v1/jobs/%d/logs", j.ID), req, nil)
+	return err
+}
+
+func (c *Client) Heartbeat(workerID int, state string, jobID int64) error {
+	req := heartbeatRequest{State: state, JobID: jobID}
+	_, err := c.post(fmt.Sprintf("/api/v1/workers/%d/heartbeat", workerID), req, nil)
+	return err
+}
+
+// post sends body as JSON and decodes the reply into out. It reports
+// false when the server answered 204 No Content.
+func (c *Client) post(path string, body, out any) (bool, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return false, err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, c.base+path, &buf)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return false, fmt.Errorf("%s %s: %s: %s", req.Method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if resp.StatusCode == http.StatusNoContent || out == nil {
+		return resp.StatusCode != http.StatusNoContent, nil
+	}
+	return true, json.NewDecoder(resp.Body).Decode(out)
+}
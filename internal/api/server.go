@@ -0,0 +1,256 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+// Server exposes the queue to remote agents over HTTP. It is the only
+// process that touches the database; agents lease jobs, heartbeat and
+// report results through it.
+type Server struct {
+	store storage.Store
+	q     *queue.Queue
+	token string
+	lease time.Duration
+}
+
+// NewServer creates an API server. An empty token disables authentication.
+// Jobs whose worker stops heartbeating for lease are reclaimed by Reap.
+func NewServer(store storage.Store, q *queue.Queue, token string, lease time.Duration) *Server {
+	return &Server{store: store, q: q, token: token, lease: lease}
+}
+
+type registerResponse struct {
+	ID int `json:"id"`
+}
+
+type heartbeatRequest struct {
+	State string `json:"state"`
+	JobID int64  `json:"job_id"`
+}
+
+type workerRequest struct {
+	WorkerID int `json:"worker_id"`
+}
+
+type rejectRequest struct {
+	WorkerID int    `json:"worker_id"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error"`
+}
+
+type logRequest struct {
+	Attempt  int    `json:"attempt"`
+	WorkerID int    `json:"worker_id"`
+	Output   string `json:"output"`
+}
+
+// Handler returns the HTTP routes of the agent API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/workers", s.auth(s.handleRegister))
+	mux.HandleFunc("POST /api/v1/workers/{id}/heartbeat", s.auth(s.handleHeartbeat))
+	mux.HandleFunc("POST /api/v1/lease", s.auth(s.handleLease))
+	mux.HandleFunc("POST /api/v1/jobs/{id}/ack", s.auth(s.handleAck))
+	mux.HandleFunc("POST /api/v1/jobs/{id}/reject", s.auth(s.handleReject))
+	mux.HandleFunc("POST /api/v1/jobs/{id}/logs", s.auth(s.handleLog))
+	return mux
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return RequireToken(s.token, next).ServeHTTP
+}
+
+// RequireToken rejects requests that do not carry token, either as a
+// bearer token or as the basic-auth password (for browsers). An empty
+// token lets everything through.
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, pass, basic := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer "+token && !(basic && pass == token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="queuectl"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	id, err := s.store.RegisterWorker()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	writeJSON(w, registerResponse{ID: id})
+}
+
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid worker id", http.StatusBadRequest)
+		return
+	}
+	var req heartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.UpdateWorkerStatus(id, req.State, req.JobID); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req workerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.WorkerID <= 0 {
+		http.Error(w, "invalid worker id", http.StatusBadRequest)
+		return
+	}
+	// the claim marks the worker running this job, so the lease runs
+	// from now even if the agent dies before its first heartbeat
+	j, err := s.as(req.WorkerID).Pull(req.WorkerID)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if j == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, j)
+}
+
+func (s *Server) handleAck(w http.ResponseWriter, r *http.Request) {
+	var req workerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	j, ok := s.runningJob(w, r, req.WorkerID)
+	if !ok {
+		return
+	}
+	if err := s.as(req.WorkerID).Ack(j); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	var req rejectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	j, ok := s.runningJob(w, r, req.WorkerID)
+	if !ok {
+		return
+	}
+	if err := s.as(req.WorkerID).Fail(j, req.ExitCode, req.Error); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	var req logRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.InsertJobLog(id, req.Attempt, req.WorkerID, req.Output); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runningJob loads the job named in the path and makes sure workerID
+// still holds its lease. Results for jobs whose lease expired, or that
+// another worker has claimed since, are refused.
+func (s *Server) runningJob(w http.ResponseWriter, r *http.Request, workerID int) (*job.Job, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return nil, false
+	}
+	j, err := s.store.GetJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		httpError(w, err)
+		return nil, false
+	}
+	if j.State != job.Running {
+		http.Error(w, "job is not running", http.StatusConflict)
+		return nil, false
+	}
+	if j.WorkerID != workerID {
+		http.Error(w, fmt.Sprintf("job is leased by worker %d", j.WorkerID), http.StatusConflict)
+		return nil, false
+	}
+	return j, true
+}
+
+// ReapExpiredLeases rejects jobs held by workers that stopped
+// heartbeating, so a crashed agent does not keep a job forever.
+func (s *Server) ReapExpiredLeases() error {
+	_, err := s.q.WithActor("server").Reclaim(s.lease)
+	return err
+}
+
+// Reap runs ReapExpiredLeases until the process exits.
+func (s *Server) Reap() {
+	t := time.NewTicker(s.lease / 2)
+	defer t.Stop()
+	for range t.C {
+		if err := s.ReapExpiredLeases(); err != nil {
+			slog.Error("reap leases", "err", err)
+		}
+	}
+}
+
+// as attributes queue operations to a remote worker in the events table.
+func (s *Server) as(workerID int) *queue.Queue {
+	return s.q.WithActor(fmt.Sprintf("agent:worker-%d", workerID))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,278 @@
+// Package archive exports completed jobs and DLQ entries, with their
+// attempt logs and events, to gzipped JSON Lines files so history can be
+// kept for audits after retention deletes it, and loads such files back
+// into the read-only archived_jobs table.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+// Record is one line of an archive file.
+type Record struct {
+	Kind        string    `json:"kind"` // "completed" or "dead"
+	ID          int64     `json:"id"`   // jobs.id, or dead_jobs.id for dead entries
+	JobID       int64     `json:"job_id"`
+	Queue       string    `json:"queue"`
+	Command     string    `json:"command"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	MaxRetries  int       `json:"max_retries"`
+	CreatedAt   time.Time `json:"created_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	LastError   string    `json:"last_error,omitempty"`
+	DeadReason  string    `json:"dead_reason,omitempty"`
+	Replays     int       `json:"replays,omitempty"`
+	Logs        []Attempt `json:"attempt_logs"`
+	Transitions []Event   `json:"events"`
+}
+
+// Attempt is the logged output of one attempt.
+type Attempt struct {
+	Attempt  int       `json:"attempt"`
+	WorkerID int       `json:"worker_id"`
+	Output   string    `json:"output"`
+	At       time.Time `json:"at"`
+}
+
+// Event is one state transition from the audit log.
+type Event struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Result counts what Export wrote and remembers it for Delete.
+type Result struct {
+	Completed int
+	Dead      int
+
+	completed []int64
+	dead      []storage.DeadJob
+}
+
+const pageSize = 500
+
+// Export writes every completed job last updated before `before` and
+// every DLQ entry that failed before it to w, one JSON record per line.
+func Export(db *sql.DB, w io.Writer, before time.Time) (*Result, error) {
+	enc := json.NewEncoder(w)
+	res := &Result{}
+
+	var after int64
+	for {
+		jobs, err := storage.CompletedJobsBefore(db, before, after, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range jobs {
+			r := Record{
+				Kind: string(job.Completed), ID: j.ID, JobID: j.ID, Queue: j.Queue, Command: j.Command,
+				State: string(j.State), Attempts: j.Attempts, MaxRetries: j.MaxRetries,
+				CreatedAt: j.CreatedAt, FinishedAt: j.UpdatedAt, LastError: j.LastError, Replays: j.Replays,
+			}
+			if err := history(db, &r); err != nil {
+				return nil, err
+			}
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+			res.completed = append(res.completed, j.ID)
+			after = j.ID
+		}
+		if len(jobs) < pageSize {
+			break
+		}
+	}
+
+	after = 0
+	for {
+		dead, err := storage.DeadJobsBefore(db, before, after, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dead {
+			r := Record{
+				Kind: string(job.Dead), ID: d.ID, JobID: d.OrigID.Int64, Queue: d.Queue, Command: d.Command,
+				State: string(job.Dead), Attempts: d.Attempts, MaxRetries: d.MaxRetries,
+				CreatedAt: d.CreatedAt, FinishedAt: d.FailedAt, LastError: d.LastError.String,
+				DeadReason: string(d.Reason), Replays: d.Replays,
+			}
+			if d.OrigID.Valid {
+				if err := history(db, &r); err != nil {
+					return nil, err
+				}
+			}
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+			res.dead = append(res.dead, d)
+			after = d.ID
+		}
+		if len(dead) < pageSize {
+			break
+		}
+	}
+
+	res.Completed, res.Dead = len(res.completed), len(res.dead)
+	return res, nil
+}
+
+// history attaches the attempt logs and events of r's job.
+func history(db *sql.DB, r *Record) error {
+	logs, err := storage.ListJobLogs(db, r.JobID)
+	if err != nil {
+		return err
+	}
+	r.Logs = make([]Attempt, len(logs))
+	for i, l := range logs {
+		r.Logs[i] = Attempt{Attempt: l.Attempt, WorkerID: l.WorkerID, Output: l.Output, At: l.CreatedAt}
+	}
+	events, err := storage.ListEvents(db, storage.EventFilter{JobID: r.JobID})
+	if err != nil {
+		return err
+	}
+	r.Transitions = make([]Event, len(events))
+	for i, e := range events {
+		r.Transitions[i] = Event{From: e.From, To: e.To, Actor: e.Actor, Reason: e.Reason, At: e.CreatedAt}
+	}
+	return nil
+}
+
+// Delete removes what Export wrote, and the logs of those jobs, in
+// batches, and returns how many rows it deleted. Call it only after the
+// archive file is safely closed. db should be the store's writer.
+func Delete(db *sql.DB, res *Result) (int, error) {
+	total := 0
+	for i := 0; i < len(res.completed); i += pageSize {
+		n, err := storage.DeleteCompletedJobs(db, res.completed[i:min(i+pageSize, len(res.completed))])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	for i := 0; i < len(res.dead); i += pageSize {
+		n, err := storage.DeleteDeadJobs(db, res.dead[i:min(i+pageSize, len(res.dead))])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Restore loads the records read from r into archived_jobs. Records that
+// were restored before are skipped. It returns how many rows it added.
+// db should be the store's writer.
+func Restore(db *sql.DB, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	added := 0
+	for line := 1; ; line++ {
+		var rec Record
+		if err := dec.Decode(&rec); err == io.EOF {
+			return added, nil
+		} else if err != nil {
+			return added, fmt.Errorf("record %d: %w", line, err)
+		}
+		raw, err := json.Marshal(rec)
+		if err != nil {
+			return added, err
+		}
+		ok, err := storage.InsertArchivedJob(db, storage.ArchivedJob{
+			Kind: rec.Kind, ID: rec.ID, JobID: rec.JobID, Queue: rec.Queue, Command: rec.Command,
+			State: rec.State, Attempts: rec.Attempts, CreatedAt: rec.CreatedAt, FinishedAt: rec.FinishedAt,
+			LastError: rec.LastError, Record: string(raw),
+		})
+		if err != nil {
+			return added, fmt.Errorf("record %d: %w", line, err)
+		}
+		if ok {
+			added++
+		}
+	}
+}
+
+// Create opens path for writing an archive, gzipping when it ends in
+// ".gz". Closing the returned writer flushes and syncs the file.
+func Create(path string) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWriter{f: f, buf: bufio.NewWriter(f)}
+	if strings.HasSuffix(path, ".gz") {
+		w.gz = gzip.NewWriter(w.buf)
+	}
+	return w, nil
+}
+
+type fileWriter struct {
+	f   *os.File
+	buf *bufio.Writer
+	gz  *gzip.Writer
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *fileWriter) Close() error {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Open opens an archive for reading, gunzipping when it ends in ".gz".
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipReader{Reader: gz, f: f}, nil
+}
+
+type gzipReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (r *gzipReader) Close() error {
+	r.Reader.Close()
+	return r.f.Close()
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+func TestExportDeleteRestore(t *testing.T) {
+	db, err := storage.OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	q := queue.NewQueue(storage.NewSQLiteStore(db))
+
+	finish := func(cmd string, ok bool) *job.Job {
+		t.Helper()
+		j := job.NewJob(cmd, 0)
+		if err := q.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+		j, err := q.Pull(1)
+		if err != nil || j == nil {
+			t.Fatalf("pull: %v", err)
+		}
+		if err := storage.InsertJobLog(db, j.ID, 1, 1, "output of "+cmd); err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			err = q.Ack(j)
+		} else {
+			err = q.Fail(j, 1, "boom")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return j
+	}
+	done := finish("echo done", true)
+	dead := finish("false", false)
+	pending := job.NewJob("echo later", 0)
+	if err := q.Enqueue(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	res, err := Export(db, &buf, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Completed != 1 || res.Dead != 1 {
+		t.Fatalf("exported %d completed and %d dead, want 1 and 1", res.Completed, res.Dead)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Fatalf("archive has %d lines, want 2:\n%s", lines, buf.String())
+	}
+	if !strings.Contains(buf.String(), "output of false") || !strings.Contains(buf.String(), `"to":"dead"`) {
+		t.Errorf("archive is missing logs or events:\n%s", buf.String())
+	}
+
+	n, err := Delete(db, res)
+	if err != nil || n != 2 {
+		t.Fatalf("deleted %d, %v; want 2", n, err)
+	}
+	if _, err := storage.GetJobByID(db, done.ID); err == nil {
+		t.Error("archived completed job still present")
+	}
+	if logs, _ := storage.ListJobLogs(db, dead.ID); len(logs) != 0 {
+		t.Error("archived dead job still has logs")
+	}
+	if _, err := storage.GetJobByID(db, pending.ID); err != nil {
+		t.Errorf("pending job was deleted: %v", err)
+	}
+
+	archived := buf.String()
+	for i := 0; i < 2; i++ { // restoring twice adds nothing the second time
+		added, err := Restore(db, strings.NewReader(archived))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 2 * (1 - i); added != want {
+			t.Errorf("restore %d added %d, want %d", i+1, added, want)
+		}
+	}
+	got, err := storage.ArchivedJobsByJobID(db, dead.ID)
+	if err != nil || len(got) != 1 || got[0].Kind != "dead" || got[0].LastError != "boom" {
+		t.Fatalf("archived dead job: %+v, %v", got, err)
+	}
+	if _, err := db.Exec(`DELETE FROM archived_jobs`); err == nil {
+		t.Error("archived_jobs accepted a delete")
+	}
+}
@@ -0,0 +1,222 @@
+// Package backoff computes how long a failed job waits before its next
+// attempt.
+package backoff
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Strategy returns the delay before retry number attempt (1-based). prev
+// is the delay used before the previous retry, or 0 for the first one.
+type Strategy interface {
+	Delay(attempt int, prev time.Duration) time.Duration
+}
+
+// Rand is the random source used for jitter. *rand.Rand satisfies it;
+// tests inject a deterministic one.
+type Rand interface {
+	Int64N(n int64) int64
+}
+
+type globalRand struct{}
+
+func (globalRand) Int64N(n int64) int64 { return rand.Int64N(n) }
+
+// DefaultRand is the process-wide, goroutine-safe random source.
+var DefaultRand Rand = globalRand{}
+
+// Jitter selects how randomness is applied to exponential delays.
+type Jitter string
+
+const (
+	NoJitter     Jitter = ""
+	FullJitter   Jitter = "full"
+	Decorrelated Jitter = "decorrelated"
+)
+
+// Fixed waits the same interval before every retry.
+type Fixed struct {
+	Interval time.Duration
+}
+
+func (f Fixed) Delay(int, time.Duration) time.Duration { return f.Interval }
+
+// Linear waits Step, 2*Step, 3*Step, ... capped at Max when set.
+type Linear struct {
+	Step time.Duration
+	Max  time.Duration
+}
+
+func (l Linear) Delay(attempt int, _ time.Duration) time.Duration {
+	return clamp(float64(attempt)*float64(l.Step), l.Max)
+}
+
+// Exponential waits Unit*Base^(attempt-1), capped at Max when set.
+// FullJitter picks uniformly in [0, delay]; Decorrelated picks in
+// [Unit, prev*Base] as in the AWS architecture blog.
+type Exponential struct {
+	Base   float64
+	Unit   time.Duration
+	Max    time.Duration
+	Jitter Jitter
+	Rand   Rand
+}
+
+func (e Exponential) Delay(attempt int, prev time.Duration) time.Duration {
+	switch e.Jitter {
+	case FullJitter:
+		return e.between(0, e.plain(attempt))
+	case Decorrelated:
+		hi := clamp(float64(max(prev, e.Unit))*e.Base, e.Max)
+		return e.between(e.Unit, hi)
+	default:
+		return e.plain(attempt)
+	}
+}
+
+func (e Exponential) plain(attempt int) time.Duration {
+	return clamp(float64(e.Unit)*math.Pow(e.Base, float64(attempt-1)), e.Max)
+}
+
+// between returns a random duration in [lo, hi].
+func (e Exponential) between(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	r := e.Rand
+	if r == nil {
+		r = DefaultRand
+	}
+	span := int64(hi - lo)
+	if span == math.MaxInt64 {
+		// span+1 would overflow; losing hi itself does not matter
+		return lo + time.Duration(r.Int64N(span))
+	}
+	return lo + time.Duration(r.Int64N(span+1))
+}
+
+// WithMax caps every delay of s at limit. A zero limit returns s unchanged.
+func WithMax(s Strategy, limit time.Duration) Strategy {
+	if limit <= 0 {
+		return s
+	}
+	return capped{s, limit}
+}
+
+type capped struct {
+	Strategy
+	limit time.Duration
+}
+
+func (c capped) Delay(attempt int, prev time.Duration) time.Duration {
+	return capAt(c.Strategy.Delay(attempt, prev), c.limit)
+}
+
+// clamp converts a delay computed in nanoseconds as a float to a
+// Duration, capping it at limit (or the largest Duration when limit is
+// unset) before the conversion so huge attempts cannot overflow.
+func clamp(ns float64, limit time.Duration) time.Duration {
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	if math.IsNaN(ns) || ns <= 0 {
+		return 0
+	}
+	if ns >= float64(limit) {
+		return limit
+	}
+	return time.Duration(ns)
+}
+
+func capAt(d, limit time.Duration) time.Duration {
+	if limit > 0 && d > limit {
+		return limit
+	}
+	return d
+}
+
+// Parse reads a strategy spec:
+//
+//	fixed:30s
+//	linear:10s[,max=5m]
+//	exp:2[,unit=1s][,max=10m][,jitter=full|decorrelated]
+//
+// rnd is used for jitter and may be nil for the default source.
+func Parse(spec string, rnd Rand) (Strategy, error) {
+	kind, rest, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	parts := strings.Split(rest, ",")
+	arg := strings.TrimSpace(parts[0])
+
+	opts := map[string]string{}
+	for _, p := range parts[1:] {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok {
+			return nil, fmt.Errorf("backoff %q: option %q is not key=value", spec, p)
+		}
+		opts[k] = v
+	}
+	maxDelay, err := durationOpt(opts, "max", 0)
+	if err != nil {
+		return nil, fmt.Errorf("backoff %q: %w", spec, err)
+	}
+
+	allowed := map[string][]string{
+		"fixed":  {"max"},
+		"linear": {"max"},
+		"exp":    {"unit", "max", "jitter"},
+	}
+	for k := range opts {
+		if known, ok := allowed[kind]; ok && !slices.Contains(known, k) {
+			return nil, fmt.Errorf("backoff %q: unknown option %q for %s", spec, k, kind)
+		}
+	}
+
+	switch kind {
+	case "fixed":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, fmt.Errorf("backoff %q: %w", spec, err)
+		}
+		return WithMax(Fixed{Interval: d}, maxDelay), nil
+	case "linear":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, fmt.Errorf("backoff %q: %w", spec, err)
+		}
+		return Linear{Step: d, Max: maxDelay}, nil
+	case "exp":
+		base, err := strconv.ParseFloat(arg, 64)
+		if err != nil || base < 1 {
+			return nil, fmt.Errorf("backoff %q: base must be a number >= 1", spec)
+		}
+		unit, err := durationOpt(opts, "unit", time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("backoff %q: %w", spec, err)
+		}
+		jitter := Jitter(opts["jitter"])
+		if jitter != NoJitter && jitter != FullJitter && jitter != Decorrelated {
+			return nil, fmt.Errorf("backoff %q: unknown jitter %q", spec, jitter)
+		}
+		return Exponential{Base: base, Unit: unit, Max: maxDelay, Jitter: jitter, Rand: rnd}, nil
+	default:
+		return nil, fmt.Errorf("backoff %q: unknown strategy %q (want fixed, linear or exp)", spec, kind)
+	}
+}
+
+func durationOpt(opts map[string]string, key string, def time.Duration) (time.Duration, error) {
+	v, ok := opts[key]
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
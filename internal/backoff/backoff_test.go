@@ -0,0 +1,96 @@
+package backoff
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeRand returns a fixed fraction of n so jittered delays are predictable.
+type fakeRand struct{ frac float64 }
+
+func (f fakeRand) Int64N(n int64) int64 {
+	if f.frac >= 1 {
+		return n - 1
+	}
+	return int64(float64(n-1) * f.frac)
+}
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		spec    string
+		rand    Rand
+		attempt int
+		prev    time.Duration
+		want    time.Duration
+	}{
+		{"fixed:30s", nil, 5, 0, 30 * time.Second},
+		{"fixed:30s,max=10s", nil, 1, 0, 10 * time.Second},
+		{"linear:10s", nil, 3, 0, 30 * time.Second},
+		{"linear:10s,max=25s", nil, 3, 0, 25 * time.Second},
+		{"linear:1h", nil, 1 << 40, 0, math.MaxInt64},
+		{"exp:2", nil, 1, 0, time.Second},
+		{"exp:2", nil, 4, 0, 8 * time.Second},
+		{"exp:3,unit=100ms", nil, 3, 0, 900 * time.Millisecond},
+		{"exp:2,max=10m", nil, 20, 0, 10 * time.Minute},
+		{"exp:2,jitter=full", fakeRand{0}, 4, 0, 0},
+		{"exp:2,jitter=full", fakeRand{1}, 4, 0, 8 * time.Second},
+		{"exp:2,jitter=full", fakeRand{0.5}, 4, 0, 4 * time.Second},
+		{"exp:2,jitter=full,max=2s", fakeRand{1}, 10, 0, 2 * time.Second},
+		{"exp:3,jitter=decorrelated", fakeRand{0}, 1, 0, time.Second},
+		{"exp:3,jitter=decorrelated", fakeRand{1}, 2, 4 * time.Second, 12 * time.Second},
+		{"exp:3,jitter=decorrelated,max=5s", fakeRand{1}, 2, 4 * time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec, tt.rand)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := s.Delay(tt.attempt, tt.prev); got != tt.want {
+			t.Errorf("%s attempt=%d prev=%s: got %s, want %s", tt.spec, tt.attempt, tt.prev, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "exp", "exp:0.5", "exp:2,jitter=some", "fixed:soon", "linear:1s,max", "poly:2",
+		"exp:2,foo=bar", "fixed:1s,unit=1s", "linear:1s,jitter=full"} {
+		if _, err := Parse(spec, nil); err == nil {
+			t.Errorf("Parse(%q): expected error", spec)
+		}
+	}
+}
+
+func TestWithMax(t *testing.T) {
+	s := WithMax(Exponential{Base: 2, Unit: time.Second}, time.Minute)
+	if got := s.Delay(30, 0); got != time.Minute {
+		t.Errorf("got %s, want 1m", got)
+	}
+}
+
+func TestHugeAttempts(t *testing.T) {
+	tests := []struct {
+		spec string
+		rand Rand
+		prev time.Duration
+		want time.Duration
+	}{
+		{"exp:2", nil, 0, math.MaxInt64},
+		{"exp:2,max=1h", nil, 0, time.Hour},
+		{"exp:2,jitter=full", fakeRand{1}, 0, math.MaxInt64 - 1},
+		{"exp:2,jitter=full,max=1h", fakeRand{1}, 0, time.Hour},
+		{"exp:2,jitter=decorrelated", fakeRand{1}, math.MaxInt64, math.MaxInt64},
+		{"exp:2,jitter=decorrelated,max=1h", fakeRand{1}, math.MaxInt64, time.Hour},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec, tt.rand)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		for _, attempt := range []int{64, 1000} {
+			if got := s.Delay(attempt, tt.prev); got != tt.want {
+				t.Errorf("%s attempt=%d: got %s, want %s", tt.spec, attempt, got, tt.want)
+			}
+		}
+	}
+}
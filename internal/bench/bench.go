@@ -0,0 +1,226 @@
+// Package bench generates synthetic load against a throwaway database
+// to size deployments and catch throughput regressions. It drives the
+// same code as production: Queue.Push to enqueue and worker.Run, which
+// claims through Queue.Pull, to execute. worker.Run is the loop inside
+// worker.Start; bench calls it directly because Start owns the process
+// (signals, the shared stop file, os.Exit) and a benchmark must not.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+	"queuectl/internal/wakeup"
+	"queuectl/internal/worker"
+)
+
+// Options describes one run.
+type Options struct {
+	Jobs     int           // jobs to enqueue
+	Workers  int           // worker goroutines
+	Prefetch int           // see worker.LocalSource.SetPrefetch
+	JobTime  time.Duration // how long each job sleeps
+	FailRate float64       // fraction of jobs that exit non-zero, 0..1
+	Rate     float64       // enqueues per second; 0 enqueues as fast as possible
+	Dir      string        // where to create the temporary database; "" for the system default
+}
+
+// Report is what a run measured.
+type Report struct {
+	Jobs, Failed int
+	Elapsed      time.Duration // first enqueue to last job finished
+	EnqueueRate  float64       // jobs/s while enqueuing
+	CompleteRate float64       // finished jobs/s over Elapsed
+	ClaimP50     time.Duration // enqueue to claim
+	ClaimP99     time.Duration
+	LockErrors   int // SQLITE_BUSY or SQLITE_LOCKED seen by any call
+}
+
+// Run enqueues opts.Jobs jobs while opts.Workers workers execute them
+// and returns once every job completed or went to the DLQ. Failing jobs
+// have no retries, so each job runs once.
+func Run(opts Options) (*Report, error) {
+	if opts.Jobs <= 0 || opts.Workers <= 0 {
+		return nil, fmt.Errorf("jobs and workers must be positive")
+	}
+	if opts.FailRate < 0 || opts.FailRate > 1 {
+		return nil, fmt.Errorf("fail rate %g is not between 0 and 1", opts.FailRate)
+	}
+	dir, err := os.MkdirTemp(opts.Dir, "queuectl-bench-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.OpenSQLiteStore(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	sig := wakeup.New("")
+	q := queue.NewQueue(store).WithActor("bench")
+	q.OnEnqueue(func(int64) { sig.Notify() })
+
+	src := &source{
+		LocalSource: worker.NewLocalSource(store, q, sig),
+		enqueued:    make(map[int64]time.Time, opts.Jobs),
+		claimed:     make(map[int64]time.Time, opts.Jobs),
+		finished:    make(chan struct{}),
+		want:        opts.Jobs,
+	}
+	src.SetPrefetch(opts.Prefetch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ran := make(chan error, 1)
+	go func() { ran <- worker.Run(ctx, src, opts.Workers) }()
+
+	start := time.Now()
+	r := &Report{Jobs: opts.Jobs}
+	for i := 0; i < opts.Jobs; i++ {
+		if opts.Rate > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(i) / opts.Rate * float64(time.Second)))))
+		}
+		// spread failures evenly so every run fails the same jobs
+		fail := int(float64(i+1)*opts.FailRate) > int(float64(i)*opts.FailRate)
+		if fail {
+			r.Failed++
+		}
+		pushed := time.Now()
+		j, err := q.Push(command(opts.JobTime, fail), 0)
+		if err != nil {
+			src.lockError(err)
+			cancel()
+			<-ran
+			return nil, fmt.Errorf("enqueue job %d: %w", i+1, err)
+		}
+		src.mu.Lock()
+		src.enqueued[j.ID] = pushed
+		src.mu.Unlock()
+	}
+	r.EnqueueRate = float64(opts.Jobs) / time.Since(start).Seconds()
+
+	select {
+	case <-src.finished:
+	case err := <-ran:
+		return nil, fmt.Errorf("workers stopped early: %v", err)
+	}
+	r.Elapsed = time.Since(start)
+	cancel()
+	if err := <-ran; err != nil {
+		return nil, err
+	}
+
+	r.CompleteRate = float64(opts.Jobs) / r.Elapsed.Seconds()
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	var latencies []time.Duration
+	for id, t := range src.claimed {
+		latencies = append(latencies, t.Sub(src.enqueued[id]))
+	}
+	r.ClaimP50 = percentile(latencies, 50)
+	r.ClaimP99 = percentile(latencies, 99)
+	r.LockErrors = src.lockErrors
+	return r, nil
+}
+
+// command is a shell command that takes d and exits non-zero when fail.
+func command(d time.Duration, fail bool) string {
+	cmd := "true"
+	if d > 0 {
+		cmd = fmt.Sprintf("sleep %g", d.Seconds())
+	}
+	if fail {
+		cmd += "; exit 1"
+	}
+	return cmd
+}
+
+// percentile returns the p-th percentile of ds, sorting it in place.
+func percentile(ds []time.Duration, p int) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(a, b int) bool { return ds[a] < ds[b] })
+	i := len(ds) * p / 100
+	if i >= len(ds) {
+		i = len(ds) - 1
+	}
+	return ds[i]
+}
+
+// source wraps the workers' LocalSource to time claims, count finished
+// jobs and spot lock contention.
+type source struct {
+	*worker.LocalSource
+
+	mu         sync.Mutex
+	enqueued   map[int64]time.Time // before Push, by job id
+	claimed    map[int64]time.Time
+	lockErrors int
+	done, want int
+	finished   chan struct{}
+}
+
+func (s *source) lockError(err error) {
+	if storage.IsBusy(err) {
+		s.mu.Lock()
+		s.lockErrors++
+		s.mu.Unlock()
+	}
+}
+
+func (s *source) Pull(workerID int) (*job.Job, error) {
+	j, err := s.LocalSource.Pull(workerID)
+	s.lockError(err)
+	if j != nil {
+		claimed := time.Now()
+		s.mu.Lock()
+		s.claimed[j.ID] = claimed
+		s.mu.Unlock()
+	}
+	return j, err
+}
+
+func (s *source) Ack(workerID int, j *job.Job) error {
+	err := s.LocalSource.Ack(workerID, j)
+	s.lockError(err)
+	s.finish()
+	return err
+}
+
+func (s *source) Reject(workerID int, j *job.Job, exitCode int, lastError string) error {
+	err := s.LocalSource.Reject(workerID, j, exitCode, lastError)
+	s.lockError(err)
+	s.finish()
+	return err
+}
+
+func (s *source) Log(j *job.Job, workerID int, output string) error {
+	err := s.LocalSource.Log(j, workerID, output)
+	s.lockError(err)
+	return err
+}
+
+func (s *source) Heartbeat(workerID int, state string, jobID int64) error {
+	err := s.LocalSource.Heartbeat(workerID, state, jobID)
+	s.lockError(err)
+	return err
+}
+
+func (s *source) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done++
+	if s.done == s.want {
+		close(s.finished)
+	}
+}
@@ -0,0 +1,37 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	for _, prefetch := range []int{0, 4} {
+		r, err := Run(Options{Jobs: 40, Workers: 3, Prefetch: prefetch, FailRate: 0.25, Dir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("prefetch %d: %v", prefetch, err)
+		}
+		if r.Jobs != 40 || r.Failed != 10 {
+			t.Errorf("prefetch %d: %d jobs, %d failed; want 40 and 10", prefetch, r.Jobs, r.Failed)
+		}
+		if r.EnqueueRate <= 0 || r.CompleteRate <= 0 || r.ClaimP50 <= 0 || r.ClaimP99 < r.ClaimP50 {
+			t.Errorf("prefetch %d: implausible report %+v", prefetch, r)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var ds []time.Duration
+	for i := 100; i >= 1; i-- {
+		ds = append(ds, time.Duration(i)*time.Millisecond)
+	}
+	if p := percentile(ds, 50); p != 51*time.Millisecond {
+		t.Errorf("p50 = %s", p)
+	}
+	if p := percentile(ds, 99); p != 100*time.Millisecond {
+		t.Errorf("p99 = %s", p)
+	}
+	if p := percentile(nil, 99); p != 0 {
+		t.Errorf("p99 of nothing = %s", p)
+	}
+}
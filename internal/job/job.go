@@ -1,7 +1,12 @@
 package job
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type JobState string
@@ -14,16 +19,36 @@ const (
     Dead      JobState = "dead"
 )
 
+// DefaultQueue is the queue jobs go to when none is given.
+const DefaultQueue = "default"
+
+const (
+    // InheritRetries as a job's MaxRetries means "use the queue or
+    // global default".
+    InheritRetries = -1
+    // DefaultMaxRetries applies when neither the job, its queue nor the
+    // max_retries config set a limit.
+    DefaultMaxRetries = 3
+)
+
 type Job struct {
     ID         int64
     Command    string
     State      JobState
     Attempts   int
-    MaxRetries int
+    MaxRetries int // InheritRetries to use the queue or global default
     CreatedAt  time.Time
     UpdatedAt  time.Time
     ScheduledAt time.Time
     LastError string
+    Queue     string
+    Backoff    string        // retry strategy spec; empty uses the global config
+    RetryDelay time.Duration // delay before the current retry, 0 if none
+    Retry      RetryPolicy
+    RetriedFrom int64 // DLQ entry this job was last requeued from, 0 if never
+    Replays     int   // times the job has been requeued from the DLQ
+    Tags        []string // labels for finding the job with list --tag
+    WorkerID    int      // worker holding the job while it runs, 0 otherwise
 
 }
 
@@ -38,6 +63,7 @@ func NewJob(command string, maxRetries int) *Job {
         CreatedAt:  now,
         UpdatedAt:  now,
         ScheduledAt: now,
+        Queue:      DefaultQueue,
     }
 }
 
@@ -51,6 +77,15 @@ func (j *Job) UpdateState(newState JobState) error {
 	return nil
 }
 
+// ClaimedFrom is the state a claimed job was waiting in: jobs that failed
+// before waited in failed for their retry delay.
+func (j *Job) ClaimedFrom() JobState {
+	if j.Attempts > 0 || j.LastError != "" {
+		return Failed
+	}
+	return Pending
+}
+
 // invalid transition error type
 type ErrInvalidTransition struct {
 	From JobState
@@ -77,3 +112,123 @@ func isValidTransition(from, to JobState) bool {
     }
     return false
 }
+
+
+// Outcome says what to do with a failed attempt.
+type Outcome int
+
+const (
+    Retry      Outcome = iota // count the attempt and retry with backoff
+    Permanent                 // give up and move to the DLQ
+    RetryLater                // retry with backoff without counting the attempt
+)
+
+// RetryPolicy classifies failures by the command's exit code.
+type RetryPolicy struct {
+    RetryOn      []int // when set, only these codes are retried
+    NoRetryOn    []int // these codes are permanent failures
+    RetryLaterOn []int // these codes retry without using up an attempt
+}
+
+// Classify returns the outcome for an exit code. Negative codes mean the
+// command could not be run to completion (e.g. killed) and are retried.
+func (p RetryPolicy) Classify(exitCode int) Outcome {
+    if exitCode < 0 {
+        return Retry
+    }
+    switch {
+    case contains(p.RetryLaterOn, exitCode):
+        return RetryLater
+    case contains(p.NoRetryOn, exitCode):
+        return Permanent
+    case len(p.RetryOn) > 0 && !contains(p.RetryOn, exitCode):
+        return Permanent
+    }
+    return Retry
+}
+
+func contains(codes []int, c int) bool {
+    for _, x := range codes {
+        if x == c {
+            return true
+        }
+    }
+    return false
+}
+
+// DeadReason classifies why a job ended up in the DLQ.
+type DeadReason string
+
+const (
+    ReasonMaxRetries     DeadReason = "max-retries"     // retries used up
+    ReasonTimeout        DeadReason = "timeout"         // last attempt's lease or deadline expired
+    ReasonPermanent      DeadReason = "permanent"       // exit code marked as not retryable
+    ReasonInvalidPayload DeadReason = "invalid-payload" // the command could not be run at all
+)
+
+// ExhaustedReason classifies a job that ran out of retries by the exit
+// code of its last attempt: sh exits 126 or 127 when the command is not
+// executable or not found, which no amount of retrying will fix.
+func ExhaustedReason(exitCode int) DeadReason {
+    if exitCode == 126 || exitCode == 127 {
+        return ReasonInvalidPayload
+    }
+    return ReasonMaxRetries
+}
+
+// ParseExitCodes reads a comma separated list such as "75,111".
+func ParseExitCodes(s string) ([]int, error) {
+    var out []int
+    for _, f := range strings.Split(s, ",") {
+        f = strings.TrimSpace(f)
+        if f == "" {
+            continue
+        }
+        c, err := strconv.Atoi(f)
+        if err != nil || c < 0 || c > 255 {
+            return nil, fmt.Errorf("invalid exit code %q", f)
+        }
+        out = append(out, c)
+    }
+    return out, nil
+}
+
+// FormatExitCodes is the inverse of ParseExitCodes.
+func FormatExitCodes(codes []int) string {
+    parts := make([]string, len(codes))
+    for i, c := range codes {
+        parts[i] = strconv.Itoa(c)
+    }
+    return strings.Join(parts, ",")
+}
+
+// ParseTags reads a comma separated list of tags such as "nightly,db".
+// Tags are trimmed and deduplicated, and must pass CheckTag.
+func ParseTags(s string) ([]string, error) {
+    var out []string
+    for _, f := range strings.Split(s, ",") {
+        f = strings.TrimSpace(f)
+        if f == "" || slices.Contains(out, f) {
+            continue
+        }
+        if err := CheckTag(f); err != nil {
+            return nil, err
+        }
+        out = append(out, f)
+    }
+    return out, nil
+}
+
+// CheckTag rejects a tag containing a comma, which separates stored tags,
+// or whitespace.
+func CheckTag(tag string) error {
+    if strings.ContainsRune(tag, ',') || strings.ContainsFunc(tag, unicode.IsSpace) {
+        return fmt.Errorf("invalid tag %q", tag)
+    }
+    return nil
+}
+
+// FormatTags is the inverse of ParseTags.
+func FormatTags(tags []string) string {
+    return strings.Join(tags, ",")
+}
@@ -21,3 +21,41 @@ func TestJobTransitions(t *testing.T) {
 		t.Fatalf("expected error but got none")
 	}
 }
+
+func TestRetryPolicyClassify(t *testing.T) {
+	p := RetryPolicy{RetryOn: []int{75, 111}, NoRetryOn: []int{111}, RetryLaterOn: []int{99}}
+	cases := map[int]Outcome{
+		75:  Retry,
+		111: Permanent, // no-retry wins over retry-on
+		99:  RetryLater,
+		1:   Permanent, // not in retry-on
+		-1:  Retry,     // killed or never started
+	}
+	for code, want := range cases {
+		if got := p.Classify(code); got != want {
+			t.Errorf("Classify(%d) = %v, want %v", code, got, want)
+		}
+	}
+
+	if got := (RetryPolicy{}).Classify(2); got != Retry {
+		t.Errorf("empty policy should retry everything, got %v", got)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags(" nightly, db,,nightly ")
+	if err != nil || FormatTags(tags) != "nightly,db" {
+		t.Errorf("ParseTags = %q, %v", tags, err)
+	}
+	if tags, err := ParseTags(""); err != nil || tags != nil {
+		t.Errorf("ParseTags(\"\") = %q, %v", tags, err)
+	}
+	if _, err := ParseTags("a b"); err == nil {
+		t.Error("tag with a space accepted")
+	}
+	for _, tag := range []string{"a,b", "a b", "a\tb"} {
+		if err := CheckTag(tag); err == nil {
+			t.Errorf("CheckTag(%q) accepted", tag)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package logging configures the process-wide slog logger and keeps its
+// level in sync with the log_level config key.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"queuectl/internal/storage"
+)
+
+var level = new(slog.LevelVar)
+
+// Setup installs the default logger writing text or JSON records to w.
+func Setup(format string, w io.Writer) error {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(w, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, opts)))
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	return nil
+}
+
+// SetLevel changes the level of the default logger, e.g. "debug".
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return fmt.Errorf("invalid log level %q", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// LoadLevel applies the log_level config value, if set.
+func LoadLevel(store storage.Store) error {
+	name, err := store.ConfigGet("log_level")
+	if err != nil || name == "" {
+		return err
+	}
+	return SetLevel(name)
+}
+
+// Follow re-reads log_level every interval so `config set log_level debug`
+// takes effect on running workers without a restart.
+func Follow(store storage.Store, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	prev := level.Level()
+	for range t.C {
+		if err := LoadLevel(store); err != nil {
+			slog.Warn("reload log level", "err", err)
+			continue
+		}
+		if l := level.Level(); l != prev {
+			slog.Info("log level changed", "level", l.String())
+			prev = l
+		}
+	}
+}
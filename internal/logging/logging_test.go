@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"queuectl/internal/storage"
+)
+
+func TestSetLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		want slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{" warn ", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"warn+2", slog.LevelWarn + 2},
+	}
+	for _, tt := range tests {
+		if err := SetLevel(tt.name); err != nil {
+			t.Errorf("SetLevel(%q): %v", tt.name, err)
+			continue
+		}
+		if got := level.Level(); got != tt.want {
+			t.Errorf("SetLevel(%q): level %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	level.Set(slog.LevelInfo)
+	for _, name := range []string{"", "loud", "debug!"} {
+		if err := SetLevel(name); err == nil {
+			t.Errorf("SetLevel(%q): expected error", name)
+		}
+	}
+	if got := level.Level(); got != slog.LevelInfo {
+		t.Errorf("a rejected level changed the level to %s", got)
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup("json", &buf); err != nil {
+		t.Fatal(err)
+	}
+	defer Setup("text", os.Stderr)
+	level.Set(slog.LevelInfo)
+
+	slog.With("job_id", int64(7), "worker_id", 2, "attempt", 3, "duration", 1500*time.Millisecond).
+		Info("job completed")
+	slog.Debug("hidden")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("want one JSON record, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":     "INFO",
+		"msg":       "job completed",
+		"job_id":    float64(7),
+		"worker_id": float64(2),
+		"attempt":   float64(3),
+		"duration":  float64(1500 * time.Millisecond),
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v, want %v", k, rec[k], v)
+		}
+	}
+	if _, ok := rec["time"]; !ok {
+		t.Error("record has no time")
+	}
+
+	if err := Setup("xml", &buf); err == nil {
+		t.Error("Setup accepted an unknown format")
+	}
+}
+
+func TestLoadLevel(t *testing.T) {
+	store := storage.NewMemoryStore()
+	level.Set(slog.LevelWarn)
+
+	// unset keeps the current level
+	if err := LoadLevel(store); err != nil || level.Level() != slog.LevelWarn {
+		t.Fatalf("unset: level %s, %v; want WARN", level.Level(), err)
+	}
+	for _, tt := range []struct {
+		value string
+		want  slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"error", slog.LevelError},
+	} {
+		if err := store.ConfigSet("log_level", tt.value); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadLevel(store); err != nil || level.Level() != tt.want {
+			t.Errorf("log_level=%s: level %s, %v", tt.value, level.Level(), err)
+		}
+	}
+	if err := store.ConfigSet("log_level", "chatty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadLevel(store); err == nil || level.Level() != slog.LevelError {
+		t.Errorf("invalid log_level: level %s, %v; want an error and ERROR kept", level.Level(), err)
+	}
+}
+
+// TestFollow runs last: Follow has no stop and keeps polling its store.
+func TestFollow(t *testing.T) {
+	if err := Setup("text", &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	defer Setup("text", os.Stderr)
+	store := storage.NewMemoryStore()
+	level.Set(slog.LevelInfo)
+	go Follow(store, 5*time.Millisecond)
+
+	if err := store.ConfigSet("log_level", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for level.Level() != slog.LevelDebug {
+		if time.Now().After(deadline) {
+			t.Fatalf("level still %s after config change", level.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,256 @@
+// Package metrics keeps process-wide counters, gauges and histograms and
+// renders them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sample is one labelled value reported by a GaugeFunc.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry is a set of metrics rendered together.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// Default is the registry served by Handler.
+var Default = &Registry{}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText renders every metric in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	ms := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Handler serves the default registry on /metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Default.WriteText(w)
+	})
+}
+
+// vec holds one value per distinct label combination.
+type vec struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{name: name, help: help, kind: kind, labels: labels, values: map[string]float64{}}
+}
+
+func (v *vec) add(delta float64, lvs []string) {
+	v.mu.Lock()
+	v.values[strings.Join(lvs, "\xff")] += delta
+	v.mu.Unlock()
+}
+
+func (v *vec) set(val float64, lvs []string) {
+	v.mu.Lock()
+	v.values[strings.Join(lvs, "\xff")] = val
+	v.mu.Unlock()
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	samples := make([]Sample, 0, len(v.values))
+	for k, val := range v.values {
+		samples = append(samples, Sample{Labels: splitKey(k, len(v.labels)), Value: val})
+	}
+	v.mu.Unlock()
+	writeFamily(w, v.name, v.help, v.kind, v.labels, samples)
+}
+
+// Counter is a monotonically increasing value, optionally labelled.
+type Counter struct{ v *vec }
+
+// NewCounter registers a counter on the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{v: newVec(name, help, "counter", labels)}
+	Default.add(c.v)
+	return c
+}
+
+// Inc adds one to the series identified by label values.
+func (c *Counter) Inc(labelValues ...string) { c.v.add(1, labelValues) }
+
+// Gauge is a value that can go up and down, optionally labelled.
+type Gauge struct{ v *vec }
+
+// NewGauge registers a gauge on the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{v: newVec(name, help, "gauge", labels)}
+	Default.add(g.v)
+	return g
+}
+
+// Set replaces the value of the series identified by label values.
+func (g *Gauge) Set(val float64, labelValues ...string) { g.v.set(val, labelValues) }
+
+// Add adds delta, which may be negative, to the series identified by
+// label values.
+func (g *Gauge) Add(delta float64, labelValues ...string) { g.v.add(delta, labelValues) }
+
+// funcMetric computes its samples at scrape time, e.g. from the database.
+type funcMetric struct {
+	name, help, kind string
+	labels           []string
+	fn               func() ([]Sample, error)
+}
+
+// NewGaugeFunc registers a gauge whose samples come from fn.
+func NewGaugeFunc(name, help string, labels []string, fn func() ([]Sample, error)) {
+	Default.add(&funcMetric{name: name, help: help, kind: "gauge", labels: labels, fn: fn})
+}
+
+// NewCounterFunc registers a counter whose samples come from fn. fn must
+// only ever report growing values.
+func NewCounterFunc(name, help string, labels []string, fn func() ([]Sample, error)) {
+	Default.add(&funcMetric{name: name, help: help, kind: "counter", labels: labels, fn: fn})
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	samples, err := m.fn()
+	if err != nil {
+		fmt.Fprintf(w, "# error collecting %s: %v\n", m.name, err)
+		return
+	}
+	writeFamily(w, m.name, m.help, m.kind, m.labels, samples)
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histSeries
+}
+
+type histSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the given upper bounds.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histSeries{}}
+	Default.add(h)
+	return h
+}
+
+// Observe records one value for the series identified by label values.
+func (h *Histogram) Observe(val float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if val <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += val
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		lvs := splitKey(k, len(h.labels))
+		names := append(append([]string(nil), h.labels...), "le")
+		bucket := func(le string) string {
+			return labelString(names, append(append([]string(nil), lvs...), le))
+		}
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, bucket(formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, bucket("+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, lvs), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, lvs), s.count)
+	}
+}
+
+func writeFamily(w io.Writer, name, help, kind string, labels []string, samples []Sample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Labels, "\xff") < strings.Join(samples[j].Labels, "\xff")
+	})
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", name, labelString(labels, s.Labels), formatFloat(s.Value))
+	}
+}
+
+func labelString(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts[i] = n + "=" + strconv.Quote(v)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func splitKey(key string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.SplitN(key, "\xff", n)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
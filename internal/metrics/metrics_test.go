@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	c := NewCounter("test_events_total", "Events.", "kind")
+	c.Inc("a")
+	c.Inc("a")
+	h := NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "queue")
+	h.Observe(0.05, "q")
+	h.Observe(0.5, "q")
+
+	var b strings.Builder
+	Default.WriteText(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_events_total counter\n",
+		`test_events_total{kind="a"} 2` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{queue="q",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{queue="q",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{queue="q",le="+Inf"} 2` + "\n",
+		`test_latency_seconds_sum{queue="q"} 0.55` + "\n",
+		`test_latency_seconds_count{queue="q"} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
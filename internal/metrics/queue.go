@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"queuectl/internal/job"
+)
+
+// durationBuckets covers sub-second jobs up to multi-minute batch work.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+var (
+	JobsCompleted = NewCounter("queuectl_jobs_completed_total", "Jobs acknowledged as completed by this process.", "queue")
+	JobsFailed    = NewCounter("queuectl_jobs_failed_total", "Job attempts rejected and scheduled for retry by this process.", "queue")
+	JobsDead      = NewCounter("queuectl_jobs_dead_total", "Jobs moved to the dead letter queue by this process.", "queue")
+
+	JobDuration  = NewHistogram("queuectl_job_duration_seconds", "Wall time spent running a job attempt.", durationBuckets, "queue")
+	ClaimLatency = NewHistogram("queuectl_job_claim_latency_seconds", "Time from a job's scheduled time until a worker started it.", durationBuckets, "queue")
+
+	Workers = NewGauge("queuectl_workers", "Worker goroutines in this process by state.", "state")
+)
+
+// Stats is the part of a store the storage gauges read. SQLiteStore and
+// PostgresStore implement it.
+type Stats interface {
+	CountJobsByQueue() (map[string]map[job.JobState]int, error)
+	CountJobs(state job.JobState) (int, error)
+	// JobsEnqueued counts every job ever inserted, including deleted ones.
+	JobsEnqueued() (int64, error)
+}
+
+// RegisterStorage adds gauges that are read from the database at scrape
+// time, so they are correct no matter which process changed the data.
+func RegisterStorage(s Stats) {
+	NewGaugeFunc("queuectl_jobs", "Jobs per queue and state.", []string{"queue", "state"}, func() ([]Sample, error) {
+		byQueue, err := s.CountJobsByQueue()
+		if err != nil {
+			return nil, err
+		}
+		var out []Sample
+		for q, counts := range byQueue {
+			for s, n := range counts {
+				out = append(out, Sample{Labels: []string{q, string(s)}, Value: float64(n)})
+			}
+		}
+		return out, nil
+	})
+	NewGaugeFunc("queuectl_dlq_size", "Entries in the dead letter queue.", nil, func() ([]Sample, error) {
+		n, err := s.CountJobs(job.Dead)
+		return []Sample{{Value: float64(n)}}, err
+	})
+	NewCounterFunc("queuectl_jobs_enqueued_total", "Jobs ever enqueued, across all processes.", nil, func() ([]Sample, error) {
+		n, err := s.JobsEnqueued()
+		return []Sample{{Value: float64(n)}}, err
+	})
+}
@@ -0,0 +1,238 @@
+// Package notify sends alerts about dead jobs and failing queues to
+// webhooks, Slack and email, with dedup and per-sink rate limits so a bad
+// deploy does not flood anyone.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+// Message is one notification. Key identifies what it is about; a second
+// message with the same key inside the dedup window is dropped.
+type Message struct {
+	Event   string    `json:"event"`
+	Key     string    `json:"key"`
+	Title   string    `json:"title"`
+	Text    string    `json:"text"`
+	Queue   string    `json:"queue,omitempty"`
+	JobID   int64     `json:"job_id,omitempty"`
+	Command string    `json:"command,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Store is where a Notifier finds its sinks, config and recent outcomes
+// and records what it sent. SQLiteStore and PostgresStore implement it.
+type Store interface {
+	storage.SinkStore
+	ConfigGet(key string) (string, error)
+	OutcomesSince(since time.Time) (map[string]storage.QueueOutcomes, error)
+}
+
+// Notifier fans messages out to the sinks stored in the database.
+type Notifier struct {
+	store  Store
+	client *http.Client
+	now    func() time.Time
+	queue  chan Message
+}
+
+// New creates a Notifier. Call Run to start delivering queued messages.
+func New(store Store) *Notifier {
+	return &Notifier{
+		store:  store,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+		queue:  make(chan Message, 100),
+	}
+}
+
+// Run delivers messages passed to Notify until the process exits.
+func (n *Notifier) Run() {
+	for m := range n.queue {
+		if err := n.Send(m); err != nil {
+			slog.Warn("send notification", "key", m.Key, "err", err)
+		}
+	}
+}
+
+// Notify queues m for delivery without blocking the caller. Messages are
+// dropped when the backlog is full.
+func (n *Notifier) Notify(m Message) {
+	select {
+	case n.queue <- m:
+	default:
+		slog.Warn("notification backlog full, dropping", "key", m.Key)
+	}
+}
+
+// JobDead reports a job that landed in the DLQ.
+func (n *Notifier) JobDead(j *job.Job) {
+	n.Notify(Message{
+		Event: "job.dead",
+		// dedup on the command so a broken deploy failing the same job
+		// over and over alerts once per window
+		Key:     "dead:" + j.Queue + ":" + j.Command,
+		Title:   fmt.Sprintf("job %d moved to the dead letter queue", j.ID),
+		Text:    fmt.Sprintf("queue: %s\ncommand: %s\nattempts: %d\nerror: %s", j.Queue, j.Command, j.Attempts, j.LastError),
+		Queue:   j.Queue,
+		JobID:   j.ID,
+		Command: j.Command,
+		Error:   j.LastError,
+	})
+}
+
+// Escalated reports a DLQ entry that kept failing after its last
+// automatic redrive and now needs a human.
+func (n *Notifier) Escalated(d *storage.DeadJob) {
+	n.Notify(Message{
+		Event:   "job.escalated",
+		Key:     fmt.Sprintf("escalated:%d", d.ID),
+		Title:   fmt.Sprintf("job %d still failing after %d redrives", d.OrigID.Int64, d.Replays),
+		Text:    fmt.Sprintf("queue: %s\ncommand: %s\nreason: %s\nerror: %s", d.Queue, d.Command, d.Reason, d.LastError.String),
+		Queue:   d.Queue,
+		JobID:   d.OrigID.Int64,
+		Command: d.Command,
+		Error:   d.LastError.String,
+	})
+}
+
+// Send delivers m to every sink, honouring dedup and rate limits.
+func (n *Notifier) Send(m Message) error {
+	if m.Time.IsZero() {
+		m.Time = n.now().UTC()
+	}
+	sinks, err := n.store.ListSinks()
+	if err != nil {
+		return err
+	}
+	dedup := n.configDuration("notify.dedup_window", 15*time.Minute)
+	limit, per := n.rateLimit()
+
+	var errs []error
+	for _, s := range sinks {
+		now := n.now()
+		if m.Key != "" {
+			sent, err := n.store.NotificationSent(s.ID, m.Key, now.Add(-dedup))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if sent {
+				continue
+			}
+		}
+		count, err := n.store.CountNotifications(s.ID, now.Add(-per))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if count >= limit {
+			slog.Warn("notification rate limit reached", "sink", s.ID, "key", m.Key)
+			continue
+		}
+
+		sender, err := NewSender(s, n.client)
+		if err == nil {
+			err = sender.Send(m)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %d (%s): %w", s.ID, s.Kind, err))
+			continue
+		}
+		if err := n.store.RecordNotification(s.ID, m.Key, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckFailureRate alerts on every queue whose share of failed attempts
+// in the recent window crossed notify.failure_rate.
+func (n *Notifier) CheckFailureRate() error {
+	window := n.configDuration("notify.failure_window", 5*time.Minute)
+	threshold := n.configFloat("notify.failure_rate", 0.5)
+	minAttempts := int(n.configFloat("notify.failure_min", 10))
+
+	outcomes, err := n.store.OutcomesSince(n.now().Add(-window))
+	if err != nil {
+		return err
+	}
+	for q, o := range outcomes {
+		total := o.Completed + o.Failed
+		if total == 0 || total < minAttempts {
+			continue
+		}
+		rate := float64(o.Failed) / float64(total)
+		if rate < threshold {
+			continue
+		}
+		n.Notify(Message{
+			Event: "queue.failure_rate",
+			Key:   "failure_rate:" + q,
+			Title: fmt.Sprintf("queue %s failure rate is %.0f%%", q, rate*100),
+			Text:  fmt.Sprintf("%d of %d attempts in the last %s failed (threshold %.0f%%)", o.Failed, total, window, threshold*100),
+			Queue: q,
+		})
+	}
+	return nil
+}
+
+// WatchFailureRate runs CheckFailureRate every interval.
+func (n *Notifier) WatchFailureRate(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		if err := n.CheckFailureRate(); err != nil {
+			slog.Warn("check failure rate", "err", err)
+		}
+	}
+}
+
+func (n *Notifier) configDuration(key string, def time.Duration) time.Duration {
+	v, err := n.store.ConfigGet(key)
+	if err != nil || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("invalid config value", "key", key, "value", v)
+		return def
+	}
+	return d
+}
+
+func (n *Notifier) configFloat(key string, def float64) float64 {
+	v, err := n.store.ConfigGet(key)
+	if err != nil || v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		slog.Warn("invalid config value", "key", key, "value", v)
+		return def
+	}
+	return f
+}
+
+// rateLimit parses notify.rate_limit, e.g. "20/1h" for at most 20
+// notifications per sink per hour.
+func (n *Notifier) rateLimit() (int, time.Duration) {
+	v, _ := n.store.ConfigGet("notify.rate_limit")
+	count, per, ok := strings.Cut(v, "/")
+	c, err1 := strconv.Atoi(count)
+	d, err2 := time.ParseDuration(per)
+	if !ok || err1 != nil || err2 != nil {
+		return 20, time.Hour
+	}
+	return c, d
+}
@@ -0,0 +1,264 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+func openTestDB(t *testing.T) *Notifier {
+	t.Helper()
+	db, err := storage.OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(storage.NewSQLiteStore(db))
+}
+
+// recorder is an HTTP endpoint that keeps every request body.
+type recorder struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.bodies = append(r.bodies, string(b))
+	r.mu.Unlock()
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+func TestWebhookAndSlackPayloads(t *testing.T) {
+	n := openTestDB(t)
+	hook, slack := &recorder{}, &recorder{}
+	hookSrv, slackSrv := httptest.NewServer(hook), httptest.NewServer(slack)
+	defer hookSrv.Close()
+	defer slackSrv.Close()
+
+	mustAddSink(t, n, storage.Sink{Kind: "webhook", Target: hookSrv.URL})
+	mustAddSink(t, n, storage.Sink{Kind: "slack", Target: slackSrv.URL})
+
+	m := Message{Event: "job.dead", Key: "dead:1", Title: "job 1 died", Text: "boom", JobID: 1}
+	if err := n.Send(m); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var got Message
+	if err := json.Unmarshal([]byte(hook.bodies[0]), &got); err != nil {
+		t.Fatalf("webhook body: %v", err)
+	}
+	if got.Event != "job.dead" || got.JobID != 1 || got.Title != "job 1 died" {
+		t.Errorf("unexpected webhook payload %+v", got)
+	}
+
+	var sp slackPayload
+	if err := json.Unmarshal([]byte(slack.bodies[0]), &sp); err != nil {
+		t.Fatalf("slack body: %v", err)
+	}
+	if sp.Text != "*job 1 died*\nboom" {
+		t.Errorf("unexpected slack text %q", sp.Text)
+	}
+}
+
+func TestDedupAndRateLimit(t *testing.T) {
+	n := openTestDB(t)
+	hook := &recorder{}
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+	mustAddSink(t, n, storage.Sink{Kind: "webhook", Target: srv.URL})
+	if err := n.store.(*storage.SQLiteStore).ConfigSet("notify.rate_limit", "3/1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		_ = n.Send(Message{Key: "dead:same", Title: "same"})
+	}
+	if c := hook.count(); c != 1 {
+		t.Fatalf("expected duplicates to be dropped, got %d sends", c)
+	}
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		_ = n.Send(Message{Key: k, Title: k})
+	}
+	if c := hook.count(); c != 3 {
+		t.Fatalf("expected rate limit of 3 sends, got %d", c)
+	}
+}
+
+func TestCheckFailureRate(t *testing.T) {
+	n := openTestDB(t)
+	hook := &recorder{}
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+	mustAddSink(t, n, storage.Sink{Kind: "webhook", Target: srv.URL})
+	store := n.store.(*storage.SQLiteStore)
+	if err := store.ConfigSet("notify.failure_min", "5"); err != nil {
+		t.Fatal(err)
+	}
+
+	// emails: 3 failed attempts, a job moved to the DLQ and 1 success in
+	// the window; reports: mostly successes, and failures from before the
+	// window; tiny: all failed but too few attempts to judge
+	outcomes := []struct {
+		queue string
+		to    []string
+		age   time.Duration
+	}{
+		{"emails", []string{"failed", "failed", "failed", "completed"}, time.Minute},
+		{"reports", []string{"failed", "completed", "completed", "completed", "completed"}, time.Minute},
+		{"reports", []string{"failed", "failed", "failed", "failed", "failed", "failed"}, time.Hour},
+		{"tiny", []string{"failed", "failed"}, time.Minute},
+	}
+	for _, o := range outcomes {
+		j := job.NewJob("run "+o.queue, 3)
+		j.Queue = o.queue
+		id, err := store.InsertJob(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, to := range o.to {
+			e := storage.Event{JobID: id, From: "running", To: to, Actor: "worker-1", CreatedAt: time.Now().Add(-o.age)}
+			if err := store.InsertEvent(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the DLQ entry's queue is found through dead_jobs once the job row
+	// is gone
+	dead := job.NewJob("run emails", 0)
+	dead.Queue = "emails"
+	id, err := store.InsertJob(dead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.ID = id
+	if err := store.MoveToDead(dead, job.ReasonMaxRetries, storage.Event{From: "running", To: "dead", Actor: "worker-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		if err := n.CheckFailureRate(); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			select {
+			case m := <-n.queue:
+				if err := n.Send(m); err != nil {
+					t.Fatal(err)
+				}
+			default:
+				return
+			}
+		}
+	}
+	check()
+	if c := hook.count(); c != 1 {
+		t.Fatalf("got %d alerts, want 1 for emails:\n%s", c, strings.Join(hook.bodies, "\n"))
+	}
+	var got Message
+	if err := json.Unmarshal([]byte(hook.bodies[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != "queue.failure_rate" || got.Queue != "emails" || got.Title != "queue emails failure rate is 80%" ||
+		!strings.HasPrefix(got.Text, "4 of 5 attempts") {
+		t.Errorf("alert %+v", got)
+	}
+
+	// the next check within the dedup window stays quiet
+	check()
+	if c := hook.count(); c != 1 {
+		t.Errorf("got %d alerts after a second check, want the first only", c)
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	n := openTestDB(t)
+	addr, mails := fakeSMTP(t)
+	mustAddSink(t, n, storage.Sink{Kind: "smtp", Target: addr, EmailFrom: "q@example.com", EmailTo: "ops@example.com"})
+
+	if err := n.Send(Message{Key: "k", Title: "job 7 died", Text: "exit 1"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	mail := <-mails
+	if !strings.Contains(mail, "Subject: [queuectl] job 7 died") || !strings.Contains(mail, "exit 1") {
+		t.Errorf("unexpected mail:\n%s", mail)
+	}
+}
+
+func mustAddSink(t *testing.T, n *Notifier, s storage.Sink) {
+	t.Helper()
+	if _, err := n.store.InsertSink(s); err != nil {
+		t.Fatalf("add sink: %v", err)
+	}
+}
+
+// fakeSMTP accepts a single message and returns its DATA section.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				mails <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails
+}
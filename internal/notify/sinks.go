@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"queuectl/internal/storage"
+)
+
+// Sender delivers a message to one destination.
+type Sender interface {
+	Send(m Message) error
+}
+
+// NewSender builds the Sender for a stored sink.
+func NewSender(s storage.Sink, client *http.Client) (Sender, error) {
+	switch s.Kind {
+	case "webhook":
+		return &Webhook{URL: s.Target, Client: client}, nil
+	case "slack":
+		return &Slack{URL: s.Target, Client: client}, nil
+	case "smtp":
+		return &SMTP{Addr: s.Target, From: s.EmailFrom, To: splitList(s.EmailTo)}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink kind %q", s.Kind)
+	}
+}
+
+// Webhook POSTs the message as JSON.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Send(m Message) error {
+	return postJSON(w.Client, w.URL, m)
+}
+
+// Slack POSTs a Slack-compatible incoming-webhook payload.
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (s *Slack) Send(m Message) error {
+	return postJSON(s.Client, s.URL, slackPayload{Text: "*" + m.Title + "*\n" + m.Text})
+}
+
+// SMTP sends a plain-text email through a relay, typically a local one
+// that does not need authentication.
+type SMTP struct {
+	Addr string
+	From string
+	To   []string
+}
+
+func (s *SMTP) Send(m Message) error {
+	if len(s.To) == 0 {
+		return fmt.Errorf("smtp sink %s has no recipients", s.Addr)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: [queuectl] %s\r\n", m.Title)
+	fmt.Fprintf(&b, "Date: %s\r\n", m.Time.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return smtp.SendMail(s.Addr, nil, s.From, s.To, []byte(b.String()))
+}
+
+func postJSON(client *http.Client, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+// Package output renders command results for people and for scripts.
+// Commands build a typed result and hand it to Render, which writes it
+// as JSON, YAML or an aligned table. The JSON and YAML field names are
+// part of the CLI's interface: add fields, never rename or drop them.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a value of the --output flag.
+type Format string
+
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+)
+
+// ParseFormat validates an --output value.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Table, JSON, YAML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want table, json or yaml)", s)
+}
+
+// Tabular is a result that knows how to lay itself out as a table. It
+// writes tab-separated cells, one row per line; Render aligns them.
+type Tabular interface {
+	WriteTable(w io.Writer)
+}
+
+// Render writes v to w in format f. For Table, v must implement Tabular.
+func Render(w io.Writer, f Format, v any) error {
+	switch f {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	case Table:
+		t, ok := v.(Tabular)
+		if !ok {
+			return fmt.Errorf("%T has no table layout", v)
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		t.WriteTable(tw)
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown output format %q", f)
+}
+
+// Time formats t for a table cell, or "-" for the zero time.
+func Time(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type row struct {
+	ID   int64             `json:"id" yaml:"id"`
+	Name string            `json:"name" yaml:"name"`
+	At   time.Time         `json:"at" yaml:"at"`
+	Tags map[string]string `json:"tags" yaml:"tags"`
+}
+
+func (r *row) WriteTable(w io.Writer) {
+	fmt.Fprintln(w, "ID\tNAME")
+	fmt.Fprintf(w, "%d\t%s\n", r.ID, r.Name)
+}
+
+func render(t *testing.T, f Format, v any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Render(&buf, f, v); err != nil {
+		t.Fatalf("render %s: %v", f, err)
+	}
+	return buf.String()
+}
+
+func TestRender(t *testing.T) {
+	r := &row{ID: 7, Name: "backup", At: time.Date(2025, 1, 2, 3, 4, 5, 6e6, time.UTC),
+		Tags: map[string]string{"b": "2", "a": "1", "c": "3"}}
+
+	want := `{
+  "id": 7,
+  "name": "backup",
+  "at": "2025-01-02T03:04:05.006Z",
+  "tags": {
+    "a": "1",
+    "b": "2",
+    "c": "3"
+  }
+}
+`
+	if got := render(t, JSON, r); got != want {
+		t.Errorf("json:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = `id: 7
+name: backup
+at: 2025-01-02T03:04:05.006Z
+tags:
+  a: "1"
+  b: "2"
+  c: "3"
+`
+	if got := render(t, YAML, r); got != want {
+		t.Errorf("yaml:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = "ID  NAME\n7   backup\n"
+	if got := render(t, Table, r); got != want {
+		t.Errorf("table:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestRenderTableNeedsLayout(t *testing.T) {
+	err := Render(io.Discard, Table, struct{}{})
+	if err == nil || !strings.Contains(err.Error(), "no table layout") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"table", "json", "yaml"} {
+		if f, err := ParseFormat(s); err != nil || string(f) != s {
+			t.Errorf("ParseFormat(%q) = %q, %v", s, f, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) succeeded")
+	}
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultLease is how long a running job's worker may go without a
+// heartbeat before the job is reclaimed. Workers heartbeat every 10s.
+const DefaultLease = time.Minute
+
+// Reclaim expires running jobs whose worker has not heartbeat for lease,
+// e.g. because its process crashed or its host went away, and marks
+// those workers lost. Each counts as a failed attempt, since the job may
+// have run. It returns how many jobs it reclaimed.
+func (q *Queue) Reclaim(lease time.Duration) (int, error) {
+	stale, err := q.store.StaleJobs(time.Now().Add(-lease))
+	if err != nil {
+		return 0, err
+	}
+	for i := range stale {
+		j := &stale[i]
+		slog.Warn("lease expired", "job_id", j.ID, "worker_id", j.WorkerID)
+		if err := q.Expire(j, fmt.Sprintf("lease expired: worker %d stopped heartbeating", j.WorkerID)); err != nil {
+			return i, err
+		}
+		if j.WorkerID != 0 {
+			if err := q.store.UpdateWorkerStatus(j.WorkerID, "lost", 0); err != nil {
+				return i + 1, err
+			}
+		}
+	}
+	return len(stale), nil
+}
+
+// RunReclaim calls Reclaim every half lease until the process exits.
+func (q *Queue) RunReclaim(lease time.Duration) {
+	q = q.WithActor("reclaim")
+	for {
+		time.Sleep(lease / 2)
+		if _, err := q.Reclaim(lease); err != nil {
+			slog.Error("reclaim expired leases", "err", err)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+	return NewQueue(storage.NewMemoryStore())
+}
+
+// newSQLiteQueue is newTestQueue on a fresh database, for tests that
+// depend on the config the schema seeds.
+func newSQLiteQueue(t *testing.T) (*Queue, *sql.DB) {
+	t.Helper()
+	db, err := storage.OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewQueue(storage.NewSQLiteStore(db)), db
+}
+
+// deadEntryOf returns the DLQ entry of job id.
+func deadEntryOf(q *Queue, id int64) (*storage.DeadJob, error) {
+	ds, err := q.store.FindDeadJobs(storage.DeadJobFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(ds) - 1; i >= 0; i-- {
+		if ds[i].OrigID.Int64 == id {
+			return &ds[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// halfRand always picks the middle of the jitter range.
+type halfRand struct{}
+
+func (halfRand) Int64N(n int64) int64 { return n / 2 }
+
+func TestRejectSchedulesWithBackoff(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		spec   string
+		config map[string]string
+		want   []time.Duration // delay after each rejection
+	}{
+		{"legacy backoff_base", "", map[string]string{"backoff_base": "3"}, []time.Duration{1 * time.Second, 3 * time.Second, 9 * time.Second}},
+		{"global strategy", "", map[string]string{"backoff": "linear:10s"}, []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second}},
+		{"global cap", "", map[string]string{"backoff": "linear:10s", "max_backoff": "15s"}, []time.Duration{10 * time.Second, 15 * time.Second, 15 * time.Second}},
+		{"unparsable cap", "", map[string]string{"backoff": "linear:40m", "max_backoff": "soon"}, []time.Duration{40 * time.Minute, time.Hour, time.Hour}},
+		{"per job wins", "fixed:1m", map[string]string{"backoff": "linear:10s"}, []time.Duration{time.Minute, time.Minute, time.Minute}},
+		{"full jitter", "exp:2,jitter=full", nil, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}},
+		{"decorrelated jitter", "exp:3,jitter=decorrelated,max=5s", nil, []time.Duration{2 * time.Second, 3 * time.Second, 3 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t)
+			q.SetClock(func() time.Time { return now })
+			q.SetRand(halfRand{})
+			for k, v := range tt.config {
+				if err := q.store.ConfigSet(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			j := job.NewJob("false", 10)
+			j.Backoff = tt.spec
+			if err := q.Enqueue(j); err != nil {
+				t.Fatal(err)
+			}
+			j.State = job.Running
+			for i, want := range tt.want {
+				if err := q.Reject(j, "boom"); err != nil {
+					t.Fatalf("reject %d: %v", i+1, err)
+				}
+				if j.RetryDelay != want || !j.ScheduledAt.Equal(now.Add(want)) {
+					t.Errorf("reject %d: delay %s scheduled %s, want %s", i+1, j.RetryDelay, j.ScheduledAt, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFailFollowsRetryPolicy(t *testing.T) {
+	q := newTestQueue(t)
+
+	j := job.NewJob("exit 2", 5)
+	j.Retry = job.RetryPolicy{NoRetryOn: []int{2}, RetryLaterOn: []int{75}}
+	if err := q.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+
+	j.State = job.Running
+	if err := q.Fail(j, 75, "busy"); err != nil {
+		t.Fatalf("retry later: %v", err)
+	}
+	if j.State != job.Failed || j.Attempts != 0 {
+		t.Errorf("retry later: got state %s attempts %d, want failed with 0 attempts", j.State, j.Attempts)
+	}
+
+	j.State = job.Running
+	if err := q.Fail(j, 2, "bad input"); err != nil {
+		t.Fatalf("permanent: %v", err)
+	}
+	if j.State != job.Dead {
+		t.Errorf("permanent: got state %s, want dead", j.State)
+	}
+	dead, err := q.store.FindDeadJobs(storage.DeadJobFilter{})
+	if err != nil || len(dead) != 1 || dead[0].OrigID.Int64 != j.ID {
+		t.Fatalf("expected job %d in the DLQ, got %+v (err %v)", j.ID, dead, err)
+	}
+
+	id, err := q.RetryDead(int(dead[0].ID), false)
+	if err != nil {
+		t.Fatalf("retry dead: %v", err)
+	}
+	retried, err := q.store.GetJob(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := retried.Retry.NoRetryOn; len(got) != 1 || got[0] != 2 {
+		t.Errorf("retried job lost its retry policy: %+v", retried.Retry)
+	}
+}
+
+func TestEffectiveMaxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		retries    int
+		config     map[string]string
+		want       int
+		wantSource string
+	}{
+		{"seeded global", job.InheritRetries, nil, 3, "global"},
+		{"global override", job.InheritRetries, map[string]string{"max_retries": "7"}, 7, "global"},
+		{"queue beats global", job.InheritRetries, map[string]string{"max_retries": "7", "queue.emails.max_retries": "1"}, 1, "queue emails"},
+		{"other queue ignored", job.InheritRetries, map[string]string{"queue.reports.max_retries": "9"}, 3, "global"},
+		{"job beats queue", 5, map[string]string{"queue.emails.max_retries": "1"}, 5, "job"},
+		{"explicit zero", 0, map[string]string{"max_retries": "7", "queue.emails.max_retries": "1"}, 0, "job"},
+		{"invalid queue value", job.InheritRetries, map[string]string{"queue.emails.max_retries": "lots"}, 3, "global"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := newSQLiteQueue(t)
+			for k, v := range tt.config {
+				if err := q.store.ConfigSet(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			j := job.NewJob("true", tt.retries)
+			j.Queue = "emails"
+			got, source := q.EffectiveMaxRetries(j)
+			if got != tt.want || source != tt.wantSource {
+				t.Errorf("got %d from %s, want %d from %s", got, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+
+	t.Run("missing global", func(t *testing.T) {
+		q, db := newSQLiteQueue(t)
+		if _, err := db.Exec(`DELETE FROM config WHERE key = 'max_retries'`); err != nil {
+			t.Fatal(err)
+		}
+		if got, source := q.EffectiveMaxRetries(job.NewJob("true", job.InheritRetries)); got != job.DefaultMaxRetries || source != "default" {
+			t.Errorf("got %d from %s, want %d from default", got, source, job.DefaultMaxRetries)
+		}
+	})
+}
+
+func TestRejectHonorsZeroRetries(t *testing.T) {
+	q := newTestQueue(t)
+
+	j := job.NewJob("false", 0)
+	if err := q.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	j.State = job.Running
+	if err := q.Reject(j, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if j.State != job.Dead {
+		t.Errorf("job with --retries 0 is %s after one failure, want dead", j.State)
+	}
+}
+
+func TestPullNAndRelease(t *testing.T) {
+	q := newTestQueue(t)
+	var ids []int64
+	for _, cmd := range []string{"a", "b", "c"} {
+		j, err := q.Push(cmd, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, j.ID)
+	}
+	// c failed once and its retry delay has passed
+	c, _ := q.store.GetJob(ids[2])
+	c.State, c.Attempts, c.LastError = job.Failed, 1, "boom"
+	c.ScheduledAt = time.Now().Add(-time.Minute)
+	if err := q.store.UpdateJob(c); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := q.PullN(5, 1)
+	if err != nil || len(jobs) != 3 {
+		t.Fatalf("PullN: %d jobs, %v; want 3", len(jobs), err)
+	}
+	if err := q.Release(jobs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[int64]job.JobState{ids[0]: job.Running, ids[1]: job.Pending, ids[2]: job.Failed} {
+		got, _ := q.store.GetJob(id)
+		if got.State != want {
+			t.Errorf("job %d in %s, want %s", id, got.State, want)
+		}
+		if id == ids[2] && got.Attempts != 1 {
+			t.Errorf("release changed attempts to %d", got.Attempts)
+		}
+	}
+	evs, _ := q.store.ListEvents(storage.EventFilter{JobID: ids[2]})
+	if last := evs[len(evs)-1]; last.From != "running" || last.To != "failed" || last.Reason != "released unstarted" {
+		t.Errorf("last event %+v", last)
+	}
+
+	again, err := q.PullN(5, 1)
+	if err != nil || len(again) != 2 || again[0].ID != ids[1] || again[1].ID != ids[2] {
+		t.Fatalf("released jobs were not claimable again: %v, %v", again, err)
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	q := newTestQueue(t)
+	for _, cmd := range []string{"a", "b"} {
+		if _, err := q.Push(cmd, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crashed, _ := q.store.RegisterWorker()
+	alive, _ := q.store.RegisterWorker()
+	lost, _ := q.Pull(crashed)
+	kept, _ := q.Pull(alive)
+
+	time.Sleep(30 * time.Millisecond)
+	if err := q.store.UpdateWorkerStatus(alive, "running", kept.ID); err != nil {
+		t.Fatal(err)
+	}
+	n, err := q.WithActor("reclaim").Reclaim(20 * time.Millisecond)
+	if err != nil || n != 1 {
+		t.Fatalf("reclaimed %d, %v; want 1", n, err)
+	}
+	got, _ := q.store.GetJob(lost.ID)
+	if got.State != job.Failed || got.Attempts != 1 || got.WorkerID != 0 || !strings.Contains(got.LastError, "lease expired") {
+		t.Errorf("reclaimed job %+v", got)
+	}
+	if got, _ := q.store.GetJob(kept.ID); got.State != job.Running || got.WorkerID != alive {
+		t.Errorf("job of a live worker %+v", got)
+	}
+	ws, _ := q.store.ListWorkers()
+	if ws[0].ID != crashed || ws[0].State != "lost" {
+		t.Errorf("crashed worker %+v, want lost", ws[0])
+	}
+	evs, _ := q.store.ListEvents(storage.EventFilter{JobID: lost.ID})
+	if last := evs[len(evs)-1]; last.From != "running" || last.To != "failed" || last.Actor != "reclaim" {
+		t.Errorf("last event %+v", last)
+	}
+}
+
+func TestRetryDeadKeepsIdentity(t *testing.T) {
+	q := newTestQueue(t)
+
+	j := job.NewJob("backup.sh", 0)
+	if err := q.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	for replay := 1; replay <= 2; replay++ {
+		j.State = job.Running
+		if err := q.Reject(j, "disk full"); err != nil {
+			t.Fatal(err)
+		}
+		d, err := deadEntryOf(q, j.ID)
+		if err != nil {
+			t.Fatalf("replay %d: job not in DLQ: %v", replay, err)
+		}
+
+		id, err := q.RetryDead(int(d.ID), false)
+		if err != nil {
+			t.Fatalf("replay %d: %v", replay, err)
+		}
+		if id != j.ID {
+			t.Fatalf("replay %d: requeued as job %d, want original id %d", replay, id, j.ID)
+		}
+		got, err := q.store.GetJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.State != job.Pending || got.Attempts != 0 || got.RetriedFrom != d.ID || got.Replays != replay {
+			t.Errorf("replay %d: got %+v", replay, got)
+		}
+		if !got.CreatedAt.Equal(j.CreatedAt.Truncate(time.Millisecond)) {
+			t.Errorf("replay %d: created_at changed from %s to %s", replay, j.CreatedAt, got.CreatedAt)
+		}
+		if kept, err := q.store.GetDeadJob(d.ID); err != nil || kept.ReplayedAs.Int64 != id {
+			t.Errorf("replay %d: DLQ entry %d not kept as replayed: %+v, %v", replay, d.ID, kept, err)
+		}
+		if _, err := q.RetryDead(int(d.ID), false); !errors.Is(err, sql.ErrNoRows) || !strings.Contains(err.Error(), "already retried") {
+			t.Errorf("replay %d: retrying DLQ entry %d again: %v", replay, d.ID, err)
+		}
+		j = got
+	}
+
+	if _, err := q.RetryDead(12345, false); err == nil {
+		t.Error("retrying a missing DLQ entry succeeded")
+	}
+}
+
+func TestDeadReasons(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(q *Queue, j *job.Job) error
+		want job.DeadReason
+	}{
+		{"retries used up", func(q *Queue, j *job.Job) error { return q.Fail(j, 1, "boom") }, job.ReasonMaxRetries},
+		{"permanent exit code", func(q *Queue, j *job.Job) error { return q.Fail(j, 2, "bad input") }, job.ReasonPermanent},
+		{"command not found", func(q *Queue, j *job.Job) error { return q.Fail(j, 127, "not found") }, job.ReasonInvalidPayload},
+		{"lease expired", func(q *Queue, j *job.Job) error { return q.Expire(j, "lease expired") }, job.ReasonTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t)
+			j := job.NewJob("work", 0)
+			j.Retry.NoRetryOn = []int{2}
+			if err := q.Enqueue(j); err != nil {
+				t.Fatal(err)
+			}
+			j.State = job.Running
+			if err := tt.fail(q, j); err != nil {
+				t.Fatal(err)
+			}
+			d, err := deadEntryOf(q, j.ID)
+			if err != nil {
+				t.Fatalf("job not in DLQ: %v", err)
+			}
+			if d.Reason != tt.want {
+				t.Errorf("reason %q, want %q", d.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDead(t *testing.T) {
+	q := newTestQueue(t)
+	j := job.NewJob("bakcup.sh", 0)
+	if err := q.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	j.State = job.Running
+	if err := q.Fail(j, 127, "not found"); err != nil {
+		t.Fatal(err)
+	}
+	d, err := deadEntryOf(q, j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Command, d.MaxRetries = "backup.sh", 2
+	if err := q.EditDead(d); err != nil {
+		t.Fatal(err)
+	}
+	id, err := q.RetryDead(int(d.ID), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.store.GetJob(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != "backup.sh" || got.MaxRetries != 2 {
+		t.Errorf("replayed job has command %q max_retries %d, want the edited values", got.Command, got.MaxRetries)
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	q := newTestQueue(t)
+	q.SetClock(func() time.Time { return now })
+	for k, v := range map[string]string{"queue.reports.redrive_after": "1h", "queue.reports.redrive_max": "2"} {
+		if err := q.store.ConfigSet(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var escalations []int64
+	q.OnEscalate(func(d *storage.DeadJob) { escalations = append(escalations, d.OrigID.Int64) })
+
+	kill := func(j *job.Job, exitCode int) {
+		t.Helper()
+		j.State = job.Running
+		if err := q.Fail(j, exitCode, "boom"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enqueue := func(queue string) *job.Job {
+		t.Helper()
+		j := job.NewJob("report.sh", 0)
+		j.Queue = queue
+		j.Retry.NoRetryOn = []int{2}
+		if err := q.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+		return j
+	}
+	transient, permanent, unmanaged := enqueue("reports"), enqueue("reports"), enqueue("default")
+	kill(transient, 1)
+	kill(permanent, 2)
+	kill(unmanaged, 1)
+
+	// MoveToDead stamps failed_at with the wall clock, so step the
+	// injected clock relative to it.
+	now = time.Now().UTC()
+	if n, _, err := q.Redrive(); err != nil || n != 0 {
+		t.Fatalf("redrove %d entries before redrive_after passed (err %v)", n, err)
+	}
+
+	for replay := 1; replay <= 2; replay++ {
+		now = time.Now().UTC().Add(time.Hour)
+		n, e, err := q.Redrive()
+		if err != nil || n != 1 || e != 0 {
+			t.Fatalf("redrive %d: requeued %d escalated %d err %v, want 1 requeued", replay, n, e, err)
+		}
+		j, err := q.store.GetJob(transient.ID)
+		if err != nil || j.Replays != replay {
+			t.Fatalf("redrive %d: job %+v err %v", replay, j, err)
+		}
+		kill(j, 1)
+	}
+
+	now = time.Now().UTC().Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		n, e, err := q.Redrive()
+		if err != nil || n != 0 {
+			t.Fatalf("redrove %d entries after the last redrive (err %v)", n, err)
+		}
+		if want := 1 - i; e != want {
+			t.Errorf("pass %d escalated %d, want %d", i+1, e, want)
+		}
+	}
+	if len(escalations) != 1 || escalations[0] != transient.ID {
+		t.Errorf("escalated %v, want [%d]", escalations, transient.ID)
+	}
+
+	statuses, err := q.RedriveStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Queue != "reports" || statuses[0].Escalated != 1 || statuses[0].Skipped != 1 {
+		t.Errorf("statuses %+v", statuses)
+	}
+}
@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"queuectl/internal/duration"
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+// RedrivePolicy retries DLQ entries of a queue automatically once they
+// have been dead for After, at most Max times per job.
+type RedrivePolicy struct {
+	After time.Duration
+	Max   int
+}
+
+// RedrivePolicy returns the policy for a queue from the
+// queue.<name>.redrive_after/redrive_max config, falling back to the
+// global redrive_after/redrive_max. ok is false when redrive is off.
+func (q *Queue) RedrivePolicy(queue string) (p RedrivePolicy, ok bool) {
+	after := q.configString("queue."+queue+".redrive_after", "redrive_after")
+	if after == "" {
+		return p, false
+	}
+	d, err := duration.Parse(after)
+	if err != nil {
+		slog.Warn("invalid redrive_after", "queue", queue, "value", after)
+		return p, false
+	}
+	p.After, p.Max = d, 1
+	if v := q.configString("queue."+queue+".redrive_max", "redrive_max"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Warn("invalid redrive_max", "queue", queue, "value", v)
+		} else {
+			p.Max = n
+		}
+	}
+	return p, true
+}
+
+// configString returns the first of keys that is set.
+func (q *Queue) configString(keys ...string) string {
+	for _, k := range keys {
+		if v, err := q.store.ConfigGet(k); err == nil && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// redrivable reports whether an entry died of something a later retry
+// can fix. Permanent exit codes and commands that cannot run are left
+// for a human.
+func redrivable(d storage.DeadJob) bool {
+	return d.Reason != job.ReasonPermanent && d.Reason != job.ReasonInvalidPayload
+}
+
+// OnEscalate registers fn to be called once for every DLQ entry that
+// used up its redrives.
+func (q *Queue) OnEscalate(fn func(*storage.DeadJob)) {
+	q.onEscalate = fn
+}
+
+// Redrive requeues the DLQ entries whose redrive policy says they are
+// due and escalates the ones that have no redrives left. Several
+// processes may run it at once: RetryDeadJob and MarkEscalated only
+// succeed for one of them.
+func (q *Queue) Redrive() (requeued, escalated int, err error) {
+	dead, err := q.store.FindDeadJobs(storage.DeadJobFilter{})
+	if err != nil {
+		return 0, 0, err
+	}
+	now := q.now()
+	policies := map[string]*RedrivePolicy{}
+	for _, d := range dead {
+		p, seen := policies[d.Queue]
+		if !seen {
+			if pol, ok := q.RedrivePolicy(d.Queue); ok {
+				p = &pol
+			}
+			policies[d.Queue] = p
+		}
+		if p == nil || !redrivable(d) {
+			continue
+		}
+
+		if d.Replays >= p.Max {
+			if d.Escalated {
+				continue
+			}
+			reason := fmt.Sprintf("DLQ entry %d escalated after %d redrives", d.ID, d.Replays)
+			won, err := q.store.MarkEscalated(d.ID, q.event(d.OrigID.Int64, job.Dead, job.Dead, reason))
+			if err != nil {
+				return requeued, escalated, err
+			}
+			if won {
+				if q.onEscalate != nil {
+					q.onEscalate(&d)
+				}
+				escalated++
+			}
+			continue
+		}
+
+		if now.Sub(d.FailedAt) < p.After {
+			continue
+		}
+		if _, err := q.RetryDead(int(d.ID), false); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue // another process redrove it first
+			}
+			return requeued, escalated, err
+		}
+		requeued++
+	}
+	return requeued, escalated, nil
+}
+
+// RunRedrive calls Redrive every interval until the process exits.
+func (q *Queue) RunRedrive(interval time.Duration) {
+	q = q.WithActor("redrive")
+	for {
+		requeued, escalated, err := q.Redrive()
+		if err != nil {
+			slog.Error("redrive DLQ", "err", err)
+		} else if requeued > 0 || escalated > 0 {
+			slog.Info("redrove DLQ", "requeued", requeued, "escalated", escalated)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// RedriveStatus summarises the DLQ of one queue under its redrive policy.
+type RedriveStatus struct {
+	Queue     string
+	Policy    RedrivePolicy
+	Waiting   int // will be redriven once After has passed
+	Due       int // will be redriven on the next pass
+	Escalated int
+	Skipped   int // permanent or invalid payload, never redriven
+}
+
+// RedriveStatuses reports every queue that has DLQ entries and a
+// redrive policy, ordered by queue name.
+func (q *Queue) RedriveStatuses() ([]RedriveStatus, error) {
+	dead, err := q.store.FindDeadJobs(storage.DeadJobFilter{})
+	if err != nil {
+		return nil, err
+	}
+	now := q.now()
+	byQueue := map[string]*RedriveStatus{}
+	for _, d := range dead {
+		st, seen := byQueue[d.Queue]
+		if !seen {
+			if p, ok := q.RedrivePolicy(d.Queue); ok {
+				st = &RedriveStatus{Queue: d.Queue, Policy: p}
+			}
+			byQueue[d.Queue] = st
+		}
+		switch {
+		case st == nil:
+		case !redrivable(d):
+			st.Skipped++
+		case d.Replays >= st.Policy.Max:
+			st.Escalated++
+		case now.Sub(d.FailedAt) >= st.Policy.After:
+			st.Due++
+		default:
+			st.Waiting++
+		}
+	}
+
+	var out []RedriveStatus
+	for _, st := range byQueue {
+		if st != nil {
+			out = append(out, *st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Queue < out[j].Queue })
+	return out, nil
+}
@@ -3,39 +3,99 @@ package queue
 import (
 	"database/sql"
 	"fmt"
-	"math"
+	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
+	"queuectl/internal/backoff"
 	"queuectl/internal/job"
+	"queuectl/internal/metrics"
 	"queuectl/internal/storage"
 )
 
 // Queue abstracts high-level queue behaviors on top of storage.
 // Queue provides high-level operations over storage.
 type Queue struct {
-	db *sql.DB
+	store  storage.Store
+	actor  string
+	onDead func(*job.Job)
+	now    func() time.Time
+	rand   backoff.Rand
+
+	onEscalate func(*storage.DeadJob)
+	onEnqueue  func(jobID int64)
+}
+
+// NewQueue creates a queue on top of store.
+func NewQueue(store storage.Store) *Queue {
+	return &Queue{store: store, actor: "queuectl", now: time.Now, rand: backoff.DefaultRand}
+}
+
+// SetClock replaces the time source used for scheduling retries.
+func (q *Queue) SetClock(now func() time.Time) {
+	q.now = now
+}
+
+// SetRand replaces the random source used for backoff jitter.
+func (q *Queue) SetRand(r backoff.Rand) {
+	q.rand = r
+}
+
+// WithActor returns a copy of q whose state changes are attributed to
+// actor in the events table, e.g. "cli:alice" or "worker-3".
+func (q *Queue) WithActor(actor string) *Queue {
+	c := *q
+	c.actor = actor
+	return &c
+}
+
+// OnDead registers fn to be called after a job is moved to the DLQ.
+func (q *Queue) OnDead(fn func(*job.Job)) {
+	q.onDead = fn
+}
+
+// OnEnqueue registers fn to be called after a job is enqueued or
+// requeued from the DLQ, e.g. to wake idle workers.
+func (q *Queue) OnEnqueue(fn func(jobID int64)) {
+	q.onEnqueue = fn
 }
 
-// NewQueue creates a new queue instance.
-func NewQueue(db *sql.DB) *Queue {
-	return &Queue{db: db}
+// event is the audit row of a transition made by q's actor. The store
+// writes it in the transition's own transaction; a jobID of 0 leaves
+// the id to the store, for jobs it has yet to create or claim.
+func (q *Queue) event(jobID int64, from, to job.JobState, reason string) storage.Event {
+	return storage.Event{JobID: jobID, From: string(from), To: string(to), Actor: q.actor, Reason: reason}
 }
 
 // Push inserts a new pending job.
 func (q *Queue) Push(command string, maxRetries int) (*job.Job, error) {
 	j := job.NewJob(command, maxRetries)
-	id, err := storage.InsertJob(q.db, j)
-	if err != nil {
+	if err := q.Enqueue(j); err != nil {
 		return nil, err
 	}
-	j.ID = id
 	return j, nil
 }
 
-// Pull atomically claims the next pending job.
-func (q *Queue) Pull() (*job.Job, error) {
-	j, err := storage.PullPendingJob(q.db)
+// Enqueue inserts a job built by the caller and sets its ID.
+func (q *Queue) Enqueue(j *job.Job) error {
+	if j.Queue == "" {
+		j.Queue = job.DefaultQueue
+	}
+	id, err := q.store.InsertJob(j, q.event(0, "", j.State, "enqueued"))
+	if err != nil {
+		return err
+	}
+	j.ID = id
+	if q.onEnqueue != nil {
+		q.onEnqueue(j.ID)
+	}
+	return nil
+}
+
+// Pull atomically claims the next pending job for workerID.
+func (q *Queue) Pull(workerID int) (*job.Job, error) {
+	j, err := q.store.ClaimJob(workerID, q.event(0, "", job.Running, "claimed"))
 	if err != nil {
 		if err == storage.ErrNoJob {
 			return nil, nil
@@ -45,93 +105,287 @@ func (q *Queue) Pull() (*job.Job, error) {
 	return j, nil
 }
 
+// PullN atomically claims up to n due jobs for workerID, oldest first.
+// It returns an empty slice when nothing is due.
+func (q *Queue) PullN(n, workerID int) ([]*job.Job, error) {
+	return q.store.ClaimJobs(n, workerID, q.event(0, "", job.Running, "claimed"))
+}
+
+// Release hands back claimed jobs that were never started, e.g. the rest
+// of a batch when workers shut down. No attempt happened, so this is not
+// a lifecycle transition: each job returns to the state it was claimed
+// from with its attempts and schedule untouched.
+func (q *Queue) Release(jobs []*job.Job) error {
+	for _, j := range jobs {
+		j.State = j.ClaimedFrom()
+		j.UpdatedAt = q.now().UTC()
+		if err := q.store.UpdateJob(j, q.event(j.ID, job.Running, j.State, "released unstarted")); err != nil {
+			return fmt.Errorf("release job %d: %w", j.ID, err)
+		}
+	}
+	return nil
+}
+
 // Ack marks job completed and deletes it from active jobs.
 func (q *Queue) Ack(j *job.Job) error {
+	from := j.State
 	if err := j.UpdateState(job.Completed); err != nil {
 		return err
 	}
-	j.UpdatedAt = time.Now().UTC()
-	return storage.UpdateJob(q.db, j)  // just update, don't delete
+	j.UpdatedAt = q.now().UTC()
+	if err := q.store.UpdateJob(j, q.event(j.ID, from, job.Completed, "")); err != nil { // just update, don't delete
+		return err
+	}
+	metrics.JobsCompleted.Inc(j.Queue)
+	return nil
 }
 
 
 // Reject handles retry or moves job to DLQ when retries exhausted.
 func (q *Queue) Reject(j *job.Job, lastError string) error {
+    return q.reject(j, lastError, job.ReasonMaxRetries)
+}
+
+// Expire is Reject for an attempt that never reported back, such as a
+// lease that ran out; if it was the last retry the DLQ entry is
+// classified as a timeout.
+func (q *Queue) Expire(j *job.Job, lastError string) error {
+    return q.reject(j, lastError, job.ReasonTimeout)
+}
+
+// reject counts a failed attempt and either schedules a retry or moves
+// j to the DLQ with the given reason.
+func (q *Queue) reject(j *job.Job, lastError string, exhausted job.DeadReason) error {
+    from := j.State
     j.Attempts++
     j.LastError = lastError
 
     // -------------------------
-    // Load runtime config
+    // DLQ Check
     // -------------------------
 
-    maxRetriesStr, err := storage.ConfigGet(q.db, "max_retries")
-    maxRetries := j.MaxRetries // fallback = job value
-
-    if err == nil {
-        if v, convErr := strconv.Atoi(maxRetriesStr); convErr == nil {
-            maxRetries = v
-        }
+    maxRetries, _ := q.EffectiveMaxRetries(j)
+    if j.Attempts > maxRetries {
+        return q.moveToDead(j, from, exhausted, lastError)
     }
 
-    backoffBaseStr, err := storage.ConfigGet(q.db, "backoff_base")
-    backoffBase := 2 // default exponential base=2
+    return q.scheduleRetry(j, from, j.Attempts, lastError, lastError)
+}
 
-    if err == nil {
-        if v, convErr := strconv.Atoi(backoffBaseStr); convErr == nil {
-            backoffBase = v
-        }
+// EffectiveMaxRetries resolves the retry limit of j and names where it
+// came from. Precedence: the job's own --retries, then the
+// queue.<name>.max_retries config, then the global max_retries config,
+// then job.DefaultMaxRetries.
+func (q *Queue) EffectiveMaxRetries(j *job.Job) (int, string) {
+    if j.MaxRetries >= 0 {
+        return j.MaxRetries, "job"
     }
+    if n, ok := q.configInt("queue." + j.Queue + ".max_retries"); ok {
+        return n, "queue " + j.Queue
+    }
+    if n, ok := q.configInt("max_retries"); ok {
+        return n, "global"
+    }
+    return job.DefaultMaxRetries, "default"
+}
 
-    // -------------------------
-    // DLQ Check
-    // -------------------------
+func (q *Queue) configInt(key string) (int, bool) {
+    v, err := q.store.ConfigGet(key)
+    if err != nil || v == "" {
+        return 0, false
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n < 0 {
+        slog.Warn("invalid config value", "key", key, "value", v)
+        return 0, false
+    }
+    return n, true
+}
 
-    if j.Attempts > maxRetries {
-        // ensure legal transition: Running → Failed → Dead
-        if j.State == job.Running {
-            _ = j.UpdateState(job.Failed)
-        }
+// Fail handles a failed attempt according to the job's retry policy:
+// permanent failures go straight to the DLQ, "retry later" codes are
+// rescheduled without using up an attempt, and everything else is
+// handled like Reject. exitCode is negative when the command did not
+// exit on its own.
+func (q *Queue) Fail(j *job.Job, exitCode int, lastError string) error {
+    switch j.Retry.Classify(exitCode) {
+    case job.Permanent:
+        from := j.State
+        j.Attempts++
+        j.LastError = lastError
+        return q.moveToDead(j, from, job.ReasonPermanent, fmt.Sprintf("permanent failure (exit %d): %s", exitCode, lastError))
+    case job.RetryLater:
+        j.LastError = lastError
+        return q.scheduleRetry(j, j.State, j.Attempts+1, lastError, fmt.Sprintf("retry later (exit %d)", exitCode))
+    default:
+        return q.reject(j, lastError, job.ExhaustedReason(exitCode))
+    }
+}
 
-        if err := j.UpdateState(job.Dead); err != nil {
-            return err
-        }
+// moveToDead moves j to the DLQ, classified as why, and fires the
+// OnDead hook. reason is the free-form text for the events table.
+func (q *Queue) moveToDead(j *job.Job, from job.JobState, why job.DeadReason, reason string) error {
+    // ensure legal transition: Running → Failed → Dead
+    if j.State == job.Running {
+        _ = j.UpdateState(job.Failed)
+    }
 
-        j.UpdatedAt = time.Now().UTC()
-        return storage.MoveToDead(q.db, j)
+    if err := j.UpdateState(job.Dead); err != nil {
+        return err
     }
 
-    // -------------------------
-    // Retry Backoff Logic
-    // -------------------------
+    j.UpdatedAt = q.now().UTC()
+    if err := q.store.MoveToDead(j, why, q.event(j.ID, from, job.Dead, reason)); err != nil {
+        return err
+    }
+    metrics.JobsDead.Inc(j.Queue)
+    if q.onDead != nil {
+        q.onDead(j)
+    }
+    return nil
+}
 
-    // default exponential backoff logic with config base
-    // delay = base^(attempts-1)
-    delay := math.Pow(float64(backoffBase), float64(j.Attempts-1))
-    j.ScheduledAt = time.Now().UTC().Add(time.Duration(delay) * time.Second)
+// scheduleRetry puts j back in failed until its backoff delay for the
+// given attempt number has passed.
+func (q *Queue) scheduleRetry(j *job.Job, from job.JobState, attempt int, lastError, reason string) error {
+    j.LastError = lastError
+    j.RetryDelay = q.backoffFor(j).Delay(attempt, j.RetryDelay)
+    j.ScheduledAt = q.now().UTC().Add(j.RetryDelay)
 
     if err := j.UpdateState(job.Failed); err != nil {
         return err
     }
 
-    j.UpdatedAt = time.Now().UTC()
-    return storage.UpdateJob(q.db, j)
+    j.UpdatedAt = q.now().UTC()
+    if err := q.store.UpdateJob(j, q.event(j.ID, from, job.Failed, reason)); err != nil {
+        return err
+    }
+    metrics.JobsFailed.Inc(j.Queue)
+    return nil
 }
 
+// RetryDead requeues a DLQ entry and returns the id of the requeued job,
+// which is the original job id whenever it can be preserved. The entry
+// stays in the dead_jobs table, marked as replayed, so the job's
+// retried_from keeps pointing at it. With keepAttempts the job keeps its
+// attempt count, so a job that used up its retries gets one more try.
+func (q *Queue) RetryDead(deadJobID int, keepAttempts bool) (int64, error) {
+	d, err := q.liveDead(int64(deadJobID))
+	if err != nil {
+		return 0, err
+	}
+	reason := fmt.Sprintf("requeued from DLQ entry %d of job %d", d.ID, d.OrigID.Int64)
+	if keepAttempts {
+		reason += fmt.Sprintf(" keeping %d attempts", d.Attempts)
+	}
+	id, err := q.store.RetryDeadJob(int64(deadJobID), keepAttempts, q.event(0, job.Dead, job.Pending, reason))
+	if err != nil {
+		return 0, err
+	}
+	if q.onEnqueue != nil {
+		q.onEnqueue(id)
+	}
+	return id, nil
+}
 
+// EditDead saves a corrected command, queue or retry limit of a DLQ
+// entry, recording what changed against the original job.
+func (q *Queue) EditDead(d *storage.DeadJob) error {
+	old, err := q.liveDead(d.ID)
+	if err != nil {
+		return err
+	}
+	var changes []string
+	if d.Command != old.Command {
+		changes = append(changes, fmt.Sprintf("command %q -> %q", old.Command, d.Command))
+	}
+	if d.Queue != old.Queue {
+		changes = append(changes, fmt.Sprintf("queue %s -> %s", old.Queue, d.Queue))
+	}
+	if d.MaxRetries != old.MaxRetries {
+		changes = append(changes, fmt.Sprintf("max_retries %d -> %d", old.MaxRetries, d.MaxRetries))
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	reason := fmt.Sprintf("DLQ entry %d edited: %s", d.ID, strings.Join(changes, ", "))
+	return q.store.UpdateDeadJob(d, q.event(d.OrigID.Int64, job.Dead, job.Dead, reason))
+}
 
+// DeleteDead drops a DLQ entry without retrying it.
+func (q *Queue) DeleteDead(deadJobID int64) error {
+	d, err := q.liveDead(deadJobID)
+	if err != nil {
+		return err
+	}
+	reason := fmt.Sprintf("DLQ entry %d deleted", d.ID)
+	return q.store.DeleteDeadJob(deadJobID, q.event(d.OrigID.Int64, job.Dead, "deleted", reason))
+}
 
+// liveDead returns a DLQ entry that has not been retried yet. Replayed
+// entries are history: retrying, editing or deleting them again fails
+// with an error wrapping sql.ErrNoRows.
+func (q *Queue) liveDead(deadJobID int64) (*storage.DeadJob, error) {
+	d, err := q.store.GetDeadJob(deadJobID)
+	if err != nil {
+		return nil, fmt.Errorf("dead job id %d not found: %w", deadJobID, err)
+	}
+	if d.ReplayedAs.Valid {
+		return nil, fmt.Errorf("dead job id %d was already retried as job %d: %w", deadJobID, d.ReplayedAs.Int64, sql.ErrNoRows)
+	}
+	return d, nil
+}
 
+// fallbackMaxBackoff caps retry delays when max_backoff is set but cannot
+// be parsed, so a typo made outside `config set` does not remove the cap.
+const fallbackMaxBackoff = time.Hour
 
+// backoffFor picks the job's own strategy, then the global `backoff`
+// config, then the classic base^(attempts-1) seconds from backoff_base.
+// The global `max_backoff` config caps whichever applies.
+func (q *Queue) backoffFor(j *job.Job) backoff.Strategy {
+	spec := j.Backoff
+	if spec == "" {
+		spec, _ = q.store.ConfigGet("backoff")
+	}
 
+	var strategy backoff.Strategy
+	if spec != "" {
+		s, err := backoff.Parse(spec, q.rand)
+		if err != nil {
+			slog.Warn("invalid backoff, using backoff_base", "job_id", j.ID, "err", err)
+		}
+		strategy = s
+	}
+	if strategy == nil {
+		base := 2 // default exponential base=2
+		if v, err := q.store.ConfigGet("backoff_base"); err == nil {
+			if b, convErr := strconv.Atoi(v); convErr == nil {
+				base = b
+			}
+		}
+		strategy = backoff.Exponential{Base: float64(base), Unit: time.Second, Rand: q.rand}
+	}
+
+	if v, _ := q.store.ConfigGet("max_backoff"); v != "" {
+		limit, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Warn("invalid max_backoff, using fallback", "value", v, "fallback", fallbackMaxBackoff)
+			limit = fallbackMaxBackoff
+		}
+		strategy = backoff.WithMax(strategy, limit)
+	}
+	return strategy
+}
 
 func (q *Queue) Flush(kind string) error {
 	switch kind {
 	case "pending":
-		return storage.FlushPending(q.db)
+		return q.store.FlushPending()
 	case "dead":
-		return storage.FlushDead(q.db)
+		return q.store.FlushDead()
 	case "all":
-		return storage.FlushAll(q.db)
+		return q.store.FlushAll()
 	default:
 		return fmt.Errorf("unknown flush type: %s", kind)
 	}
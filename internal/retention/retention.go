@@ -0,0 +1,130 @@
+// Package retention deletes old completed jobs and DLQ entries in small
+// batches, either on demand or from a background loop in the worker.
+package retention
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"queuectl/internal/duration"
+	"queuectl/internal/storage"
+)
+
+// Kind is what gets pruned.
+type Kind string
+
+const (
+	Completed Kind = "completed"
+	Dead      Kind = "dead"
+)
+
+// Kinds lists every prunable kind in a fixed order.
+var Kinds = []Kind{Completed, Dead}
+
+const (
+	// DefaultBatch is how many rows one delete transaction removes.
+	DefaultBatch = 500
+	// pause between batches so workers can grab the write lock.
+	pause = 10 * time.Millisecond
+)
+
+// Store is what retention reads its config from and prunes. SQLiteStore
+// and PostgresStore implement it.
+type Store interface {
+	ConfigGet(key string) (string, error)
+	storage.Pruner
+}
+
+// ConfigKey is the config key holding the retention period of k, e.g.
+// retention.completed.
+func ConfigKey(k Kind) string {
+	return "retention." + string(k)
+}
+
+// Period returns the configured retention of k. ok is false when the key
+// is unset, meaning rows of that kind are kept forever.
+func Period(s Store, k Kind) (d time.Duration, ok bool, err error) {
+	v, err := s.ConfigGet(ConfigKey(k))
+	if err != nil {
+		return 0, false, fmt.Errorf("read %s: %w", ConfigKey(k), err)
+	}
+	if v == "" {
+		return 0, false, nil
+	}
+	d, err = duration.Parse(v)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", ConfigKey(k), err)
+	}
+	return d, true, nil
+}
+
+// Count returns how many rows of kind k are older than olderThan.
+func Count(s Store, k Kind, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	switch k {
+	case Completed:
+		return s.CountCompletedBefore(cutoff)
+	case Dead:
+		return s.CountDeadBefore(cutoff)
+	}
+	return 0, fmt.Errorf("unknown kind %q", k)
+}
+
+// Prune deletes rows of kind k older than olderThan, batch rows per
+// transaction, and returns how many it deleted.
+func Prune(s Store, k Kind, olderThan time.Duration, batch int) (int, error) {
+	pruneBatch := s.PruneCompletedBatch
+	switch k {
+	case Completed:
+	case Dead:
+		pruneBatch = s.PruneDeadBatch
+	default:
+		return 0, fmt.Errorf("unknown kind %q", k)
+	}
+	if batch <= 0 {
+		batch = DefaultBatch
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	total := 0
+	for {
+		n, err := pruneBatch(cutoff, batch)
+		total += n
+		if err != nil || n < batch {
+			return total, err
+		}
+		time.Sleep(pause)
+	}
+}
+
+// PruneConfigured prunes every kind that has a retention period set.
+func PruneConfigured(s Store) error {
+	for _, k := range Kinds {
+		period, ok, err := Period(s, k)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		n, err := Prune(s, k, period, DefaultBatch)
+		if err != nil {
+			return fmt.Errorf("prune %s: %w", k, err)
+		}
+		if n > 0 {
+			slog.Info("pruned old jobs", "kind", k, "deleted", n, "older_than", period)
+		}
+	}
+	return nil
+}
+
+// Run calls PruneConfigured every interval until the process exits.
+func Run(s Store, interval time.Duration) {
+	for {
+		if err := PruneConfigured(s); err != nil {
+			slog.Error("retention", "err", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,132 @@
+package retention
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+func TestPrune(t *testing.T) {
+	db, err := storage.OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := storage.NewSQLiteStore(db)
+
+	old := time.Now().Add(-48 * time.Hour)
+	insert := func(state job.JobState, at time.Time) int64 {
+		t.Helper()
+		j := job.NewJob("true", 0)
+		j.State, j.UpdatedAt = state, at
+		id, err := storage.InsertJob(db, j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.InsertJobLog(db, id, 1, 1, "output"); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	for i := 0; i < 7; i++ {
+		insert(job.Completed, old)
+	}
+	recent := insert(job.Completed, time.Now())
+	pending := insert(job.Pending, old)
+
+	if n, err := Count(store, Completed, 24*time.Hour); err != nil || n != 7 {
+		t.Fatalf("count = %d, %v; want 7", n, err)
+	}
+	if n, err := Prune(store, Completed, 24*time.Hour, 3); err != nil || n != 7 {
+		t.Fatalf("pruned %d, %v; want 7", n, err)
+	}
+	for _, id := range []int64{recent, pending} {
+		if _, err := storage.GetJobByID(db, id); err != nil {
+			t.Errorf("job %d was pruned: %v", id, err)
+		}
+		if logs, _ := storage.ListJobLogs(db, id); len(logs) != 1 {
+			t.Errorf("job %d lost its logs", id)
+		}
+	}
+	if logs, _ := storage.ListJobLogs(db, 1); len(logs) != 0 {
+		t.Errorf("pruned job 1 still has %d logs", len(logs))
+	}
+}
+
+func TestPruneConfigured(t *testing.T) {
+	db, err := storage.OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := storage.NewSQLiteStore(db)
+
+	for i := 0; i < 2; i++ {
+		j := job.NewJob("false", 0)
+		if j.ID, err = storage.InsertJob(db, j); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.MoveToDead(db, j, job.ReasonMaxRetries); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// age the first DLQ entry
+	if _, err := db.Exec(`UPDATE dead_jobs SET failed_at = ? WHERE id = 1`,
+		time.Now().Add(-40*24*time.Hour).UTC().Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is pruned without a retention period
+	if err := PruneConfigured(store); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := storage.CountJobsByState(db, job.Dead); n != 2 {
+		t.Fatalf("dead jobs = %d, want 2", n)
+	}
+
+	if err := storage.ConfigSet(db, ConfigKey(Dead), "30d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PruneConfigured(store); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := storage.ListDeadJobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].ID != 2 {
+		t.Errorf("after pruning: %+v, want only DLQ entry 2", ds)
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	db, err := storage.OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewSQLiteStore(db)
+	if _, ok, err := Period(store, Completed); ok || err != nil {
+		t.Errorf("unset: ok=%v err=%v, want not set", ok, err)
+	}
+	if err := storage.ConfigSet(db, ConfigKey(Completed), "7d"); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok, err := Period(store, Completed); !ok || err != nil || d != 7*24*time.Hour {
+		t.Errorf("7d: %s ok=%v err=%v", d, ok, err)
+	}
+	if err := storage.ConfigSet(db, ConfigKey(Completed), "soon"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Period(store, Completed); err == nil {
+		t.Error("invalid period: no error")
+	}
+
+	// a failing read is an error, not "keep forever"
+	db.Close()
+	if _, _, err := Period(store, Dead); err == nil {
+		t.Error("closed database: no error")
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// CompletedJobsBefore pages through completed jobs last updated before t,
+// returning up to limit jobs with an id greater than afterID.
+func CompletedJobsBefore(db *sql.DB, t time.Time, afterID int64, limit int) ([]job.Job, error) {
+	rows, err := db.Query(`SELECT `+jobColumns+` FROM jobs
+		WHERE state = ? AND updated_at < ? AND id > ? ORDER BY id LIMIT ?`,
+		string(job.Completed), formatTime(t), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []job.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *j)
+	}
+	return out, rows.Err()
+}
+
+// DeadJobsBefore pages through DLQ entries that failed before t. Replayed
+// entries are history of a live job and are left to retention.
+func DeadJobsBefore(db *sql.DB, t time.Time, afterID int64, limit int) ([]DeadJob, error) {
+	rows, err := db.Query(`SELECT `+deadJobColumns+` FROM dead_jobs
+		WHERE failed_at < ? AND id > ? AND replayed_as IS NULL ORDER BY id LIMIT ?`,
+		formatTime(t), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DeadJob
+	for rows.Next() {
+		d, err := scanDeadJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// DeleteCompletedJobs deletes the given jobs, if still completed, and
+// their logs in one transaction.
+func DeleteCompletedJobs(db *sql.DB, ids []int64) (int, error) {
+	victims := make([]victim, len(ids))
+	for i, id := range ids {
+		victims[i] = victim{id: id, jobID: nullID(id)}
+	}
+	return deleteVictims(db, `DELETE FROM jobs WHERE id = ? AND state = 'completed'`, victims)
+}
+
+// DeleteDeadJobs deletes the given DLQ entries and, unless a live job
+// reuses the id, their logs in one transaction.
+func DeleteDeadJobs(db *sql.DB, entries []DeadJob) (int, error) {
+	victims := make([]victim, len(entries))
+	for i, d := range entries {
+		victims[i] = victim{id: d.ID, jobID: d.OrigID}
+	}
+	return deleteVictims(db, `DELETE FROM dead_jobs WHERE id = ?`, victims)
+}
+
+// ArchivedJob is a row of archived_jobs: a completed job or DLQ entry
+// restored from an archive file. Record holds the full archived JSON,
+// including logs and events.
+type ArchivedJob struct {
+	Kind       string // "completed" or "dead"
+	ID         int64  // jobs.id or dead_jobs.id at archive time
+	JobID      int64
+	Queue      string
+	Command    string
+	State      string
+	Attempts   int
+	CreatedAt  time.Time
+	FinishedAt time.Time
+	LastError  string
+	Record     string
+}
+
+// InsertArchivedJob stores a restored archive record. Records that were
+// already restored are skipped; it reports whether a row was added.
+func InsertArchivedJob(db *sql.DB, a ArchivedJob) (bool, error) {
+	res, err := db.Exec(`INSERT OR IGNORE INTO archived_jobs(kind, id, job_id, queue, command, state, attempts,
+            created_at, finished_at, last_error, record, restored_at)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`,
+		a.Kind, a.ID, a.JobID, a.Queue, a.Command, a.State, a.Attempts,
+		formatTime(a.CreatedAt), formatTime(a.FinishedAt), a.LastError, a.Record,
+		formatTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ArchivedJobsByJobID returns the restored archive records of a job.
+func ArchivedJobsByJobID(db *sql.DB, jobID int64) ([]ArchivedJob, error) {
+	rows, err := db.Query(`SELECT kind, id, job_id, queue, command, state, attempts, created_at, finished_at, last_error, record
+		FROM archived_jobs WHERE job_id = ? ORDER BY finished_at`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ArchivedJob
+	for rows.Next() {
+		var a ArchivedJob
+		var lastErr sql.NullString
+		if err := rows.Scan(&a.Kind, &a.ID, &a.JobID, &a.Queue, &a.Command, &a.State, &a.Attempts,
+			&a.CreatedAt, &a.FinishedAt, &lastErr, &a.Record); err != nil {
+			return nil, err
+		}
+		a.LastError = lastErr.String
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup writes a consistent, compacted copy of db to path with VACUUM
+// INTO, which is safe while workers keep writing. The copy is stamped
+// with the schema version of db (as PRAGMA user_version, so it can be
+// read without trusting the tables) and checked with PRAGMA
+// integrity_check.
+func Backup(db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	version, err := CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("vacuum into %s: %w", path, err)
+	}
+
+	snap, err := sql.Open("sqlite3", fileURI(path, ""))
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+	if _, err := snap.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		return err
+	}
+	return IntegrityCheck(snap)
+}
+
+// fileURI turns path into a SQLite URI filename with the given query,
+// escaping characters such as ? and # that would otherwise start the
+// query or fragment.
+func fileURI(path, query string) string {
+	u := url.URL{Scheme: "file", Path: path, RawQuery: query}
+	return u.String()
+}
+
+// IntegrityCheck runs PRAGMA integrity_check and returns the problems it
+// reports, if any.
+func IntegrityCheck(db *sql.DB) error {
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// InspectSnapshot opens the backup at path read-only, verifies its
+// integrity and returns the schema version it was stamped with (0 for
+// a file not made by Backup).
+func InspectSnapshot(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	snap, err := sql.Open("sqlite3", fileURI(path, "mode=ro"))
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Close()
+
+	if err := IntegrityCheck(snap); err != nil {
+		return 0, err
+	}
+	var version int
+	if err := snap.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Restore replaces the contents of db with the backup at path using the
+// SQLite online backup API, so other open connections see the restored
+// data rather than a half-copied file, then migrates it to the latest
+// version. It returns the schema version the snapshot was stamped with.
+// Callers must make sure no workers are running. db may be limited to a
+// single connection, such as SQLiteStore.Writer.
+func Restore(db *sql.DB, path string) (int, error) {
+	version, err := InspectSnapshot(path)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if version > LatestVersion() {
+		return 0, fmt.Errorf("%s has schema version %d, this build supports %d: %w", path, version, LatestVersion(), ErrNewerSchema)
+	}
+
+	src, err := sql.Open("sqlite3", fileURI(path, "mode=ro"))
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer srcConn.Close()
+	dstConn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// the backup API copies pages verbatim, so the snapshot checked by
+	// InspectSnapshot is what db now holds
+	err = dstConn.Raw(func(dst any) error {
+		return srcConn.Raw(func(src any) error {
+			b, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+	// Migrate needs a connection of its own
+	dstConn.Close()
+	if err != nil {
+		return 0, fmt.Errorf("restore from %s: %w", path, err)
+	}
+	return version, Migrate(db)
+}
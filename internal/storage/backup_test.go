@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDB(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	keep, err := InsertJob(db, job.NewJob("echo keep", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := filepath.Join(dir, "snap.db")
+	if err := Backup(db, snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := Backup(db, snap); err == nil {
+		t.Error("backup overwrote an existing file")
+	}
+	if v, err := InspectSnapshot(snap); err != nil || v != LatestVersion() {
+		t.Fatalf("snapshot version %d, %v; want %d", v, err, LatestVersion())
+	}
+
+	// changes after the backup disappear on restore
+	if err := FlushAll(db); err != nil {
+		t.Fatal(err)
+	}
+	lost, err := InsertJob(db, job.NewJob("echo lost", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Restore(db, snap); err != nil || v != LatestVersion() {
+		t.Fatalf("restore: version %d, %v", v, err)
+	}
+	if j, err := GetJobByID(db, keep); err != nil || j.Command != "echo keep" {
+		t.Errorf("job %d after restore: %+v, %v", keep, j, err)
+	}
+	if _, err := GetJobByID(db, lost); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("job %d inserted after the backup survived the restore", lost)
+	}
+}
+
+func TestRestoreThroughWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.db")
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	snap := filepath.Join(dir, "snap.db")
+	if err := Backup(db, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy's connection must be released before migrating, or a
+	// single-connection writer waits for itself
+	writer, err := OpenWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := Restore(writer, snap)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("restore through the writer did not finish")
+	}
+}
+
+func TestRestoreRefusesBadSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDB(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	newer := filepath.Join(dir, "newer.db")
+	if err := Backup(db, newer); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := sql.Open("sqlite3", newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snap.Exec(`PRAGMA user_version = 999`); err != nil {
+		t.Fatal(err)
+	}
+	snap.Close()
+	if _, err := Restore(db, newer); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("restore of a newer snapshot: %v, want ErrNewerSchema", err)
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database, just some bytes that are long enough"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(db, garbage); err == nil {
+		t.Error("restored a file that is not a database")
+	}
+}
+
+func TestBackupOddPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a?b#c")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	snap := filepath.Join(dir, "snap?mode=rw#x.db")
+	if err := Backup(db, snap); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(snap); err != nil {
+		t.Fatalf("snapshot not written at %s: %v", snap, err)
+	}
+	if v, err := Restore(db, snap); err != nil || v != LatestVersion() {
+		t.Fatalf("restore: version %d, %v", v, err)
+	}
+}
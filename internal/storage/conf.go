@@ -11,7 +11,7 @@ func ConfigSet(db *sql.DB, key, value string) error {
 	return err
 }
 
-func ConfigGet(db *sql.DB, key string) (string, error) {
+func ConfigGet(db queryer, key string) (string, error) {
 	var val string
 	err := db.QueryRow(`SELECT value FROM config WHERE key=?`, key).Scan(&val)
 	if err == sql.ErrNoRows {
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// Event records one state transition of a job for auditing.
+type Event struct {
+	ID        int64
+	JobID     int64
+	From      string
+	To        string
+	Actor     string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// EventFilter narrows ListEvents. Zero values match everything.
+type EventFilter struct {
+	JobID   int64
+	Since   time.Time
+	AfterID int64
+}
+
+// InsertEvent appends a transition to the events table.
+func InsertEvent(db queryer, e Event) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	_, err := db.Exec(`INSERT INTO events(job_id, from_state, to_state, actor, reason, created_at)
+        VALUES(?,?,?,?,?,?)`,
+		e.JobID, e.From, e.To, e.Actor, e.Reason, formatTime(e.CreatedAt),
+	)
+	return err
+}
+
+// insertEvents records the audit events of a state change inside the
+// change's transaction, so the two commit or roll back together. Events
+// whose JobID is 0 are about jobID, the job the change created or
+// claimed.
+func insertEvents(db queryer, jobID int64, evs []Event) error {
+	for _, e := range about(jobID, evs) {
+		if err := InsertEvent(db, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// about returns evs with a JobID of 0 replaced by jobID.
+func about(jobID int64, evs []Event) []Event {
+	out := make([]Event, len(evs))
+	for i, e := range evs {
+		if e.JobID == 0 {
+			e.JobID = jobID
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// claimed returns the events of claiming j: about j, and coming from
+// the state j was claimed from unless the caller said otherwise.
+func claimed(j *job.Job, evs []Event) []Event {
+	out := about(j.ID, evs)
+	for i := range out {
+		if out[i].From == "" {
+			out[i].From = string(j.ClaimedFrom())
+		}
+	}
+	return out
+}
+
+// requeued returns the events of requeueing a DLQ entry of origID as
+// newID: recorded against the requeued job, and against the original
+// one too when the requeued job could not keep its id, so its history
+// still shows who retried it.
+func requeued(origID, newID int64, evs []Event) []Event {
+	out := about(newID, evs)
+	if origID != 0 && origID != newID {
+		out = append(out, about(origID, evs)...)
+	}
+	return out
+}
+
+// ListEvents returns matching events, oldest first.
+func ListEvents(db *sql.DB, f EventFilter) ([]Event, error) {
+	query := `SELECT id, job_id, from_state, to_state, actor, reason, created_at FROM events WHERE id > ?`
+	args := []any{f.AfterID}
+	if f.JobID != 0 {
+		query += ` AND job_id = ?`
+		args = append(args, f.JobID)
+	}
+	if !f.Since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, formatTime(f.Since))
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Event
+	for rows.Next() {
+		var e Event
+		var reason sql.NullString
+		if err := rows.Scan(&e.ID, &e.JobID, &e.From, &e.To, &e.Actor, &reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Reason = reason.String
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// QueueOutcomes counts finished attempts of one queue.
+type QueueOutcomes struct {
+	Completed int
+	Failed    int // includes attempts that moved the job to the DLQ
+}
+
+// OutcomesSince tallies completed and failed attempts per queue from the
+// events table.
+func OutcomesSince(db *sql.DB, since time.Time) (map[string]QueueOutcomes, error) {
+	rows, err := db.Query(`
+        SELECT COALESCE(j.queue, d.queue, 'default'), e.to_state, COUNT(*)
+        FROM events e
+        LEFT JOIN jobs j ON j.id = e.job_id
+        LEFT JOIN dead_jobs d ON d.orig_id = e.job_id AND j.id IS NULL AND d.replayed_as IS NULL
+        WHERE e.created_at >= ? AND e.to_state IN ('completed', 'failed', 'dead')
+        GROUP BY 1, 2`, formatTime(since))
+	if err != nil {
+		return nil, err
+	}
+	return scanOutcomes(rows)
+}
+
+// scanOutcomes reads (queue, to_state, count) rows into QueueOutcomes.
+func scanOutcomes(rows *sql.Rows) (map[string]QueueOutcomes, error) {
+	defer rows.Close()
+
+	out := map[string]QueueOutcomes{}
+	for rows.Next() {
+		var queue, state string
+		var n int
+		if err := rows.Scan(&queue, &state, &n); err != nil {
+			return nil, err
+		}
+		o := out[queue]
+		if state == "completed" {
+			o.Completed += n
+		} else {
+			o.Failed += n
+		}
+		out[queue] = o
+	}
+	return out, rows.Err()
+}
@@ -11,6 +11,10 @@ import (
 func CountJobsByState(db *sql.DB, state job.JobState) (int, error) {
     var count int
     row := db.QueryRow("SELECT COUNT(*) FROM jobs WHERE state = ?", string(state))
+    if state == job.Dead {
+        // dead jobs are moved out of jobs into the DLQ table
+        row = db.QueryRow("SELECT COUNT(*) FROM dead_jobs WHERE replayed_as IS NULL")
+    }
     if err := row.Scan(&count); err != nil {
         return 0, err
     }
@@ -20,20 +24,48 @@ func CountJobsByState(db *sql.DB, state job.JobState) (int, error) {
 
 func GetNextScheduledJob(db *sql.DB) (*job.Job, error) {
     row := db.QueryRow(`
-        SELECT id, command, attempts, max_retries, state, scheduled_at, created_at, updated_at, last_error
+        SELECT ` + jobColumns + `
         FROM jobs
         WHERE state = 'pending'
         ORDER BY scheduled_at ASC
         LIMIT 1
     `)
+    return scanJob(row)
+}
 
-    var j job.Job
-    err := row.Scan(
-        &j.ID, &j.Command, &j.Attempts, &j.MaxRetries, &j.State, &j.ScheduledAt,
-        &j.CreatedAt, &j.UpdatedAt, &j.LastError,
-    )
+// CountJobsByQueue returns job counts keyed by queue name and state,
+// including dead jobs from the DLQ.
+func CountJobsByQueue(db *sql.DB) (map[string]map[job.JobState]int, error) {
+    rows, err := db.Query(`
+        SELECT queue, state, COUNT(*) FROM jobs GROUP BY queue, state
+        UNION ALL
+        SELECT queue, 'dead', COUNT(*) FROM dead_jobs WHERE replayed_as IS NULL GROUP BY queue
+    `)
     if err != nil {
         return nil, err
     }
-    return &j, nil
+    defer rows.Close()
+
+    out := map[string]map[job.JobState]int{}
+    for rows.Next() {
+        var queue, state string
+        var n int
+        if err := rows.Scan(&queue, &state, &n); err != nil {
+            return nil, err
+        }
+        if out[queue] == nil {
+            out[queue] = map[job.JobState]int{}
+        }
+        out[queue][job.JobState(state)] += n
+    }
+    return out, rows.Err()
+}
+
+
+// JobsEnqueuedTotal returns how many jobs were ever inserted, based on the
+// AUTOINCREMENT sequence, so it keeps growing after jobs are deleted.
+func JobsEnqueuedTotal(db *sql.DB) (int64, error) {
+    var n int64
+    err := db.QueryRow(`SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'jobs'), 0)`).Scan(&n)
+    return n, err
 }
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// JobLog is the captured output of a single job attempt.
+type JobLog struct {
+	ID        int64
+	JobID     int64
+	Attempt   int
+	WorkerID  int
+	Output    string
+	CreatedAt time.Time
+}
+
+// InsertJobLog stores the output of one attempt of a job.
+func InsertJobLog(db queryer, jobID int64, attempt, workerID int, output string) error {
+	_, err := db.Exec(`INSERT INTO job_logs(job_id, attempt, worker_id, output, created_at)
+        VALUES(?,?,?,?,?)`,
+		jobID, attempt, workerID, output, formatTime(time.Now()),
+	)
+	return err
+}
+
+// ListJobLogs returns all logged attempts of a job, oldest first.
+func ListJobLogs(db *sql.DB, jobID int64) ([]JobLog, error) {
+	rows, err := db.Query(`SELECT id, job_id, attempt, worker_id, output, created_at
+        FROM job_logs WHERE job_id=? ORDER BY id`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []JobLog
+	for rows.Next() {
+		var l JobLog
+		var workerID sql.NullInt64
+		var output sql.NullString
+		if err := rows.Scan(&l.ID, &l.JobID, &l.Attempt, &workerID, &output, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		l.WorkerID = int(workerID.Int64)
+		l.Output = output.String
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,566 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// MemoryStore is a Store that keeps everything in process memory. It is
+// safe for concurrent use and starts with no config, so every setting
+// falls back to its built-in default.
+type MemoryStore struct {
+	mu      sync.Mutex
+	jobs    map[int64]*job.Job
+	dead    map[int64]*deadEntry
+	config  map[string]string
+	events  []Event
+	logs    []JobLog
+	workers map[int]WorkerStatus
+
+	lastJobID  int64
+	lastDeadID int64
+}
+
+// deadEntry keeps the whole job next to its DLQ row so RetryDeadJob can
+// restore the backoff and retry policy.
+type deadEntry struct {
+	DeadJob
+	job job.Job
+}
+
+// live returns the entries still in the DLQ, leaving out the replayed
+// ones kept as history. m.mu must be held.
+func (m *MemoryStore) live() map[int64]*deadEntry {
+	out := make(map[int64]*deadEntry, len(m.dead))
+	for id, d := range m.dead {
+		if !d.ReplayedAs.Valid {
+			out[id] = d
+		}
+	}
+	return out
+}
+
+// liveEntry looks up an entry still in the DLQ. m.mu must be held.
+func (m *MemoryStore) liveEntry(id int64) (*deadEntry, bool) {
+	d, ok := m.dead[id]
+	if !ok || d.ReplayedAs.Valid {
+		return nil, false
+	}
+	return d, true
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:    map[int64]*job.Job{},
+		dead:    map[int64]*deadEntry{},
+		config:  map[string]string{},
+		workers: map[int]WorkerStatus{},
+	}
+}
+
+// stamp rounds t the way the SQLite store stores timestamps, so both
+// stores order and compare jobs the same.
+func stamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+func (m *MemoryStore) InsertJob(j *job.Job, evs ...Event) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastJobID++
+	c := *j
+	c.ID = m.lastJobID
+	c.CreatedAt, c.UpdatedAt, c.ScheduledAt = stamp(j.CreatedAt), stamp(j.UpdatedAt), stamp(j.ScheduledAt)
+	c.RetryDelay, c.RetriedFrom, c.Replays, c.WorkerID = 0, 0, 0, 0
+	c.Tags = slices.Clone(j.Tags)
+	m.jobs[c.ID] = &c
+	m.record(about(c.ID, evs))
+	return c.ID, nil
+}
+
+func (m *MemoryStore) GetJob(id int64) (*job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *j
+	return &c, nil
+}
+
+func (m *MemoryStore) ClaimJob(workerID int, evs ...Event) (*job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.claim(workerID)
+	if err != nil {
+		return nil, err
+	}
+	if workerID != 0 {
+		m.workers[workerID] = WorkerStatus{ID: workerID, State: "running", CurrentJobID: j.ID, UpdatedAt: time.Now().UTC()}
+	}
+	m.record(claimed(j, evs))
+	return j, nil
+}
+
+// claim marks the oldest due job running for workerID. m.mu must be held.
+func (m *MemoryStore) claim(workerID int) (*job.Job, error) {
+	now := time.Now().UTC()
+	var next *job.Job
+	for _, j := range m.jobs {
+		if (j.State != job.Pending && j.State != job.Failed) || j.ScheduledAt.After(now) {
+			continue
+		}
+		if next == nil || j.ID < next.ID {
+			next = j
+		}
+	}
+	if next == nil {
+		return nil, ErrNoJob
+	}
+	next.State = job.Running
+	next.UpdatedAt = stamp(now)
+	next.WorkerID = workerID
+	c := *next
+	c.UpdatedAt = now
+	return &c, nil
+}
+
+func (m *MemoryStore) ClaimJobs(n, workerID int, evs ...Event) ([]*job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := []*job.Job{}
+	for len(jobs) < n {
+		j, err := m.claim(workerID)
+		if err == ErrNoJob {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.record(claimed(j, evs))
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStore) UpdateJob(j *job.Job, evs ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.jobs[j.ID]; ok {
+		cur.State, cur.Attempts, cur.LastError = j.State, j.Attempts, j.LastError
+		cur.ScheduledAt, cur.UpdatedAt = stamp(j.ScheduledAt), stamp(j.UpdatedAt)
+		cur.RetryDelay = j.RetryDelay.Truncate(time.Millisecond)
+		cur.WorkerID = 0
+		if j.State == job.Running {
+			cur.WorkerID = j.WorkerID
+		}
+	}
+	m.record(about(j.ID, evs))
+	return nil
+}
+
+func (m *MemoryStore) StaleJobs(cutoff time.Time) ([]job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sortedJobs(func(j *job.Job) bool {
+		if j.State != job.Running || !j.UpdatedAt.Before(cutoff) {
+			return false
+		}
+		w, ok := m.workers[j.WorkerID]
+		return !ok || w.UpdatedAt.Before(cutoff)
+	}), nil
+}
+
+// sortedJobs returns copies of the jobs matching keep, ordered by id.
+func (m *MemoryStore) sortedJobs(keep func(*job.Job) bool) []job.Job {
+	var out []job.Job
+	for _, j := range m.jobs {
+		if keep(j) {
+			out = append(out, *j)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+func (m *MemoryStore) ListJobs(state job.JobState) ([]job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sortedJobs(func(j *job.Job) bool { return j.State == state }), nil
+}
+
+func (m *MemoryStore) FindJobs(f JobFilter) ([]job.Job, error) {
+	if err := f.Check(); err != nil {
+		return nil, err
+	}
+	var re *regexp.Regexp
+	if f.CommandRegexp != "" {
+		re = regexp.MustCompile(f.CommandRegexp)
+	}
+	var afterKey, afterID int64
+	if f.After != "" {
+		afterKey, afterID, _ = f.Sort.decodeCursor(f.After)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := m.sortedJobs(func(j *job.Job) bool {
+		switch {
+		case f.State != "" && j.State != f.State,
+			f.Queue != "" && j.Queue != f.Queue,
+			f.Command != "" && !strings.Contains(j.Command, f.Command),
+			re != nil && !re.MatchString(j.Command),
+			f.Error != "" && !strings.Contains(j.LastError, f.Error),
+			f.Tag != "" && !slices.Contains(j.Tags, f.Tag),
+			j.Attempts < f.MinAttempts,
+			!f.CreatedAfter.IsZero() && j.CreatedAt.Before(stamp(f.CreatedAfter)),
+			!f.CreatedBefore.IsZero() && !j.CreatedAt.Before(stamp(f.CreatedBefore)),
+			!f.UpdatedAfter.IsZero() && j.UpdatedAt.Before(stamp(f.UpdatedAfter)),
+			!f.UpdatedBefore.IsZero() && !j.UpdatedAt.Before(stamp(f.UpdatedBefore)):
+			return false
+		}
+		return f.After == "" || f.Sort.compare(f.Sort.key(j), j.ID, afterKey, afterID) > 0
+	})
+	sort.Slice(out, func(a, b int) bool {
+		return f.Sort.compare(f.Sort.key(&out[a]), out[a].ID, f.Sort.key(&out[b]), out[b].ID) < 0
+	})
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) NextScheduledJob() (*job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *job.Job
+	for _, j := range m.jobs {
+		if j.State != job.Pending {
+			continue
+		}
+		if next == nil || j.ScheduledAt.Before(next.ScheduledAt) || j.ScheduledAt.Equal(next.ScheduledAt) && j.ID < next.ID {
+			next = j
+		}
+	}
+	if next == nil {
+		return nil, sql.ErrNoRows
+	}
+	c := *next
+	return &c, nil
+}
+
+func (m *MemoryStore) CountJobs(state job.JobState) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state == job.Dead {
+		return len(m.live()), nil
+	}
+	n := 0
+	for _, j := range m.jobs {
+		if j.State == state {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) CountJobsByQueue() (map[string]map[job.JobState]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string]map[job.JobState]int{}
+	add := func(queue string, state job.JobState) {
+		if out[queue] == nil {
+			out[queue] = map[job.JobState]int{}
+		}
+		out[queue][state]++
+	}
+	for _, j := range m.jobs {
+		add(j.Queue, j.State)
+	}
+	for _, d := range m.live() {
+		add(d.Queue, job.Dead)
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) FlushPending() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, j := range m.jobs {
+		if j.State == job.Pending {
+			delete(m.jobs, id)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) FlushAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = map[int64]*job.Job{}
+	m.dead = map[int64]*deadEntry{}
+	return nil
+}
+
+func (m *MemoryStore) MoveToDead(j *job.Job, reason job.DeadReason, evs ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[j.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	m.lastDeadID++
+	m.dead[m.lastDeadID] = &deadEntry{
+		DeadJob: DeadJob{
+			ID:          m.lastDeadID,
+			OrigID:      sql.NullInt64{Int64: j.ID, Valid: true},
+			Command:     j.Command,
+			Attempts:    j.Attempts,
+			MaxRetries:  j.MaxRetries,
+			CreatedAt:   stamp(j.CreatedAt),
+			FailedAt:    stamp(time.Now()),
+			LastError:   sql.NullString{String: j.LastError, Valid: true},
+			Queue:       j.Queue,
+			RetriedFrom: nullID(j.RetriedFrom),
+			Replays:     j.Replays,
+			Reason:      reason,
+			Tags:        slices.Clone(j.Tags),
+		},
+		job: *j,
+	}
+	delete(m.jobs, j.ID)
+	m.record(about(j.ID, evs))
+	return nil
+}
+
+func (m *MemoryStore) GetDeadJob(id int64) (*DeadJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.dead[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := d.DeadJob
+	return &c, nil
+}
+
+func (m *MemoryStore) FindDeadJobs(f DeadJobFilter) ([]DeadJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []DeadJob
+	for _, d := range m.live() {
+		switch {
+		case f.Command != "" && !strings.Contains(d.Command, f.Command),
+			f.Queue != "" && d.Queue != f.Queue,
+			f.Error != "" && !strings.Contains(d.LastError.String, f.Error),
+			f.Reason != "" && d.Reason != f.Reason,
+			!f.Since.IsZero() && d.FailedAt.Before(stamp(f.Since)):
+			continue
+		}
+		out = append(out, d.DeadJob)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out, nil
+}
+
+func (m *MemoryStore) RetryDeadJob(id int64, keepAttempts bool, evs ...Event) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.liveEntry(id)
+	if !ok {
+		return 0, fmt.Errorf("dead job id %d not found: %w", id, sql.ErrNoRows)
+	}
+
+	newID := d.OrigID.Int64
+	if _, taken := m.jobs[newID]; !d.OrigID.Valid || taken {
+		newID = m.lastJobID + 1
+	}
+	m.lastJobID = max(m.lastJobID, newID)
+
+	attempts := 0
+	if keepAttempts {
+		attempts = d.Attempts
+	}
+	now := stamp(time.Now())
+	m.jobs[newID] = &job.Job{
+		ID:          newID,
+		Command:     d.Command,
+		State:       job.Pending,
+		Attempts:    attempts,
+		MaxRetries:  d.MaxRetries,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   now,
+		ScheduledAt: now,
+		Queue:       d.Queue,
+		Backoff:     d.job.Backoff,
+		Retry:       d.job.Retry,
+		RetriedFrom: id,
+		Replays:     d.Replays + 1,
+		Tags:        d.Tags,
+	}
+	d.ReplayedAs = nullID(newID)
+	m.record(requeued(d.OrigID.Int64, newID, evs))
+	return newID, nil
+}
+
+func (m *MemoryStore) UpdateDeadJob(d *DeadJob, evs ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.liveEntry(d.ID)
+	if !ok {
+		return fmt.Errorf("dead job id %d not found: %w", d.ID, sql.ErrNoRows)
+	}
+	cur.Command, cur.Queue, cur.MaxRetries = d.Command, d.Queue, d.MaxRetries
+	m.record(evs)
+	return nil
+}
+
+func (m *MemoryStore) DeleteDeadJob(id int64, evs ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.liveEntry(id); !ok {
+		return fmt.Errorf("dead job id %d not found: %w", id, sql.ErrNoRows)
+	}
+	delete(m.dead, id)
+	m.record(evs)
+	return nil
+}
+
+func (m *MemoryStore) MarkEscalated(id int64, evs ...Event) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.liveEntry(id)
+	if !ok || d.Escalated {
+		return false, nil
+	}
+	d.Escalated = true
+	m.record(evs)
+	return true, nil
+}
+
+func (m *MemoryStore) FlushDead() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dead = map[int64]*deadEntry{}
+	return nil
+}
+
+func (m *MemoryStore) ConfigGet(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.config[key], nil
+}
+
+func (m *MemoryStore) ConfigSet(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config[key] = value
+	return nil
+}
+
+func (m *MemoryStore) ConfigList() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]string, len(m.config))
+	for k, v := range m.config {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) InsertEvent(e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record([]Event{e})
+	return nil
+}
+
+// record appends evs to the audit log. m.mu must be held.
+func (m *MemoryStore) record(evs []Event) {
+	for _, e := range evs {
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now()
+		}
+		e.ID = int64(len(m.events)) + 1
+		e.CreatedAt = stamp(e.CreatedAt)
+		m.events = append(m.events, e)
+	}
+}
+
+func (m *MemoryStore) ListEvents(f EventFilter) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Event
+	for _, e := range m.events {
+		switch {
+		case e.ID <= f.AfterID,
+			f.JobID != 0 && e.JobID != f.JobID,
+			!f.Since.IsZero() && e.CreatedAt.Before(stamp(f.Since)):
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) InsertJobLog(jobID int64, attempt, workerID int, output string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logs = append(m.logs, JobLog{
+		ID: int64(len(m.logs)) + 1, JobID: jobID, Attempt: attempt, WorkerID: workerID, Output: output, CreatedAt: stamp(time.Now()),
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListJobLogs(jobID int64) ([]JobLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []JobLog
+	for _, l := range m.logs {
+		if l.JobID == jobID {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// RegisterWorker hands out one past the highest worker id seen.
+func (m *MemoryStore) RegisterWorker() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := 1
+	for w := range m.workers {
+		id = max(id, w+1)
+	}
+	m.workers[id] = WorkerStatus{ID: id, State: "idle", UpdatedAt: time.Now().UTC()}
+	return id, nil
+}
+
+func (m *MemoryStore) UpdateWorkerStatus(id int, state string, jobID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workers[id] = WorkerStatus{ID: id, State: state, CurrentJobID: jobID, UpdatedAt: time.Now().UTC()}
+	return nil
+}
+
+func (m *MemoryStore) ListWorkers() ([]WorkerStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]WorkerStatus, 0, len(m.workers))
+	for _, w := range m.workers {
+		out = append(out, w)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out, nil
+}
+
+// Close is a no-op; the store lives as long as the process.
+func (m *MemoryStore) Close() error { return nil }
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNewerSchema is returned when a snapshot or database was written by
+// a newer queuectl than this one.
+var ErrNewerSchema = errors.New("schema is newer than this queuectl understands")
+
+// Migration is one step of the schema history, loaded from
+// migrations/NNNN_name.up.sql and its optional .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty when the migration cannot be rolled back
+
+	// NoTx is set by a "-- queuectl:no-transaction" line in Up. Such
+	// steps run one statement at a time outside a transaction, as
+	// CREATE INDEX CONCURRENTLY requires, so they must be safe to rerun.
+	// Only the Postgres runner supports them.
+	NoTx bool
+
+	// after runs on the migrating connection, inside the same
+	// transaction, once Up has been applied.
+	after func(ctx context.Context, conn *sql.Conn) error
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations is the ordered SQLite schema history compiled into this
+// build.
+var Migrations = sqliteMigrations()
+
+// LatestVersion is the newest schema version this build understands.
+func LatestVersion() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// noTxMarker marks a migration that must run outside a transaction.
+const noTxMarker = "-- queuectl:no-transaction"
+
+func sqliteMigrations() []Migration {
+	ms := mustLoadMigrations(migrationFiles, "migrations")
+	for _, m := range ms {
+		if m.NoTx {
+			panic(fmt.Sprintf("migration %d_%s: SQLite migrations always run in a transaction", m.Version, m.Name))
+		}
+	}
+	ms[0].after = addLegacyColumns
+	return ms
+}
+
+func mustLoadMigrations(fsys fs.FS, dir string) []Migration {
+	ms, err := loadMigrations(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return ms
+}
+
+// loadMigrations reads dir/NNNN_name.up.sql and .down.sql files.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, f := range files {
+		base := path.Base(f)
+		num, rest, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version number", base)
+		}
+		name, direction, ok := strings.Cut(strings.TrimSuffix(rest, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: must end in .up.sql or .down.sql", base)
+		}
+		body, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+			m.NoTx = slices.ContainsFunc(strings.Split(m.Up, "\n"), func(line string) bool {
+				return strings.TrimSpace(line) == noTxMarker
+			})
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var out []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no .up.sql", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be 1..n without gaps, found %d at position %d", m.Version, i+1)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no migrations found")
+	}
+	return out, nil
+}
+
+// legacyColumns were added to existing tables by OpenDB before versioned
+// migrations existed. The baseline adds whichever a database lacks.
+var legacyColumns = []struct{ table, column, def string }{
+	{"jobs", "queue", "TEXT NOT NULL DEFAULT 'default'"},
+	{"dead_jobs", "queue", "TEXT NOT NULL DEFAULT 'default'"},
+	{"jobs", "backoff", "TEXT NOT NULL DEFAULT ''"},
+	{"jobs", "retry_delay_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"dead_jobs", "backoff", "TEXT NOT NULL DEFAULT ''"},
+	{"jobs", "retry_on", "TEXT NOT NULL DEFAULT ''"},
+	{"jobs", "no_retry_on", "TEXT NOT NULL DEFAULT ''"},
+	{"jobs", "retry_later_on", "TEXT NOT NULL DEFAULT ''"},
+	{"dead_jobs", "retry_on", "TEXT NOT NULL DEFAULT ''"},
+	{"dead_jobs", "no_retry_on", "TEXT NOT NULL DEFAULT ''"},
+	{"dead_jobs", "retry_later_on", "TEXT NOT NULL DEFAULT ''"},
+	{"jobs", "retried_from", "INTEGER"},
+	{"jobs", "replays", "INTEGER NOT NULL DEFAULT 0"},
+	{"dead_jobs", "retried_from", "INTEGER"},
+	{"dead_jobs", "replays", "INTEGER NOT NULL DEFAULT 0"},
+	{"dead_jobs", "reason", "TEXT NOT NULL DEFAULT ''"},
+	{"dead_jobs", "escalated_at", "DATETIME"},
+}
+
+func addLegacyColumns(ctx context.Context, conn *sql.Conn) error {
+	for _, c := range legacyColumns {
+		var n int
+		err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.def)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+const schemaVersionSQL = `CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+)`
+
+// CurrentVersion returns the newest migration applied to db, 0 for an
+// empty or pre-migration database.
+func CurrentVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(schemaVersionSQL); err != nil {
+		return 0, err
+	}
+	var v int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&v)
+	return v, err
+}
+
+// AppliedMigration is a row of schema_version.
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// AppliedMigrations lists the migrations recorded in db, oldest first.
+func AppliedMigrations(db *sql.DB) ([]AppliedMigration, error) {
+	if _, err := db.Exec(schemaVersionSQL); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_version ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AppliedMigration
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// Migrate applies every pending migration in order.
+func Migrate(db *sql.DB) error {
+	_, err := MigrateTo(db, Migrations, LatestVersion())
+	return err
+}
+
+// MigrateTo moves db up or down to target using ms and returns the
+// versions it applied or rolled back. Each step runs in its own
+// BEGIN IMMEDIATE transaction, so processes opening the database at the
+// same time apply every migration exactly once. A database newer than
+// ms is refused with ErrNewerSchema.
+func MigrateTo(db *sql.DB, ms []Migration, target int) ([]int, error) {
+	if _, err := db.Exec(schemaVersionSQL); err != nil {
+		return nil, err
+	}
+	var done []int
+	for {
+		step, err := migrateStep(db, ms, target)
+		if err != nil || step == 0 {
+			return done, err
+		}
+		done = append(done, step)
+	}
+}
+
+// migrateStep applies or rolls back the one migration between the
+// current version and target, returning its version or 0 when db is
+// already at target.
+func migrateStep(db *sql.DB, ms []Migration, target int) (int, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return 0, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_, _ = conn.ExecContext(ctx, `ROLLBACK`)
+		}
+	}()
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return 0, err
+	}
+	latest := ms[len(ms)-1].Version
+	if current > latest {
+		return 0, fmt.Errorf("database schema version %d, this queuectl knows up to %d: %w", current, latest, ErrNewerSchema)
+	}
+	if current == target {
+		return 0, nil
+	}
+
+	var version int
+	if current < target {
+		m := ms[current] // versions are 1..n, so ms[current] is current+1
+		if _, err := conn.ExecContext(ctx, m.Up); err != nil {
+			return 0, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		if m.after != nil {
+			if err := m.after(ctx, conn); err != nil {
+				return 0, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT INTO schema_version(version, name, applied_at) VALUES(?,?,?)`,
+			m.Version, m.Name, formatTime(time.Now())); err != nil {
+			return 0, err
+		}
+		version = m.Version
+	} else {
+		m := ms[current-1]
+		if m.Down == "" {
+			return 0, fmt.Errorf("migration %d_%s cannot be rolled back", m.Version, m.Name)
+		}
+		if _, err := conn.ExecContext(ctx, m.Down); err != nil {
+			return 0, fmt.Errorf("roll back %d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := conn.ExecContext(ctx, `DELETE FROM schema_version WHERE version = ?`, m.Version); err != nil {
+			return 0, err
+		}
+		version = m.Version
+	}
+
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return 0, err
+	}
+	committed = true
+	return version, nil
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrateFreshAndLegacy(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDB(filepath.Join(dir, "fresh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := CurrentVersion(db); err != nil || v != LatestVersion() {
+		t.Fatalf("fresh db at version %d, %v; want %d", v, err, LatestVersion())
+	}
+
+	// a database created before versioned migrations: old columns only,
+	// no schema_version table
+	legacy, err := Open(filepath.Join(dir, "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+	if _, err := legacy.Exec(`
+		CREATE TABLE jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, command TEXT NOT NULL, state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0, max_retries INTEGER NOT NULL DEFAULT 3,
+			created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL, scheduled_at DATETIME,
+			last_error TEXT);
+		INSERT INTO jobs(command, state, created_at, updated_at, scheduled_at)
+			VALUES('echo old', 'pending', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z');
+		INSERT INTO jobs(command, state, created_at, updated_at, scheduled_at)
+			VALUES('echo default', 'pending', '2024-01-01 00:00:01', '2024-01-01 00:00:01', '2024-01-01 00:00:01')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(legacy); err != nil {
+		t.Fatal(err)
+	}
+	j, err := GetJobByID(legacy, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Command != "echo old" || j.Queue != "default" {
+		t.Errorf("legacy job after migrating: %+v", j)
+	}
+	// both timestamp formats end up in the one sortable layout
+	for id, want := range map[int]string{1: "2024-01-01T00:00:00.000Z", 2: "2024-01-01T00:00:01.000Z"} {
+		var sched, created string
+		if err := legacy.QueryRow(`SELECT CAST(scheduled_at AS TEXT), CAST(created_at AS TEXT) FROM jobs WHERE id = ?`, id).Scan(&sched, &created); err != nil {
+			t.Fatal(err)
+		}
+		if sched != want || created != want {
+			t.Errorf("job %d stored %q and %q, want %q", id, sched, created, want)
+		}
+	}
+	if err := Migrate(legacy); err != nil {
+		t.Errorf("second migrate: %v", err)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ms := append([]Migration{}, Migrations...)
+	next := LatestVersion() + 1
+	ms = append(ms,
+		Migration{Version: next, Name: "labels",
+			Up:   `CREATE TABLE labels (name TEXT PRIMARY KEY)`,
+			Down: `DROP TABLE labels`},
+		Migration{Version: next + 1, Name: "labels_color",
+			Up:   `ALTER TABLE labels ADD COLUMN color TEXT`,
+			Down: `ALTER TABLE labels DROP COLUMN color`})
+
+	done, err := MigrateTo(db, ms, next+1)
+	if err != nil || len(done) != next+1 {
+		t.Fatalf("migrate up applied %v, %v", done, err)
+	}
+	if _, err := db.Exec(`INSERT INTO labels(name, color) VALUES('a', 'red')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// this build does not know about the test migrations
+	if err := Migrate(db); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("migrate with an older build: %v, want ErrNewerSchema", err)
+	}
+
+	done, err = MigrateTo(db, ms, next-1)
+	if err != nil || len(done) != 2 || done[0] != next+1 || done[1] != next {
+		t.Fatalf("migrate down rolled back %v, %v", done, err)
+	}
+	if _, err := db.Exec(`SELECT 1 FROM labels`); err == nil {
+		t.Error("labels table survived the rollback")
+	}
+	// rolling back stops at the baseline, after undoing everything above it
+	if _, err := MigrateTo(db, ms, 0); err == nil {
+		t.Error("rolled back the baseline")
+	}
+	if v, _ := CurrentVersion(db); v != 1 {
+		t.Errorf("version %d after failed rollback, want 1", v)
+	}
+}
+
+func TestLoadMigrationsRejectsGaps(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_a.up.sql": {Data: []byte(`SELECT 1`)},
+		"migrations/0003_c.up.sql": {Data: []byte(`SELECT 1`)},
+	}
+	if _, err := loadMigrations(fsys, "migrations"); err == nil {
+		t.Error("loaded migrations with a gap")
+	}
+	fsys = fstest.MapFS{
+		"migrations/0001_a.up.sql":   {Data: []byte(`SELECT 1`)},
+		"migrations/0002_b.down.sql": {Data: []byte(`SELECT 1`)},
+	}
+	if _, err := loadMigrations(fsys, "migrations"); err == nil {
+		t.Error("loaded a migration without .up.sql")
+	}
+}
+
+func TestLoadNoTxMigration(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_a.up.sql": {Data: []byte("-- queuectl:no-transactions\nSELECT 1")},
+		"migrations/0002_b.up.sql": {Data: []byte("-- Indexes.\n-- queuectl:no-transaction\nSELECT 1;\n-- second\nSELECT 2;\n")},
+	}
+	ms, err := loadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms[0].NoTx || !ms[1].NoTx {
+		t.Errorf("NoTx = %v, %v; want false, true", ms[0].NoTx, ms[1].NoTx)
+	}
+	if got := splitStatements(ms[1].Up); !slices.Equal(got, []string{"SELECT 1", "SELECT 2"}) {
+		t.Errorf("statements %q", got)
+	}
+
+	// the concurrent index builds must each run on their own
+	for _, m := range PostgresMigrations {
+		if !m.NoTx {
+			continue
+		}
+		for _, stmt := range splitStatements(m.Up) {
+			if strings.Count(stmt, "CREATE INDEX") > 1 {
+				t.Errorf("migration %d_%s: statements not split: %q", m.Version, m.Name, stmt)
+			}
+		}
+	}
+	if !PostgresMigrations[1].NoTx {
+		t.Error("postgres migration 2 builds its indexes in a transaction")
+	}
+}
@@ -0,0 +1,135 @@
+-- Baseline: the schema as it stood when versioned migrations were
+-- introduced. Statements use IF NOT EXISTS so databases created before
+-- then are adopted in place; columns they lack are added by the Go side
+-- of this migration (see legacyColumns).
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    command TEXT NOT NULL,
+    state TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_retries INTEGER NOT NULL DEFAULT 3,
+    scheduled_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    last_error TEXT,
+    queue TEXT NOT NULL DEFAULT 'default',
+    backoff TEXT NOT NULL DEFAULT '',
+    retry_delay_ms INTEGER NOT NULL DEFAULT 0,
+    retry_on TEXT NOT NULL DEFAULT '',
+    no_retry_on TEXT NOT NULL DEFAULT '',
+    retry_later_on TEXT NOT NULL DEFAULT '',
+    retried_from INTEGER,
+    replays INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_state_updated ON jobs(state, updated_at);
+
+CREATE TABLE IF NOT EXISTS dead_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    orig_id INTEGER,
+    command TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    max_retries INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    failed_at DATETIME NOT NULL,
+    last_error TEXT,
+    queue TEXT NOT NULL DEFAULT 'default',
+    backoff TEXT NOT NULL DEFAULT '',
+    retry_on TEXT NOT NULL DEFAULT '',
+    no_retry_on TEXT NOT NULL DEFAULT '',
+    retry_later_on TEXT NOT NULL DEFAULT '',
+    retried_from INTEGER,
+    replays INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    escalated_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_jobs_failed ON dead_jobs(failed_at);
+
+CREATE TABLE IF NOT EXISTS config (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+INSERT OR IGNORE INTO config (key, value) VALUES ('max_retries', '3');
+INSERT OR IGNORE INTO config (key, value) VALUES ('backoff_base', '2');
+INSERT OR IGNORE INTO config (key, value) VALUES ('log_level', 'info');
+INSERT OR IGNORE INTO config (key, value) VALUES ('worker_concurrency', '1');
+INSERT OR IGNORE INTO config (key, value) VALUES ('notify.failure_rate', '0.5');
+INSERT OR IGNORE INTO config (key, value) VALUES ('notify.failure_min', '10');
+INSERT OR IGNORE INTO config (key, value) VALUES ('notify.failure_window', '5m');
+INSERT OR IGNORE INTO config (key, value) VALUES ('notify.dedup_window', '15m');
+INSERT OR IGNORE INTO config (key, value) VALUES ('notify.rate_limit', '20/1h');
+
+CREATE TABLE IF NOT EXISTS workers (
+    id INTEGER PRIMARY KEY,
+    state TEXT NOT NULL,
+    current_job_id INTEGER,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS job_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL,
+    attempt INTEGER NOT NULL,
+    worker_id INTEGER,
+    output TEXT,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_logs_job ON job_logs(job_id);
+
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL,
+    from_state TEXT NOT NULL,
+    to_state TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_job ON events(job_id);
+
+CREATE TABLE IF NOT EXISTS notify_sinks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    email_from TEXT,
+    email_to TEXT,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notify_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sink_id INTEGER NOT NULL,
+    dedup_key TEXT NOT NULL,
+    sent_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notify_log_sink ON notify_log(sink_id, sent_at);
+
+CREATE TABLE IF NOT EXISTS archived_jobs (
+    kind TEXT NOT NULL,
+    id INTEGER NOT NULL,
+    job_id INTEGER,
+    queue TEXT NOT NULL,
+    command TEXT NOT NULL,
+    state TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    finished_at DATETIME NOT NULL,
+    last_error TEXT,
+    record TEXT NOT NULL,
+    restored_at DATETIME NOT NULL,
+    PRIMARY KEY (kind, id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_archived_jobs_job ON archived_jobs(job_id);
+
+-- restored archives are for investigation only
+CREATE TRIGGER IF NOT EXISTS archived_jobs_no_update BEFORE UPDATE ON archived_jobs
+BEGIN SELECT RAISE(ABORT, 'archived_jobs is read-only'); END;
+CREATE TRIGGER IF NOT EXISTS archived_jobs_no_delete BEFORE DELETE ON archived_jobs
+BEGIN SELECT RAISE(ABORT, 'archived_jobs is read-only'); END;
@@ -0,0 +1,40 @@
+-- Back to RFC3339 at second precision. Sub-second parts are dropped.
+
+UPDATE jobs SET
+    scheduled_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', scheduled_at), scheduled_at),
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at),
+    updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', updated_at), updated_at);
+
+UPDATE dead_jobs SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at),
+    failed_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', failed_at), failed_at),
+    escalated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', escalated_at), escalated_at);
+
+UPDATE workers SET
+    updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', updated_at), updated_at);
+
+UPDATE job_logs SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at);
+
+UPDATE events SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at);
+
+UPDATE notify_sinks SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at);
+
+UPDATE notify_log SET
+    sent_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', sent_at), sent_at);
+
+-- archived_jobs is read-only; lift that while converting it
+DROP TRIGGER archived_jobs_no_update;
+
+UPDATE archived_jobs SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at),
+    finished_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', finished_at), finished_at),
+    restored_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', restored_at), restored_at);
+
+CREATE TRIGGER archived_jobs_no_update BEFORE UPDATE ON archived_jobs
+BEGIN SELECT RAISE(ABORT, 'archived_jobs is read-only'); END;
+
+UPDATE schema_version SET
+    applied_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', applied_at), applied_at);
@@ -0,0 +1,48 @@
+-- Store every timestamp as fixed-width UTC with milliseconds
+-- (2006-01-02T15:04:05.000Z), so string comparisons order correctly and
+-- jobs scheduled less than a second apart stay apart. Earlier rows mix
+-- RFC3339 at second precision, CURRENT_TIMESTAMP's "YYYY-MM-DD HH:MM:SS"
+-- and the driver's own format; strftime reads all of them. Values it
+-- cannot parse are left as they are.
+--
+-- jobs.scheduled_at keeps its CURRENT_TIMESTAMP default, which would
+-- take a table rebuild to change; queuectl always sets the column.
+
+UPDATE jobs SET
+    scheduled_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', scheduled_at), scheduled_at),
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at),
+    updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', updated_at), updated_at);
+
+UPDATE dead_jobs SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at),
+    failed_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', failed_at), failed_at),
+    escalated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', escalated_at), escalated_at);
+
+UPDATE workers SET
+    updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', updated_at), updated_at);
+
+UPDATE job_logs SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at);
+
+UPDATE events SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at);
+
+UPDATE notify_sinks SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at);
+
+UPDATE notify_log SET
+    sent_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', sent_at), sent_at);
+
+-- archived_jobs is read-only; lift that while converting it
+DROP TRIGGER archived_jobs_no_update;
+
+UPDATE archived_jobs SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at),
+    finished_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', finished_at), finished_at),
+    restored_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', restored_at), restored_at);
+
+CREATE TRIGGER archived_jobs_no_update BEFORE UPDATE ON archived_jobs
+BEGIN SELECT RAISE(ABORT, 'archived_jobs is read-only'); END;
+
+UPDATE schema_version SET
+    applied_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', applied_at), applied_at);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_jobs_updated;
+DROP INDEX IF EXISTS idx_jobs_created;
+DROP INDEX IF EXISTS idx_jobs_queue_state;
+DROP INDEX IF EXISTS idx_jobs_state_created;
+DROP INDEX IF EXISTS idx_jobs_state;
+
+ALTER TABLE dead_jobs DROP COLUMN tags;
+ALTER TABLE jobs DROP COLUMN tags;
@@ -0,0 +1,16 @@
+-- Tags on jobs, and indexes for list's filters and sort orders. Without
+-- them, listing one state or queue scanned every job and sorted the lot
+-- before applying the limit. Every index ends in id (the rowid), which
+-- breaks ties between equal keys for cursor pagination.
+--
+-- Tags are a comma separated list like retry_on. A tag filter is a scan,
+-- narrowed by whichever of these indexes the other filters use.
+
+ALTER TABLE jobs ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE dead_jobs ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs(state);
+CREATE INDEX IF NOT EXISTS idx_jobs_state_created ON jobs(state, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_queue_state ON jobs(queue, state);
+CREATE INDEX IF NOT EXISTS idx_jobs_created ON jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_updated ON jobs(updated_at);
@@ -0,0 +1,4 @@
+-- The worker holding each running job, so only that worker can report
+-- its result and a job whose worker went quiet can be reclaimed. NULL
+-- for jobs that are not running.
+ALTER TABLE jobs ADD COLUMN worker_id INTEGER;
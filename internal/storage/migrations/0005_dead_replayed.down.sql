@@ -0,0 +1,2 @@
+DELETE FROM dead_jobs WHERE replayed_as IS NOT NULL;
+ALTER TABLE dead_jobs DROP COLUMN replayed_as;
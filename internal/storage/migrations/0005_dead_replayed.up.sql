@@ -0,0 +1,4 @@
+-- Retried DLQ entries stay behind as history, so the retried_from chain
+-- of a requeued job keeps pointing at real rows. replayed_as is the job
+-- an entry was requeued as; the DLQ proper is the entries without one.
+ALTER TABLE dead_jobs ADD COLUMN replayed_as INTEGER;
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Sink is a configured notification destination.
+type Sink struct {
+	ID        int64
+	Kind      string // webhook, slack or smtp
+	Target    string // URL for webhook/slack, host:port for smtp
+	EmailFrom string
+	EmailTo   string // comma separated
+	CreatedAt time.Time
+}
+
+// SinkStore is implemented by the stores that keep notification sinks
+// and their send log: SQLiteStore and PostgresStore.
+type SinkStore interface {
+	InsertSink(s Sink) (int64, error)
+	ListSinks() ([]Sink, error)
+	DeleteSink(id int64) error
+	RecordNotification(sinkID int64, key string, at time.Time) error
+	NotificationSent(sinkID int64, key string, since time.Time) (bool, error)
+	CountNotifications(sinkID int64, since time.Time) (int, error)
+}
+
+// InsertSink stores a notification destination and returns its id.
+func InsertSink(db *sql.DB, s Sink) (int64, error) {
+	res, err := db.Exec(`INSERT INTO notify_sinks(kind, target, email_from, email_to, created_at)
+        VALUES(?,?,?,?,?)`,
+		s.Kind, s.Target, s.EmailFrom, s.EmailTo, formatTime(time.Now()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListSinks returns all notification destinations.
+func ListSinks(db *sql.DB) ([]Sink, error) {
+	rows, err := db.Query(`SELECT id, kind, target, email_from, email_to, created_at FROM notify_sinks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Sink
+	for rows.Next() {
+		var s Sink
+		var from, to sql.NullString
+		if err := rows.Scan(&s.ID, &s.Kind, &s.Target, &from, &to, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.EmailFrom, s.EmailTo = from.String, to.String
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSink removes a notification destination and its send history.
+func DeleteSink(db *sql.DB, id int64) error {
+	res, err := db.Exec(`DELETE FROM notify_sinks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("sink %d not found: %w", id, sql.ErrNoRows)
+	}
+	_, err = db.Exec(`DELETE FROM notify_log WHERE sink_id = ?`, id)
+	return err
+}
+
+// RecordNotification remembers that key was sent to a sink, for dedup
+// and rate limiting across processes.
+func RecordNotification(db *sql.DB, sinkID int64, key string, at time.Time) error {
+	_, err := db.Exec(`INSERT INTO notify_log(sink_id, dedup_key, sent_at) VALUES(?,?,?)`,
+		sinkID, key, formatTime(at))
+	return err
+}
+
+// NotificationSent reports whether key was sent to a sink since t.
+func NotificationSent(db *sql.DB, sinkID int64, key string, since time.Time) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM notify_log WHERE sink_id = ? AND dedup_key = ? AND sent_at >= ?`,
+		sinkID, key, formatTime(since)).Scan(&n)
+	return n > 0, err
+}
+
+// CountNotifications returns how many notifications a sink got since t.
+func CountNotifications(db *sql.DB, sinkID int64, since time.Time) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM notify_log WHERE sink_id = ? AND sent_at >= ?`,
+		sinkID, formatTime(since)).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,1062 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"queuectl/internal/job"
+)
+
+//go:embed postgres_migrations/*.sql
+var postgresMigrationFiles embed.FS
+
+// PostgresMigrations is the ordered Postgres schema history. Postgres
+// migrations only go up; roll back by restoring a dump.
+var PostgresMigrations = mustLoadMigrations(postgresMigrationFiles, "postgres_migrations")
+
+// postgresMigrateLock is the advisory lock key migrating hosts serialise on.
+const postgresMigrateLock = 7131
+
+// postgresChannel is the LISTEN/NOTIFY channel the jobs trigger signals.
+const postgresChannel = "queuectl_jobs"
+
+// IsPostgresURL reports whether a --db value names a Postgres database
+// rather than a SQLite file.
+func IsPostgresURL(s string) bool {
+	return strings.HasPrefix(s, "postgres://") || strings.HasPrefix(s, "postgresql://")
+}
+
+// PostgresStore is a Store on PostgreSQL for running workers on many
+// hosts. Workers claim with FOR UPDATE SKIP LOCKED, so they never wait
+// on each other's claims, and Wakeups delivers the NOTIFY the jobs
+// trigger sends whenever a job becomes due.
+type PostgresStore struct {
+	db  *sql.DB
+	dsn string
+}
+
+// OpenPostgres connects to dsn and applies any pending migrations. A
+// database newer than this build is refused with ErrNewerSchema.
+func OpenPostgres(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &PostgresStore{db: db, dsn: dsn}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SchemaVersion returns the newest migration applied, 0 for an empty
+// database or one created before the schema was versioned.
+func (s *PostgresStore) SchemaVersion() (int, error) {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT to_regclass('schema_version') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var v int
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&v)
+	return v, err
+}
+
+// migrate applies pending migrations one transaction at a time, or one
+// statement at a time for NoTx steps. An up to date database costs two
+// reads and no DDL, so starting many workers does not queue them behind
+// each other's schema locks.
+func (s *PostgresStore) migrate() error {
+	latest := PostgresMigrations[len(PostgresMigrations)-1].Version
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d, this queuectl knows up to %d: %w", current, latest, ErrNewerSchema)
+	}
+	for current < latest {
+		step := s.migrateStep
+		if PostgresMigrations[current].NoTx { // versions are 1..n
+			step = s.migrateStepNoTx
+		}
+		if current, err = step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateConn is the transaction or connection holding the migration
+// lock.
+type migrateConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// lockedVersion returns the version the database is at, read under the
+// migration lock, creating schema_version on first use.
+func lockedVersion(ctx context.Context, c migrateConn) (int, error) {
+	if _, err := c.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL)`); err != nil {
+		return 0, err
+	}
+	var current int
+	if err := c.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return 0, err
+	}
+	latest := PostgresMigrations[len(PostgresMigrations)-1].Version
+	if current > latest {
+		return 0, fmt.Errorf("database schema version %d, this queuectl knows up to %d: %w", current, latest, ErrNewerSchema)
+	}
+	return current, nil
+}
+
+// migrateStep applies the migration after the current version under a
+// transaction-scoped advisory lock, so hosts starting at the same time
+// apply it once, and returns the version the database is now at.
+func (s *PostgresStore) migrateStep() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrateLock); err != nil {
+		return 0, err
+	}
+	current, err := lockedVersion(context.Background(), tx)
+	if err != nil {
+		return 0, err
+	}
+	// another host may have moved on while we waited for the lock
+	if current == len(PostgresMigrations) || PostgresMigrations[current].NoTx {
+		return current, nil
+	}
+
+	m := PostgresMigrations[current] // versions are 1..n
+	if _, err := tx.Exec(m.Up); err != nil {
+		return 0, fmt.Errorf("postgres migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version(version, name, applied_at) VALUES($1, $2, $3)`,
+		m.Version, m.Name, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	return m.Version, tx.Commit()
+}
+
+// migrateStepNoTx applies the next migration when it is a NoTx step. A
+// session advisory lock on one connection stands in for the transaction
+// scoped one. The schema_version row is only inserted once every
+// statement succeeded, so a host that dies halfway leaves the step to be
+// rerun in full.
+func (s *PostgresStore) migrateStepNoTx() (int, error) {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrateLock); err != nil {
+		return 0, err
+	}
+	defer func() { _, _ = conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, postgresMigrateLock) }()
+
+	current, err := lockedVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if current == len(PostgresMigrations) || !PostgresMigrations[current].NoTx {
+		return current, nil
+	}
+
+	m := PostgresMigrations[current]
+	for _, stmt := range splitStatements(m.Up) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return 0, fmt.Errorf("postgres migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, `INSERT INTO schema_version(version, name, applied_at) VALUES($1, $2, $3)`,
+		m.Version, m.Name, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	return m.Version, nil
+}
+
+// splitStatements cuts a NoTx migration into its statements, since
+// Postgres runs several statements sent at once in one implicit
+// transaction. Such migrations may only use semicolons to end statements.
+func splitStatements(body string) []string {
+	var out []string
+	for _, part := range strings.Split(body, ";") {
+		var lines []string
+		for _, line := range strings.Split(part, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			out = append(out, strings.Join(lines, "\n"))
+		}
+	}
+	return out
+}
+
+// Close closes the connection pool.
+func (s *PostgresStore) Close() error { return s.db.Close() }
+
+// Wakeups listens for the jobs trigger on its own connection and sends
+// on the returned channel whenever a job may have become due. It
+// reconnects until ctx is done. Sends never block, so a burst of
+// notifications collapses into one wakeup.
+func (s *PostgresStore) Wakeups(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		for ctx.Err() == nil {
+			if err := s.listen(ctx, ch); err != nil && ctx.Err() == nil {
+				slog.Warn("postgres listen", "err", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+func (s *PostgresStore) listen(ctx context.Context, ch chan<- struct{}) error {
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+postgresChannel); err != nil {
+		return err
+	}
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// scanPostgresJob reads one row selected with jobColumns.
+func scanPostgresJob(row rowScanner) (*job.Job, error) {
+	var j job.Job
+	var state string
+	var lastErr sql.NullString
+	var delayMS int64
+	var retryOn, noRetryOn, retryLaterOn, tags string
+	var retriedFrom, workerID sql.NullInt64
+	if err := row.Scan(&j.ID, &j.Command, &state, &j.Attempts, &j.MaxRetries,
+		&j.ScheduledAt, &j.CreatedAt, &j.UpdatedAt, &lastErr, &j.Queue, &j.Backoff, &delayMS,
+		&retryOn, &noRetryOn, &retryLaterOn, &retriedFrom, &j.Replays, &tags, &workerID); err != nil {
+		return nil, err
+	}
+	j.WorkerID = int(workerID.Int64)
+	j.Tags, _ = job.ParseTags(tags)
+	j.State = job.JobState(state)
+	j.LastError = lastErr.String
+	j.RetryDelay = time.Duration(delayMS) * time.Millisecond
+	j.RetriedFrom = retriedFrom.Int64
+	j.Retry.RetryOn, _ = job.ParseExitCodes(retryOn)
+	j.Retry.NoRetryOn, _ = job.ParseExitCodes(noRetryOn)
+	j.Retry.RetryLaterOn, _ = job.ParseExitCodes(retryLaterOn)
+	j.ScheduledAt, j.CreatedAt, j.UpdatedAt = j.ScheduledAt.UTC(), j.CreatedAt.UTC(), j.UpdatedAt.UTC()
+	return &j, nil
+}
+
+func (s *PostgresStore) queryJobs(query string, args ...any) ([]job.Job, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []job.Job
+	for rows.Next() {
+		j, err := scanPostgresJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *j)
+	}
+	return out, rows.Err()
+}
+
+// inTx runs fn in one transaction.
+func (s *PostgresStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) InsertJob(j *job.Job, evs ...Event) (int64, error) {
+	var id int64
+	err := s.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(`INSERT INTO jobs(command, state, attempts, max_retries, scheduled_at, created_at, updated_at,
+            last_error, queue, backoff, retry_on, no_retry_on, retry_later_on, tags)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+        RETURNING id`,
+			j.Command, string(j.State), j.Attempts, j.MaxRetries, j.ScheduledAt.UTC(), j.CreatedAt.UTC(), j.UpdatedAt.UTC(),
+			j.LastError, j.Queue, j.Backoff,
+			job.FormatExitCodes(j.Retry.RetryOn), job.FormatExitCodes(j.Retry.NoRetryOn), job.FormatExitCodes(j.Retry.RetryLaterOn),
+			job.FormatTags(j.Tags),
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return insertPostgresEvents(tx, id, evs)
+	})
+	return id, err
+}
+
+func (s *PostgresStore) GetJob(id int64) (*job.Job, error) {
+	return scanPostgresJob(s.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+}
+
+// ClaimJob claims the oldest due job for workerID and records it as the
+// worker's current job in the same transaction. SKIP LOCKED lets
+// concurrent claimers pass over rows another transaction is claiming
+// instead of queueing behind it.
+func (s *PostgresStore) ClaimJob(workerID int, evs ...Event) (*job.Job, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	j, err := scanPostgresJob(tx.QueryRow(`UPDATE jobs SET state = $1, updated_at = $2, worker_id = $5
+        WHERE id = (
+            SELECT id FROM jobs
+            WHERE state IN ($3, $4) AND scheduled_at <= $2
+            ORDER BY id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED)
+        RETURNING `+jobColumns,
+		string(job.Running), now, string(job.Pending), string(job.Failed), nullWorker(workerID)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoJob
+	}
+	if err != nil {
+		return nil, err
+	}
+	if workerID != 0 {
+		if _, err := tx.Exec(`INSERT INTO workers(id, state, current_job_id, updated_at) VALUES($1,$2,$3,$4)
+            ON CONFLICT (id) DO UPDATE SET
+                state = excluded.state,
+                current_job_id = excluded.current_job_id,
+                updated_at = excluded.updated_at`, workerID, "running", j.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := insertPostgresEvents(tx, j.ID, claimed(j, evs)); err != nil {
+		return nil, err
+	}
+	return j, tx.Commit()
+}
+
+func (s *PostgresStore) ClaimJobs(n, workerID int, evs ...Event) ([]*job.Job, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(`UPDATE jobs SET state = $1, updated_at = $2, worker_id = $6
+        WHERE id IN (
+            SELECT id FROM jobs
+            WHERE state IN ($3, $4) AND scheduled_at <= $2
+            ORDER BY id
+            LIMIT $5
+            FOR UPDATE SKIP LOCKED)
+        RETURNING `+jobColumns,
+		string(job.Running), time.Now().UTC(), string(job.Pending), string(job.Failed), n, nullWorker(workerID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []*job.Job{}
+	for rows.Next() {
+		j, err := scanPostgresJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	for _, j := range jobs {
+		if err := insertPostgresEvents(tx, j.ID, claimed(j, evs)); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, tx.Commit()
+}
+
+func (s *PostgresStore) UpdateJob(j *job.Job, evs ...Event) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE jobs SET state = $1, attempts = $2, scheduled_at = $3, updated_at = $4, last_error = $5,
+            retry_delay_ms = $6, worker_id = $7 WHERE id = $8`,
+			string(j.State), j.Attempts, j.ScheduledAt.UTC(), j.UpdatedAt.UTC(), j.LastError, j.RetryDelay.Milliseconds(),
+			owner(j), j.ID)
+		if err != nil {
+			return err
+		}
+		return insertPostgresEvents(tx, j.ID, evs)
+	})
+}
+
+func (s *PostgresStore) StaleJobs(cutoff time.Time) ([]job.Job, error) {
+	return s.queryJobs(`SELECT `+jobColumns+` FROM jobs
+        WHERE state = $1 AND updated_at < $2
+            AND NOT EXISTS (SELECT 1 FROM workers w WHERE w.id = jobs.worker_id AND w.updated_at >= $2)
+        ORDER BY id`, string(job.Running), cutoff.UTC())
+}
+
+func (s *PostgresStore) ListJobs(state job.JobState) ([]job.Job, error) {
+	return s.queryJobs(`SELECT `+jobColumns+` FROM jobs WHERE state = $1 ORDER BY id`, string(state))
+}
+
+// FindJobs is FindJobs of the SQLite store, except that CommandRegexp
+// is a POSIX regex evaluated by Postgres.
+func (s *PostgresStore) FindJobs(f JobFilter) ([]job.Job, error) {
+	if err := f.Check(); err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE true`
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if f.State != "" {
+		query += ` AND state = ` + arg(string(f.State))
+	}
+	if f.Queue != "" {
+		query += ` AND queue = ` + arg(f.Queue)
+	}
+	if f.Command != "" {
+		query += ` AND strpos(command, ` + arg(f.Command) + `) > 0`
+	}
+	if f.CommandRegexp != "" {
+		query += ` AND command ~ ` + arg(f.CommandRegexp)
+	}
+	if f.Error != "" {
+		query += ` AND strpos(COALESCE(last_error, ''), ` + arg(f.Error) + `) > 0`
+	}
+	if f.Tag != "" {
+		query += ` AND strpos(',' || tags || ',', ',' || ` + arg(f.Tag) + `::text || ',') > 0`
+	}
+	if f.MinAttempts > 0 {
+		query += ` AND attempts >= ` + arg(f.MinAttempts)
+	}
+	if !f.CreatedAfter.IsZero() {
+		query += ` AND created_at >= ` + arg(f.CreatedAfter.UTC())
+	}
+	if !f.CreatedBefore.IsZero() {
+		query += ` AND created_at < ` + arg(f.CreatedBefore.UTC())
+	}
+	if !f.UpdatedAfter.IsZero() {
+		query += ` AND updated_at >= ` + arg(f.UpdatedAfter.UTC())
+	}
+	if !f.UpdatedBefore.IsZero() {
+		query += ` AND updated_at < ` + arg(f.UpdatedBefore.UTC())
+	}
+
+	col, dir := f.Sort.column()
+	if f.After != "" {
+		key, id, _ := f.Sort.decodeCursor(f.After)
+		op := ">"
+		if f.Sort.Desc {
+			op = "<"
+		}
+		var keyArg any = key
+		if f.Sort.isTime() {
+			keyArg = time.UnixMicro(key).UTC()
+		}
+		if col == "id" {
+			query += ` AND id ` + op + ` ` + arg(id)
+		} else {
+			query += ` AND (` + col + `, id) ` + op + ` (` + arg(keyArg) + `, ` + arg(id) + `)`
+		}
+	}
+	query += ` ORDER BY ` + col + ` ` + dir
+	if col != "id" {
+		query += `, id ` + dir
+	}
+	if f.Limit > 0 {
+		query += ` LIMIT ` + arg(f.Limit)
+	}
+	return s.queryJobs(query, args...)
+}
+
+func (s *PostgresStore) NextScheduledJob() (*job.Job, error) {
+	return scanPostgresJob(s.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE state = $1
+        ORDER BY scheduled_at, id LIMIT 1`, string(job.Pending)))
+}
+
+func (s *PostgresStore) CountJobs(state job.JobState) (int, error) {
+	var n int
+	row := s.db.QueryRow(`SELECT COUNT(*) FROM jobs WHERE state = $1`, string(state))
+	if state == job.Dead {
+		row = s.db.QueryRow(`SELECT COUNT(*) FROM dead_jobs WHERE replayed_as IS NULL`)
+	}
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (s *PostgresStore) CountJobsByQueue() (map[string]map[job.JobState]int, error) {
+	rows, err := s.db.Query(`
+        SELECT queue, state, COUNT(*) FROM jobs GROUP BY queue, state
+        UNION ALL
+        SELECT queue, 'dead', COUNT(*) FROM dead_jobs WHERE replayed_as IS NULL GROUP BY queue`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]map[job.JobState]int{}
+	for rows.Next() {
+		var queue, state string
+		var n int
+		if err := rows.Scan(&queue, &state, &n); err != nil {
+			return nil, err
+		}
+		if out[queue] == nil {
+			out[queue] = map[job.JobState]int{}
+		}
+		out[queue][job.JobState(state)] += n
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) FlushPending() error {
+	_, err := s.db.Exec(`DELETE FROM jobs WHERE state = $1`, string(job.Pending))
+	return err
+}
+
+func (s *PostgresStore) FlushAll() error {
+	_, err := s.db.Exec(`DELETE FROM jobs; DELETE FROM dead_jobs`)
+	return err
+}
+
+// MoveToDead copies j into dead_jobs and removes it from jobs in one
+// transaction, returning sql.ErrNoRows when j is already gone.
+func (s *PostgresStore) MoveToDead(j *job.Job, reason job.DeadReason, evs ...Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the row lock taken by DELETE makes a concurrent move of the same
+	// job wait and then delete nothing
+	res, err := tx.Exec(`DELETE FROM jobs WHERE id = $1`, j.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = tx.Exec(`INSERT INTO dead_jobs(orig_id, command, attempts, max_retries, created_at, failed_at, last_error, queue,
+            backoff, retry_on, no_retry_on, retry_later_on, retried_from, replays, reason, tags)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`,
+		j.ID, j.Command, j.Attempts, j.MaxRetries, j.CreatedAt.UTC(), time.Now().UTC(), j.LastError, j.Queue, j.Backoff,
+		job.FormatExitCodes(j.Retry.RetryOn), job.FormatExitCodes(j.Retry.NoRetryOn), job.FormatExitCodes(j.Retry.RetryLaterOn),
+		nullID(j.RetriedFrom), j.Replays, string(reason), job.FormatTags(j.Tags))
+	if err != nil {
+		return err
+	}
+	if err := insertPostgresEvents(tx, j.ID, evs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) GetDeadJob(id int64) (*DeadJob, error) {
+	d, err := scanDeadJob(s.db.QueryRow(`SELECT `+deadJobColumns+` FROM dead_jobs WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	d.CreatedAt, d.FailedAt = d.CreatedAt.UTC(), d.FailedAt.UTC()
+	return d, nil
+}
+
+func (s *PostgresStore) FindDeadJobs(f DeadJobFilter) ([]DeadJob, error) {
+	query := `SELECT ` + deadJobColumns + ` FROM dead_jobs WHERE replayed_as IS NULL`
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if f.Command != "" {
+		query += ` AND strpos(command, ` + arg(f.Command) + `) > 0`
+	}
+	if f.Queue != "" {
+		query += ` AND queue = ` + arg(f.Queue)
+	}
+	if f.Error != "" {
+		query += ` AND strpos(COALESCE(last_error, ''), ` + arg(f.Error) + `) > 0`
+	}
+	if f.Reason != "" {
+		query += ` AND reason = ` + arg(string(f.Reason))
+	}
+	if !f.Since.IsZero() {
+		query += ` AND failed_at >= ` + arg(f.Since.UTC())
+	}
+	rows, err := s.db.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DeadJob
+	for rows.Next() {
+		d, err := scanDeadJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		d.CreatedAt, d.FailedAt = d.CreatedAt.UTC(), d.FailedAt.UTC()
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// RetryDeadJob requeues a DLQ entry like the SQLite store does: marking
+// the entry locks it, so a concurrent retry of the same entry waits and
+// then finds nothing, and the job keeps its original id when free.
+func (s *PostgresStore) RetryDeadJob(id int64, keepAttempts bool, evs ...Event) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var origID, keptID sql.NullInt64
+	var cmd, queue, backoff, retryOn, noRetryOn, retryLaterOn, tags string
+	var attempts, maxRetries, replays int
+	var createdAt time.Time
+	// 0 stands in for the job id until the insert below picks it
+	err = tx.QueryRow(`UPDATE dead_jobs SET replayed_as = 0 WHERE id = $1 AND replayed_as IS NULL
+        RETURNING orig_id, command, attempts, max_retries, created_at, queue, backoff, retry_on, no_retry_on, retry_later_on, replays, tags`, id).
+		Scan(&origID, &cmd, &attempts, &maxRetries, &createdAt, &queue, &backoff, &retryOn, &noRetryOn, &retryLaterOn, &replays, &tags)
+	if err != nil {
+		return 0, fmt.Errorf("dead job id %d not found: %w", id, err)
+	}
+	if !keepAttempts {
+		attempts = 0
+	}
+
+	keptID = origID
+	if origID.Valid {
+		var taken bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM jobs WHERE id = $1)`, origID.Int64).Scan(&taken); err != nil {
+			return 0, err
+		}
+		if taken {
+			keptID = sql.NullInt64{}
+		}
+	}
+
+	now := time.Now().UTC()
+	var newID int64
+	err = tx.QueryRow(`INSERT INTO jobs (id, command, state, attempts, max_retries, scheduled_at, created_at, updated_at, queue,
+            backoff, retry_on, no_retry_on, retry_later_on, retried_from, replays, tags)
+        VALUES (COALESCE($1, nextval(pg_get_serial_sequence('jobs', 'id'))), $2, $3, $15, $4, $5, $6, $5, $7, $8, $9, $10, $11, $12, $13, $14)
+        RETURNING id`,
+		keptID, cmd, string(job.Pending), maxRetries, now, createdAt, queue, backoff,
+		retryOn, noRetryOn, retryLaterOn, id, replays+1, tags, attempts).Scan(&newID)
+	if err != nil {
+		return 0, fmt.Errorf("requeue failed: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE dead_jobs SET replayed_as = $1 WHERE id = $2`, newID, id); err != nil {
+		return 0, err
+	}
+	if err := insertPostgresEvents(tx, newID, requeued(origID.Int64, newID, evs)); err != nil {
+		return 0, err
+	}
+	return newID, tx.Commit()
+}
+
+func (s *PostgresStore) UpdateDeadJob(d *DeadJob, evs ...Event) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE dead_jobs SET command = $1, queue = $2, max_retries = $3 WHERE id = $4 AND replayed_as IS NULL`,
+			d.Command, d.Queue, d.MaxRetries, d.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("dead job id %d not found: %w", d.ID, sql.ErrNoRows)
+		}
+		return insertPostgresEvents(tx, 0, evs)
+	})
+}
+
+func (s *PostgresStore) DeleteDeadJob(id int64, evs ...Event) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM dead_jobs WHERE id = $1 AND replayed_as IS NULL`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("dead job id %d not found: %w", id, sql.ErrNoRows)
+		}
+		return insertPostgresEvents(tx, 0, evs)
+	})
+}
+
+func (s *PostgresStore) MarkEscalated(id int64, evs ...Event) (won bool, err error) {
+	err = s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE dead_jobs SET escalated_at = $1 WHERE id = $2 AND escalated_at IS NULL AND replayed_as IS NULL`, time.Now().UTC(), id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if won = n == 1; err != nil || !won {
+			return err
+		}
+		return insertPostgresEvents(tx, 0, evs)
+	})
+	return won, err
+}
+
+func (s *PostgresStore) FlushDead() error {
+	_, err := s.db.Exec(`DELETE FROM dead_jobs`)
+	return err
+}
+
+func (s *PostgresStore) ConfigGet(key string) (string, error) {
+	var v string
+	err := s.db.QueryRow(`SELECT value FROM config WHERE key = $1`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return v, err
+}
+
+func (s *PostgresStore) ConfigSet(key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO config(key, value) VALUES($1, $2)
+        ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+func (s *PostgresStore) ConfigList() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM config`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) InsertEvent(e Event) error {
+	return insertPostgresEvents(s.db, e.JobID, []Event{e})
+}
+
+// insertPostgresEvents is insertEvents with Postgres placeholders.
+func insertPostgresEvents(db queryer, jobID int64, evs []Event) error {
+	for _, e := range about(jobID, evs) {
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now()
+		}
+		_, err := db.Exec(`INSERT INTO events(job_id, from_state, to_state, actor, reason, created_at)
+            VALUES($1,$2,$3,$4,$5,$6)`, e.JobID, e.From, e.To, e.Actor, e.Reason, e.CreatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListEvents(f EventFilter) ([]Event, error) {
+	query := `SELECT id, job_id, from_state, to_state, actor, reason, created_at FROM events WHERE id > $1`
+	args := []any{f.AfterID}
+	if f.JobID != 0 {
+		args = append(args, f.JobID)
+		query += fmt.Sprintf(` AND job_id = $%d`, len(args))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since.UTC())
+		query += fmt.Sprintf(` AND created_at >= $%d`, len(args))
+	}
+	rows, err := s.db.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Event
+	for rows.Next() {
+		var e Event
+		var reason sql.NullString
+		if err := rows.Scan(&e.ID, &e.JobID, &e.From, &e.To, &e.Actor, &reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Reason, e.CreatedAt = reason.String, e.CreatedAt.UTC()
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) InsertJobLog(jobID int64, attempt, workerID int, output string) error {
+	_, err := s.db.Exec(`INSERT INTO job_logs(job_id, attempt, worker_id, output, created_at) VALUES($1,$2,$3,$4,$5)`,
+		jobID, attempt, workerID, output, time.Now().UTC())
+	return err
+}
+
+func (s *PostgresStore) ListJobLogs(jobID int64) ([]JobLog, error) {
+	rows, err := s.db.Query(`SELECT id, job_id, attempt, worker_id, output, created_at
+        FROM job_logs WHERE job_id = $1 ORDER BY id`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []JobLog
+	for rows.Next() {
+		var l JobLog
+		var workerID sql.NullInt64
+		var output sql.NullString
+		if err := rows.Scan(&l.ID, &l.JobID, &l.Attempt, &workerID, &output, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		l.WorkerID, l.Output, l.CreatedAt = int(workerID.Int64), output.String, l.CreatedAt.UTC()
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// RegisterWorker takes the next id from workers_id_seq, which no two
+// hosts ever both receive.
+func (s *PostgresStore) RegisterWorker() (int, error) {
+	var id int
+	err := s.db.QueryRow(`INSERT INTO workers(id, state, current_job_id, updated_at)
+        VALUES(nextval('workers_id_seq'), 'idle', 0, $1) RETURNING id`, time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *PostgresStore) UpdateWorkerStatus(id int, state string, jobID int64) error {
+	_, err := s.db.Exec(`INSERT INTO workers(id, state, current_job_id, updated_at) VALUES($1,$2,$3,$4)
+        ON CONFLICT (id) DO UPDATE SET
+            state = excluded.state,
+            current_job_id = excluded.current_job_id,
+            updated_at = excluded.updated_at`, id, state, jobID, time.Now().UTC())
+	return err
+}
+
+func (s *PostgresStore) ListWorkers() ([]WorkerStatus, error) {
+	rows, err := s.db.Query(`SELECT id, state, current_job_id, updated_at FROM workers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WorkerStatus
+	for rows.Next() {
+		var w WorkerStatus
+		if err := rows.Scan(&w.ID, &w.State, &w.CurrentJobID, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		w.UpdatedAt = w.UpdatedAt.UTC()
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// JobsEnqueued returns how many jobs were ever inserted, from the id
+// sequence, so it keeps growing after jobs are deleted.
+func (s *PostgresStore) JobsEnqueued() (int64, error) {
+	var n int64
+	err := s.db.QueryRow(`SELECT CASE WHEN is_called THEN last_value ELSE 0 END FROM jobs_id_seq`).Scan(&n)
+	return n, err
+}
+
+// OutcomesSince tallies completed and failed attempts per queue from the
+// events table.
+func (s *PostgresStore) OutcomesSince(since time.Time) (map[string]QueueOutcomes, error) {
+	rows, err := s.db.Query(`
+        SELECT COALESCE(j.queue, d.queue, 'default'), e.to_state, COUNT(*)
+        FROM events e
+        LEFT JOIN jobs j ON j.id = e.job_id
+        LEFT JOIN dead_jobs d ON d.orig_id = e.job_id AND j.id IS NULL AND d.replayed_as IS NULL
+        WHERE e.created_at >= $1 AND e.to_state IN ('completed', 'failed', 'dead')
+        GROUP BY 1, 2`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanOutcomes(rows)
+}
+
+func (s *PostgresStore) CountCompletedBefore(t time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM jobs WHERE state = $1 AND updated_at < $2`,
+		string(job.Completed), t.UTC()).Scan(&n)
+	return n, err
+}
+
+func (s *PostgresStore) CountDeadBefore(t time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM dead_jobs WHERE failed_at < $1`, t.UTC()).Scan(&n)
+	return n, err
+}
+
+func (s *PostgresStore) PruneCompletedBatch(t time.Time, limit int) (int, error) {
+	return s.pruneBatch(`DELETE FROM jobs WHERE id IN (
+            SELECT id FROM jobs WHERE state = $1 AND updated_at < $2 ORDER BY id LIMIT $3)
+        RETURNING id`, string(job.Completed), t.UTC(), limit)
+}
+
+func (s *PostgresStore) PruneDeadBatch(t time.Time, limit int) (int, error) {
+	return s.pruneBatch(`DELETE FROM dead_jobs WHERE id IN (
+            SELECT id FROM dead_jobs WHERE failed_at < $1 ORDER BY id LIMIT $2)
+        RETURNING orig_id`, t.UTC(), limit)
+}
+
+// pruneBatch runs del, which returns the job id each deleted row kept its
+// logs under, and drops those logs unless a live job still uses the id,
+// all in one transaction.
+func (s *PostgresStore) pruneBatch(del string, args ...any) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(del, args...)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	var jobIDs []int64
+	for rows.Next() {
+		var id sql.NullInt64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted++
+		if id.Valid {
+			jobIDs = append(jobIDs, id.Int64)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(jobIDs) > 0 {
+		if _, err := tx.Exec(`DELETE FROM job_logs WHERE job_id = ANY($1)
+            AND NOT EXISTS (SELECT 1 FROM jobs WHERE jobs.id = job_logs.job_id)`, jobIDs); err != nil {
+			return 0, err
+		}
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *PostgresStore) InsertSink(sink Sink) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO notify_sinks(kind, target, email_from, email_to, created_at)
+        VALUES($1,$2,$3,$4,$5) RETURNING id`,
+		sink.Kind, sink.Target, sink.EmailFrom, sink.EmailTo, time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *PostgresStore) ListSinks() ([]Sink, error) {
+	rows, err := s.db.Query(`SELECT id, kind, target, email_from, email_to, created_at FROM notify_sinks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Sink
+	for rows.Next() {
+		var sink Sink
+		var from, to sql.NullString
+		if err := rows.Scan(&sink.ID, &sink.Kind, &sink.Target, &from, &to, &sink.CreatedAt); err != nil {
+			return nil, err
+		}
+		sink.EmailFrom, sink.EmailTo, sink.CreatedAt = from.String, to.String, sink.CreatedAt.UTC()
+		out = append(out, sink)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSink removes a notification destination and its send history.
+func (s *PostgresStore) DeleteSink(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(`DELETE FROM notify_sinks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("sink %d not found: %w", id, sql.ErrNoRows)
+	}
+	if _, err := tx.Exec(`DELETE FROM notify_log WHERE sink_id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) RecordNotification(sinkID int64, key string, at time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO notify_log(sink_id, dedup_key, sent_at) VALUES($1,$2,$3)`,
+		sinkID, key, at.UTC())
+	return err
+}
+
+func (s *PostgresStore) NotificationSent(sinkID int64, key string, since time.Time) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM notify_log WHERE sink_id = $1 AND dedup_key = $2 AND sent_at >= $3`,
+		sinkID, key, since.UTC()).Scan(&n)
+	return n > 0, err
+}
+
+func (s *PostgresStore) CountNotifications(sinkID int64, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM notify_log WHERE sink_id = $1 AND sent_at >= $2`,
+		sinkID, since.UTC()).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,106 @@
+-- Baseline Postgres schema. Databases created before the schema was
+-- versioned already have these objects, so every statement is
+-- idempotent and adopting such a database just records version 1.
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    command TEXT NOT NULL,
+    state TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_retries INTEGER NOT NULL DEFAULT 3,
+    scheduled_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT,
+    queue TEXT NOT NULL DEFAULT 'default',
+    backoff TEXT NOT NULL DEFAULT '',
+    retry_delay_ms BIGINT NOT NULL DEFAULT 0,
+    retry_on TEXT NOT NULL DEFAULT '',
+    no_retry_on TEXT NOT NULL DEFAULT '',
+    retry_later_on TEXT NOT NULL DEFAULT '',
+    retried_from BIGINT,
+    replays INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_state_updated ON jobs(state, updated_at);
+-- ClaimJob scans due jobs in id order
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(id) WHERE state IN ('pending', 'failed');
+
+CREATE TABLE IF NOT EXISTS dead_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    orig_id BIGINT,
+    command TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    max_retries INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    failed_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT,
+    queue TEXT NOT NULL DEFAULT 'default',
+    backoff TEXT NOT NULL DEFAULT '',
+    retry_on TEXT NOT NULL DEFAULT '',
+    no_retry_on TEXT NOT NULL DEFAULT '',
+    retry_later_on TEXT NOT NULL DEFAULT '',
+    retried_from BIGINT,
+    replays INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    escalated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_jobs_failed ON dead_jobs(failed_at);
+
+CREATE TABLE IF NOT EXISTS config (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+INSERT INTO config (key, value) VALUES
+    ('max_retries', '3'),
+    ('backoff_base', '2'),
+    ('log_level', 'info'),
+    ('worker_concurrency', '1')
+ON CONFLICT (key) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS workers (
+    id INTEGER PRIMARY KEY,
+    state TEXT NOT NULL,
+    current_job_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS job_logs (
+    id BIGSERIAL PRIMARY KEY,
+    job_id BIGINT NOT NULL,
+    attempt INTEGER NOT NULL,
+    worker_id INTEGER,
+    output TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_logs_job ON job_logs(job_id);
+
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    job_id BIGINT NOT NULL,
+    from_state TEXT NOT NULL,
+    to_state TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_job ON events(job_id);
+
+-- Wake listening workers whenever a job becomes claimable or will be.
+CREATE OR REPLACE FUNCTION queuectl_notify_job() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('queuectl_jobs', NEW.id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS jobs_notify ON jobs;
+CREATE TRIGGER jobs_notify
+    AFTER INSERT OR UPDATE OF state, scheduled_at ON jobs
+    FOR EACH ROW
+    WHEN (NEW.state IN ('pending', 'failed'))
+    EXECUTE FUNCTION queuectl_notify_job();
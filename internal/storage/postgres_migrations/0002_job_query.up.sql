@@ -0,0 +1,15 @@
+-- queuectl:no-transaction
+-- Tags and the indexes behind list filters, sort orders and cursor
+-- paging. Each index ends in id so pages continue where they stopped.
+-- The indexes are built concurrently, so workers keep claiming while a
+-- large jobs table is indexed. A build that is interrupted leaves an
+-- INVALID index behind; drop it before opening the database again.
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE dead_jobs ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_state_id ON jobs(state, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_state_created ON jobs(state, created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_queue_state ON jobs(queue, state, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_created ON jobs(created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_updated ON jobs(updated_at, id);
@@ -0,0 +1,28 @@
+-- Notification sinks, the send log behind dedup and rate limits, and the
+-- notify.* defaults the SQLite baseline ships with.
+
+CREATE TABLE IF NOT EXISTS notify_sinks (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    email_from TEXT,
+    email_to TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notify_log (
+    id BIGSERIAL PRIMARY KEY,
+    sink_id BIGINT NOT NULL,
+    dedup_key TEXT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notify_log_sink ON notify_log(sink_id, sent_at);
+
+INSERT INTO config (key, value) VALUES
+    ('notify.failure_rate', '0.5'),
+    ('notify.failure_min', '10'),
+    ('notify.failure_window', '5m'),
+    ('notify.dedup_window', '15m'),
+    ('notify.rate_limit', '20/1h')
+ON CONFLICT (key) DO NOTHING;
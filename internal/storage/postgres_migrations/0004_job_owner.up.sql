@@ -0,0 +1,7 @@
+-- The worker holding each running job, and a sequence so worker ids
+-- handed out by concurrent hosts never collide.
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS worker_id INTEGER;
+
+CREATE SEQUENCE IF NOT EXISTS workers_id_seq OWNED BY workers.id;
+SELECT setval('workers_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM workers;
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// Pruner is implemented by the stores retention can prune: SQLiteStore
+// and PostgresStore.
+type Pruner interface {
+	CountCompletedBefore(t time.Time) (int, error)
+	CountDeadBefore(t time.Time) (int, error)
+	PruneCompletedBatch(t time.Time, limit int) (int, error)
+	PruneDeadBatch(t time.Time, limit int) (int, error)
+}
+
+// CountCompletedBefore counts completed jobs last updated before t.
+func CountCompletedBefore(db *sql.DB, t time.Time) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM jobs WHERE state = ? AND updated_at < ?`,
+		string(job.Completed), formatTime(t)).Scan(&n)
+	return n, err
+}
+
+// CountDeadBefore counts DLQ entries that failed before t, including the
+// replayed ones kept as history.
+func CountDeadBefore(db *sql.DB, t time.Time) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM dead_jobs WHERE failed_at < ?`, formatTime(t)).Scan(&n)
+	return n, err
+}
+
+// PruneCompletedBatch deletes up to limit completed jobs last updated
+// before t, together with their logs, and returns how many it deleted.
+// Callers loop until it returns 0 so each transaction stays short.
+func PruneCompletedBatch(db *sql.DB, t time.Time, limit int) (int, error) {
+	return pruneBatch(db,
+		`SELECT id, id FROM jobs WHERE state = ? AND updated_at < ? ORDER BY id LIMIT ?`,
+		`DELETE FROM jobs WHERE id = ?`,
+		string(job.Completed), formatTime(t), limit)
+}
+
+// PruneDeadBatch deletes up to limit DLQ entries that failed before t,
+// replayed or not, together with their logs, and returns how many it
+// deleted.
+func PruneDeadBatch(db *sql.DB, t time.Time, limit int) (int, error) {
+	return pruneBatch(db,
+		`SELECT id, orig_id FROM dead_jobs WHERE failed_at < ? ORDER BY id LIMIT ?`,
+		`DELETE FROM dead_jobs WHERE id = ?`,
+		formatTime(t), limit)
+}
+
+// victim is a row to delete plus the job id its logs are stored under.
+type victim struct {
+	id    int64
+	jobID sql.NullInt64
+}
+
+// pruneBatch deletes the rows picked by sel, which yields each row id and
+// the job id its logs are stored under, in one transaction.
+func pruneBatch(db *sql.DB, sel, del string, args ...any) (int, error) {
+	rows, err := db.Query(sel, args...)
+	if err != nil {
+		return 0, err
+	}
+	var victims []victim
+	for rows.Next() {
+		var v victim
+		if err := rows.Scan(&v.id, &v.jobID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		victims = append(victims, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return deleteVictims(db, del, victims)
+}
+
+// deleteVictims runs del for every victim and drops its logs, in one
+// transaction. Logs are kept while a live job still uses the same id,
+// e.g. after a DLQ replay. Rows that no longer match del are skipped.
+func deleteVictims(db *sql.DB, del string, victims []victim) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	deleted := 0
+	for _, v := range victims {
+		res, err := tx.Exec(del, v.id)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		deleted++
+		if !v.jobID.Valid {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM job_logs WHERE job_id = ? AND NOT EXISTS (SELECT 1 FROM jobs WHERE id = ?)`,
+			v.jobID.Int64, v.jobID.Int64); err != nil {
+			return 0, err
+		}
+	}
+	return deleted, tx.Commit()
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// JobFilter narrows FindJobs and pages through its results. Zero fields
+// match everything; Command and Error are substring matches.
+type JobFilter struct {
+	State         job.JobState
+	Queue         string
+	Command       string
+	CommandRegexp string // Go (RE2) syntax; Postgres evaluates it as a POSIX regex
+	Error         string
+	Tag           string
+	MinAttempts   int       // at least this many attempts
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+	UpdatedAfter  time.Time // inclusive
+	UpdatedBefore time.Time // exclusive
+
+	Sort  JobSort
+	Limit int    // 0 returns every match
+	After string // cursor from Sort.Cursor; results start after that job
+}
+
+// JobSort is the order FindJobs returns jobs in. Jobs with equal keys are
+// ordered by id in the same direction, which makes cursors exact.
+type JobSort struct {
+	Field string // one of JobSortFields; "" is id
+	Desc  bool
+}
+
+// JobSortFields are the fields jobs can be sorted by.
+var JobSortFields = []string{"id", "created", "updated", "scheduled", "attempts"}
+
+var sortColumns = map[string]string{
+	"id": "id", "created": "created_at", "updated": "updated_at", "scheduled": "scheduled_at", "attempts": "attempts",
+}
+
+// ParseJobSort reads a --sort value: a field, prefixed with "-" for
+// descending order, such as "-updated".
+func ParseJobSort(s string) (JobSort, error) {
+	field, desc := strings.CutPrefix(s, "-")
+	if field == "" {
+		field = "id"
+	}
+	if !slices.Contains(JobSortFields, field) {
+		return JobSort{}, fmt.Errorf("cannot sort by %q (want one of %s)", field, strings.Join(JobSortFields, ", "))
+	}
+	return JobSort{Field: field, Desc: desc}, nil
+}
+
+func (s JobSort) String() string {
+	if s.Desc {
+		return "-" + s.field()
+	}
+	return s.field()
+}
+
+// column returns the sort field's column and the SQL direction.
+func (s JobSort) column() (string, string) {
+	dir := "ASC"
+	if s.Desc {
+		dir = "DESC"
+	}
+	return sortColumns[s.field()], dir
+}
+
+func (s JobSort) field() string {
+	if s.Field == "" {
+		return "id"
+	}
+	return s.Field
+}
+
+// key is j's sort key as an integer: microseconds for times.
+func (s JobSort) key(j *job.Job) int64 {
+	switch s.field() {
+	case "created":
+		return j.CreatedAt.UnixMicro()
+	case "updated":
+		return j.UpdatedAt.UnixMicro()
+	case "scheduled":
+		return j.ScheduledAt.UnixMicro()
+	case "attempts":
+		return int64(j.Attempts)
+	}
+	return j.ID
+}
+
+// isTime reports whether the sort key is a timestamp.
+func (s JobSort) isTime() bool {
+	f := s.field()
+	return f == "created" || f == "updated" || f == "scheduled"
+}
+
+// compare orders a before b (-1), after b (1) or with it (0) by key and
+// then id, reversed for descending sorts.
+func (s JobSort) compare(aKey, aID, bKey, bID int64) int {
+	c := cmp.Or(cmp.Compare(aKey, bKey), cmp.Compare(aID, bID))
+	if s.Desc {
+		return -c
+	}
+	return c
+}
+
+// Cursor returns the token that makes FindJobs with this sort continue
+// after j. It is opaque to callers and only valid for the same sort.
+func (s JobSort) Cursor(j *job.Job) string {
+	raw := fmt.Sprintf("%s:%d:%d", s, s.key(j), j.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the sort key and id a cursor points at.
+func (s JobSort) decodeCursor(c string) (int64, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor %q", c)
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return 0, 0, fmt.Errorf("invalid cursor %q", c)
+	}
+	if parts[0] != s.String() {
+		return 0, 0, fmt.Errorf("cursor is for --sort %s, not %s", parts[0], s)
+	}
+	key, err1 := strconv.ParseInt(parts[1], 10, 64)
+	id, err2 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("invalid cursor %q", c)
+	}
+	return key, id, nil
+}
+
+// Check validates the sort, regex, tag and cursor of f, so callers can
+// report a bad flag before querying.
+func (f JobFilter) Check() error {
+	if _, err := ParseJobSort(f.Sort.String()); err != nil {
+		return err
+	}
+	if f.Tag != "" {
+		if err := job.CheckTag(f.Tag); err != nil {
+			return err
+		}
+	}
+	if f.CommandRegexp != "" {
+		if _, err := regexp.Compile(f.CommandRegexp); err != nil {
+			return fmt.Errorf("invalid command regex: %w", err)
+		}
+	}
+	if f.After != "" {
+		if _, _, err := f.Sort.decodeCursor(f.After); err != nil {
+			return err
+		}
+	}
+	if f.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+// FindJobs returns the jobs matching f in f.Sort order, at most f.Limit
+// of them.
+func FindJobs(db *sql.DB, f JobFilter) ([]job.Job, error) {
+	if err := f.Check(); err != nil {
+		return nil, err
+	}
+	query, args := findJobsQuery(f)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []job.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *j)
+	}
+	return out, rows.Err()
+}
+
+// findJobsQuery builds the SQLite query for a checked filter.
+func findJobsQuery(f JobFilter) (string, []any) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE 1=1`
+	var args []any
+	if f.State != "" {
+		query += ` AND state = ?`
+		args = append(args, string(f.State))
+	}
+	if f.Queue != "" {
+		query += ` AND queue = ?`
+		args = append(args, f.Queue)
+	}
+	if f.Command != "" {
+		query += ` AND instr(command, ?) > 0`
+		args = append(args, f.Command)
+	}
+	if f.CommandRegexp != "" {
+		query += ` AND command REGEXP ?`
+		args = append(args, f.CommandRegexp)
+	}
+	if f.Error != "" {
+		query += ` AND instr(COALESCE(last_error, ''), ?) > 0`
+		args = append(args, f.Error)
+	}
+	if f.Tag != "" {
+		query += ` AND instr(',' || tags || ',', ',' || ? || ',') > 0`
+		args = append(args, f.Tag)
+	}
+	if f.MinAttempts > 0 {
+		query += ` AND attempts >= ?`
+		args = append(args, f.MinAttempts)
+	}
+	for _, r := range []struct {
+		cond string
+		t    time.Time
+	}{
+		{` AND created_at >= ?`, f.CreatedAfter},
+		{` AND created_at < ?`, f.CreatedBefore},
+		{` AND updated_at >= ?`, f.UpdatedAfter},
+		{` AND updated_at < ?`, f.UpdatedBefore},
+	} {
+		if !r.t.IsZero() {
+			query += r.cond
+			args = append(args, formatTime(r.t))
+		}
+	}
+
+	col, dir := f.Sort.column()
+	if f.After != "" {
+		key, id, _ := f.Sort.decodeCursor(f.After)
+		op := ">"
+		if f.Sort.Desc {
+			op = "<"
+		}
+		if col == "id" {
+			query += ` AND id ` + op + ` ?`
+			args = append(args, id)
+		} else {
+			query += ` AND (` + col + `, id) ` + op + ` (?, ?)`
+			if f.Sort.isTime() {
+				args = append(args, formatTime(time.UnixMicro(key)), id)
+			} else {
+				args = append(args, key, id)
+			}
+		}
+	}
+	query += ` ORDER BY ` + col + ` ` + dir
+	if col != "id" {
+		query += `, id ` + dir
+	}
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	return query, args
+}
+
+// regexps caches the patterns the SQLite regexp function compiles, so a
+// REGEXP filter compiles its pattern once rather than once per row.
+var regexps struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}
+
+// sqliteRegexp implements SQLite's REGEXP operator: "x REGEXP y" calls
+// regexp(y, x).
+func sqliteRegexp(pattern, s string) (bool, error) {
+	regexps.Lock()
+	re, ok := regexps.m[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			regexps.Unlock()
+			return false, err
+		}
+		if regexps.m == nil || len(regexps.m) >= 64 {
+			regexps.m = map[string]*regexp.Regexp{}
+		}
+		regexps.m[pattern] = re
+	}
+	regexps.Unlock()
+	return re.MatchString(s), nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// TestFindJobsUsesIndexes checks that list's common queries read an
+// index in sort order instead of scanning and sorting every job.
+func TestFindJobsUsesIndexes(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	last := JobSort{Field: "created", Desc: true}.Cursor(&job.Job{ID: 10, CreatedAt: time.Now()})
+	for name, f := range map[string]JobFilter{
+		"state":             {State: job.Completed, Limit: 50},
+		"state next page":   {State: job.Completed, Limit: 50, After: JobSort{}.Cursor(&job.Job{ID: 10})},
+		"state by created":  {State: job.Completed, Sort: JobSort{Field: "created", Desc: true}, Limit: 50, After: last},
+		"queue and state":   {Queue: "emails", State: job.Failed, Limit: 50},
+		"updated range":     {UpdatedAfter: time.Now().Add(-time.Hour), Sort: JobSort{Field: "updated"}, Limit: 50},
+		"created, filtered": {Command: "backup", Tag: "nightly", Sort: JobSort{Field: "created"}, Limit: 50},
+	} {
+		query, args := findJobsQuery(f)
+		rows, err := db.Query(`EXPLAIN QUERY PLAN `+query, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+				t.Fatal(err)
+			}
+			plan = append(plan, detail)
+		}
+		rows.Close()
+		p := strings.Join(plan, "; ")
+		if !strings.Contains(p, "USING INDEX") && !strings.Contains(p, "USING INTEGER PRIMARY KEY") ||
+			strings.Contains(p, "TEMP B-TREE") {
+			t.Errorf("%s: plan %q", name, p)
+		}
+	}
+}
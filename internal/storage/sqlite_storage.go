@@ -4,105 +4,130 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 
 	"queuectl/internal/job"
 )
 
-const schemaSQL = `
-PRAGMA foreign_keys = ON;
-
-CREATE TABLE IF NOT EXISTS jobs (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    command TEXT NOT NULL,
-    state TEXT NOT NULL,
-    attempts INTEGER NOT NULL DEFAULT 0,
-    max_retries INTEGER NOT NULL DEFAULT 3,
-    scheduled_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    created_at DATETIME NOT NULL,
-    updated_at DATETIME NOT NULL,
-    last_error TEXT
-);
-
-CREATE TABLE IF NOT EXISTS dead_jobs (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    orig_id INTEGER,
-    command TEXT NOT NULL,
-    attempts INTEGER NOT NULL,
-    max_retries INTEGER NOT NULL,
-    created_at DATETIME NOT NULL,
-    failed_at DATETIME NOT NULL,
-    last_error TEXT
-);
-
-CREATE TABLE IF NOT EXISTS config (
-    key TEXT PRIMARY KEY,
-    value TEXT NOT NULL
-);
-
-INSERT OR IGNORE INTO config (key, value) VALUES ('max_retries', '3');
-INSERT OR IGNORE INTO config (key, value) VALUES ('backoff_base', '2');
-INSERT OR IGNORE INTO config (key, value) VALUES ('log_level', 'info');
-INSERT OR IGNORE INTO config (key, value) VALUES ('worker_concurrency', '1');
-
-CREATE TABLE IF NOT EXISTS workers (
-    id INTEGER PRIMARY KEY,
-    state TEXT NOT NULL,
-    current_job_id INTEGER,
-    updated_at DATETIME NOT NULL
-);
-
-
-`
+// jobColumns is the column list every job query selects, in scanJob order.
+const jobColumns = `id, command, state, attempts, max_retries, scheduled_at, created_at, updated_at, last_error, queue, backoff, retry_delay_ms, retry_on, no_retry_on, retry_later_on, retried_from, replays, tags, worker_id`
 
 var ErrNoJob = errors.New("no pending job")
 
-func OpenDB(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+// timeLayout is how every timestamp is stored: UTC with milliseconds and
+// a fixed width, so comparing the strings compares the times.
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// formatTime renders t in timeLayout.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// IsBusy reports whether err is SQLite giving up on a lock that another
+// connection held for longer than the busy timeout.
+func IsBusy(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && (se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked)
+}
+
+// sqliteParams configures every connection:
+//   - WAL lets CLI reads and the dashboard run while a worker writes.
+//   - synchronous=NORMAL only syncs at checkpoints, which is safe in WAL;
+//     a power cut can lose the last commits but never corrupts the file.
+const sqliteParams = "_busy_timeout=5000&_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL"
+
+// writerParams are added for the write connection: _txlock=immediate
+// starts its transactions with BEGIN IMMEDIATE, so they take the write
+// lock before reading instead of failing to upgrade. Read transactions
+// stay deferred and never wait for the write lock.
+const writerParams = "&_txlock=immediate"
+
+// sqliteDriver is go-sqlite3 with the SQL functions queuectl's queries
+// need registered on every connection.
+const sqliteDriver = "sqlite3_queuectl"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			return c.RegisterFunc("regexp", sqliteRegexp, true)
+		},
+	})
+}
+
+// Open opens the database at path without touching its schema. Most
+// callers want OpenDB.
+func Open(path string) (*sql.DB, error) {
+	return open(path + "?" + sqliteParams)
+}
+
+// OpenWriter opens the single connection writes to the database at path
+// go through, so writers in one process queue in Go instead of spinning
+// on SQLite's busy timeout. It does not touch the schema either.
+func OpenWriter(path string) (*sql.DB, error) {
+	db, err := open(path + "?" + sqliteParams + writerParams)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.Ping(); err != nil {
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
 		return nil, err
 	}
-	if _, err := db.Exec(schemaSQL); err != nil {
+	if err := db.Ping(); err != nil {
 		db.Close()
 		return nil, err
 	}
 	return db, nil
 }
 
-func InsertJob(db *sql.DB, j *job.Job) (int64, error) {
-	res, err := db.Exec(
-		`INSERT INTO jobs(command, state, attempts, max_retries, scheduled_at, created_at, updated_at, last_error)
-         VALUES(?,?,?,?,?,?,?,?)`,
-		j.Command, string(j.State), j.Attempts, j.MaxRetries,
-		j.ScheduledAt.Format(time.RFC3339),
-		j.CreatedAt.Format(time.RFC3339),
-		j.UpdatedAt.Format(time.RFC3339),
-		j.LastError,
-	)
+// OpenDB opens the database at path and applies pending migrations. It
+// fails with ErrNewerSchema when the database was migrated by a newer
+// queuectl, so old binaries never write to a layout they do not know.
+func OpenDB(path string) (*sql.DB, error) {
+	db, err := Open(path)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return res.LastInsertId()
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func GetJobByID(db *sql.DB, id int64) (*job.Job, error) {
-	row := db.QueryRow(
-		`SELECT id, command, state, attempts, max_retries, scheduled_at, created_at, updated_at, last_error
-         FROM jobs WHERE id=?`, id,
-	)
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanJob reads one row selected with jobColumns.
+func scanJob(row rowScanner) (*job.Job, error) {
 	var j job.Job
 	var state, schedStr string
 	var lastErr sql.NullString
+	var delayMS int64
+	var retryOn, noRetryOn, retryLaterOn, tags string
+	var retriedFrom, workerID sql.NullInt64
 	if err := row.Scan(&j.ID, &j.Command, &state, &j.Attempts, &j.MaxRetries,
-		&schedStr, &j.CreatedAt, &j.UpdatedAt, &lastErr); err != nil {
+		&schedStr, &j.CreatedAt, &j.UpdatedAt, &lastErr, &j.Queue, &j.Backoff, &delayMS,
+		&retryOn, &noRetryOn, &retryLaterOn, &retriedFrom, &j.Replays, &tags, &workerID); err != nil {
 		return nil, err
 	}
+	j.RetriedFrom = retriedFrom.Int64
+	j.WorkerID = int(workerID.Int64)
+	j.Tags, _ = job.ParseTags(tags)
+	j.Retry.RetryOn, _ = job.ParseExitCodes(retryOn)
+	j.Retry.NoRetryOn, _ = job.ParseExitCodes(noRetryOn)
+	j.Retry.RetryLaterOn, _ = job.ParseExitCodes(retryLaterOn)
 	j.State = job.JobState(state)
+	j.RetryDelay = time.Duration(delayMS) * time.Millisecond
 	j.ScheduledAt, _ = time.Parse(time.RFC3339, schedStr)
 	if lastErr.Valid {
 		j.LastError = lastErr.String
@@ -110,82 +135,191 @@ func GetJobByID(db *sql.DB, id int64) (*job.Job, error) {
 	return &j, nil
 }
 
-func PullPendingJob(db *sql.DB) (*job.Job, error) {
-	tx, err := db.Begin()
+func InsertJob(db queryer, j *job.Job) (int64, error) {
+	res, err := db.Exec(
+		`INSERT INTO jobs(command, state, attempts, max_retries, scheduled_at, created_at, updated_at, last_error, queue, backoff,
+            retry_on, no_retry_on, retry_later_on, tags)
+         VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		j.Command, string(j.State), j.Attempts, j.MaxRetries,
+		formatTime(j.ScheduledAt),
+		formatTime(j.CreatedAt),
+		formatTime(j.UpdatedAt),
+		j.LastError, j.Queue, j.Backoff,
+		job.FormatExitCodes(j.Retry.RetryOn), job.FormatExitCodes(j.Retry.NoRetryOn), job.FormatExitCodes(j.Retry.RetryLaterOn),
+		job.FormatTags(j.Tags),
+	)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer func() { _ = tx.Rollback() }()
+	return res.LastInsertId()
+}
 
-	now := time.Now().UTC().Format(time.RFC3339)
+func GetJobByID(db queryer, id int64) (*job.Job, error) {
+	row := db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id=?`, id)
+	return scanJob(row)
+}
 
-	row := tx.QueryRow(`SELECT id, command, state, attempts, max_retries, scheduled_at, created_at, updated_at, last_error
-		FROM jobs
-		WHERE state = ? AND scheduled_at <= ?
-		ORDER BY id
-		LIMIT 1`, string(job.Pending), now)
+// PullPendingJob claims the oldest job that is due for workerID: either
+// pending or failed with its retry delay elapsed. Reject leaves
+// retryable jobs in failed with scheduled_at pushed out by the backoff
+// delay and nothing else moves them back to pending, so without claiming
+// them here a failed job would never run again. The claim's UPDATE is
+// the first statement, so it takes the write lock before reading and
+// two processes never read the same pending row. SQLiteStore runs it in
+// one transaction with the worker's status and the claim's events.
+func PullPendingJob(db queryer, workerID int) (*job.Job, error) {
+	now := time.Now().UTC()
+	stamp := formatTime(now)
 
-	var j job.Job
-	var state, schedStr string
-	var lastErr sql.NullString
-	if err := row.Scan(&j.ID, &j.Command, &state, &j.Attempts, &j.MaxRetries,
-		&schedStr, &j.CreatedAt, &j.UpdatedAt, &lastErr); err != nil {
+	row := db.QueryRow(`UPDATE jobs SET state = ?, updated_at = ?, worker_id = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE state IN (?, ?) AND scheduled_at <= ?
+			ORDER BY id
+			LIMIT 1)
+		RETURNING `+jobColumns, string(job.Running), stamp, nullWorker(workerID), string(job.Pending), string(job.Failed), stamp)
+
+	j, err := scanJob(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNoJob
 		}
 		return nil, err
 	}
+	j.UpdatedAt = now
+	return j, nil
+}
 
-	j.State = job.JobState(state)
-	j.ScheduledAt, _ = time.Parse(time.RFC3339, schedStr)
-	if lastErr.Valid {
-		j.LastError = lastErr.String
+// PullPendingJobs claims up to n due jobs for workerID with a single
+// statement, so a batch costs one write transaction instead of n. The
+// worker's own row is left alone: it has not started any of them yet.
+func PullPendingJobs(db queryer, n, workerID int) ([]*job.Job, error) {
+	now := time.Now().UTC()
+	stamp := formatTime(now)
+
+	rows, err := db.Query(`UPDATE jobs SET state = ?, updated_at = ?, worker_id = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE state IN (?, ?) AND scheduled_at <= ?
+			ORDER BY id
+			LIMIT ?)
+		RETURNING `+jobColumns, string(job.Running), stamp, nullWorker(workerID), string(job.Pending), string(job.Failed), stamp, n)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	_, err = tx.Exec(`UPDATE jobs SET state=?, updated_at=? WHERE id=?`, string(job.Running), now, j.ID)
-	if err != nil {
+	jobs := []*job.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		j.UpdatedAt = now
+		jobs = append(jobs, j)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	// RETURNING does not promise any order
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs, nil
+}
+
+// nullWorker stores worker id 0 as NULL.
+func nullWorker(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// owner is the worker_id to store for j: only running jobs have one.
+func owner(j *job.Job) sql.NullInt64 {
+	if j.State != job.Running {
+		return sql.NullInt64{}
+	}
+	return nullWorker(j.WorkerID)
+}
 
-	if err := tx.Commit(); err != nil {
+// StaleJobs returns running jobs claimed before cutoff whose worker has
+// not been heard from since: no heartbeat, no row at all, or no owner.
+func StaleJobs(db *sql.DB, cutoff time.Time) ([]job.Job, error) {
+	rows, err := db.Query(`SELECT `+jobColumns+` FROM jobs
+        WHERE state = ? AND updated_at < ?
+            AND NOT EXISTS (SELECT 1 FROM workers w WHERE w.id = jobs.worker_id AND w.updated_at >= ?)
+        ORDER BY id`, string(job.Running), formatTime(cutoff), formatTime(cutoff))
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	j.State = job.Running
-	j.UpdatedAt = time.Now().UTC()
-	return &j, nil
+	var out []job.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *j)
+	}
+	return out, rows.Err()
 }
 
-func UpdateJob(db *sql.DB, j *job.Job) error {
-	_, err := db.Exec(`UPDATE jobs SET state=?, attempts=?, scheduled_at=?, updated_at=?, last_error=? WHERE id=?`,
+func UpdateJob(db queryer, j *job.Job) error {
+	_, err := db.Exec(`UPDATE jobs SET state=?, attempts=?, scheduled_at=?, updated_at=?, last_error=?, retry_delay_ms=?, worker_id=? WHERE id=?`,
 		string(j.State), j.Attempts,
-		j.ScheduledAt.Format(time.RFC3339),
-		j.UpdatedAt.Format(time.RFC3339),
-		j.LastError, j.ID,
+		formatTime(j.ScheduledAt),
+		formatTime(j.UpdatedAt),
+		j.LastError, j.RetryDelay.Milliseconds(), owner(j), j.ID,
 	)
 	return err
 }
 
-func DeleteJob(db *sql.DB, id int64) error {
+func DeleteJob(db queryer, id int64) error {
 	_, err := db.Exec(`DELETE FROM jobs WHERE id = ?`, id)
 	return err
 }
 
-func MoveToDead(db *sql.DB, j *job.Job) error {
-	now := time.Now().UTC()
-	_, err := db.Exec(`INSERT INTO dead_jobs(orig_id, command, attempts, max_retries, created_at, failed_at, last_error)
-        VALUES(?,?,?,?,?,?,?)`,
-		j.ID, j.Command, j.Attempts, j.MaxRetries,
-		j.CreatedAt.Format(time.RFC3339), now.Format(time.RFC3339), j.LastError,
-	)
+// MoveToDead copies j into dead_jobs, classified as reason, and removes
+// it from jobs in one transaction. It returns sql.ErrNoRows when j is no
+// longer in jobs, e.g. because another process already moved it.
+func MoveToDead(db *sql.DB, j *job.Job, reason job.DeadReason) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	return DeleteJob(db, j.ID)
+	defer func() { _ = tx.Rollback() }()
+	if err := moveToDead(tx, j, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveToDead is MoveToDead inside the caller's transaction.
+func moveToDead(tx queryer, j *job.Job, reason job.DeadReason) error {
+	// deleting first takes the write lock, so a concurrent move of the
+	// same job waits and then finds nothing to delete
+	res, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, j.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`INSERT INTO dead_jobs(orig_id, command, attempts, max_retries, created_at, failed_at, last_error, queue, backoff,
+            retry_on, no_retry_on, retry_later_on, retried_from, replays, reason, tags)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		j.ID, j.Command, j.Attempts, j.MaxRetries,
+		formatTime(j.CreatedAt), formatTime(now), j.LastError, j.Queue, j.Backoff,
+		job.FormatExitCodes(j.Retry.RetryOn), job.FormatExitCodes(j.Retry.NoRetryOn), job.FormatExitCodes(j.Retry.RetryLaterOn),
+		nullID(j.RetriedFrom), j.Replays, string(reason), job.FormatTags(j.Tags),
+	)
+	return err
 }
 
 func GetJobsByState(db *sql.DB, state job.JobState) ([]job.Job, error) {
-	rows, err := db.Query(`SELECT id, command, state, attempts, max_retries, scheduled_at, created_at, updated_at, last_error
+	rows, err := db.Query(`SELECT `+jobColumns+`
         FROM jobs WHERE state=? ORDER BY id`, string(state))
 	if err != nil {
 		return nil, err
@@ -194,40 +328,111 @@ func GetJobsByState(db *sql.DB, state job.JobState) ([]job.Job, error) {
 
 	var out []job.Job
 	for rows.Next() {
-		var j job.Job
-		var st, schedStr string
-		var lastErr sql.NullString
-
-		if err := rows.Scan(&j.ID, &j.Command, &st, &j.Attempts, &j.MaxRetries,
-			&schedStr, &j.CreatedAt, &j.UpdatedAt, &lastErr); err != nil {
+		j, err := scanJob(rows)
+		if err != nil {
 			return nil, err
 		}
+		out = append(out, *j)
+	}
+	return out, nil
+}
+
+// RecentFailures returns the most recently failed jobs that still have
+// retries left, newest first.
+func RecentFailures(db *sql.DB, limit int) ([]job.Job, error) {
+	rows, err := db.Query(`SELECT `+jobColumns+`
+        FROM jobs WHERE state=? ORDER BY updated_at DESC, id DESC LIMIT ?`, string(job.Failed), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		j.State = job.JobState(st)
-		j.ScheduledAt, _ = time.Parse(time.RFC3339, schedStr)
-		if lastErr.Valid {
-			j.LastError = lastErr.String
-		} else {
-			j.LastError = ""
+	var out []job.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
 		}
-		out = append(out, j)
+		out = append(out, *j)
 	}
 	return out, nil
 }
 
 type DeadJob struct {
-	ID         int64
-	OrigID     sql.NullInt64
-	Command    string
-	Attempts   int
-	MaxRetries int
-	CreatedAt  time.Time
-	FailedAt   time.Time
-	LastError  sql.NullString
+	ID          int64
+	OrigID      sql.NullInt64
+	Command     string
+	Attempts    int
+	MaxRetries  int
+	CreatedAt   time.Time
+	FailedAt    time.Time
+	LastError   sql.NullString
+	Queue       string
+	RetriedFrom sql.NullInt64 // previous DLQ entry of the same job, if it was requeued before
+	Replays     int
+	Reason      job.DeadReason // empty for entries from before reasons were recorded
+	Escalated   bool           // redrives used up and the failure escalated
+	Tags        []string
+	// ReplayedAs is the job the entry was requeued as. Replayed entries
+	// are kept as history for the retried_from chain but are no longer
+	// in the DLQ: only GetDeadJob and pruning see them.
+	ReplayedAs sql.NullInt64
+}
+
+const deadJobColumns = `id, orig_id, command, attempts, max_retries, created_at, failed_at, last_error, queue, retried_from, replays, reason,
+	escalated_at IS NOT NULL, tags, replayed_as`
+
+func scanDeadJob(row rowScanner) (*DeadJob, error) {
+	var d DeadJob
+	var reason, tags string
+	if err := row.Scan(&d.ID, &d.OrigID, &d.Command, &d.Attempts, &d.MaxRetries, &d.CreatedAt, &d.FailedAt, &d.LastError, &d.Queue,
+		&d.RetriedFrom, &d.Replays, &reason, &d.Escalated, &tags, &d.ReplayedAs); err != nil {
+		return nil, err
+	}
+	d.Tags, _ = job.ParseTags(tags)
+	d.Reason = job.DeadReason(reason)
+	return &d, nil
+}
+
+// DeadJobFilter narrows FindDeadJobs. Zero fields match everything;
+// Command and Error are substring matches.
+type DeadJobFilter struct {
+	Command string
+	Queue   string
+	Error   string
+	Reason  job.DeadReason
+	Since   time.Time // failed at or after
 }
 
 func ListDeadJobs(db *sql.DB) ([]DeadJob, error) {
-	rows, err := db.Query(`SELECT id, orig_id, command, attempts, max_retries, created_at, failed_at, last_error FROM dead_jobs ORDER BY id`)
+	return FindDeadJobs(db, DeadJobFilter{})
+}
+
+// FindDeadJobs returns the DLQ entries matching f, oldest first.
+func FindDeadJobs(db *sql.DB, f DeadJobFilter) ([]DeadJob, error) {
+	query := `SELECT ` + deadJobColumns + ` FROM dead_jobs WHERE replayed_as IS NULL`
+	var args []any
+	if f.Command != "" {
+		query += ` AND instr(command, ?) > 0`
+		args = append(args, f.Command)
+	}
+	if f.Queue != "" {
+		query += ` AND queue = ?`
+		args = append(args, f.Queue)
+	}
+	if f.Error != "" {
+		query += ` AND instr(COALESCE(last_error, ''), ?) > 0`
+		args = append(args, f.Error)
+	}
+	if f.Reason != "" {
+		query += ` AND reason = ?`
+		args = append(args, string(f.Reason))
+	}
+	if !f.Since.IsZero() {
+		query += ` AND failed_at >= ?`
+		args = append(args, formatTime(f.Since))
+	}
+	rows, err := db.Query(query+` ORDER BY id`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -235,45 +440,131 @@ func ListDeadJobs(db *sql.DB) ([]DeadJob, error) {
 
 	var out []DeadJob
 	for rows.Next() {
-		var d DeadJob
-		if err := rows.Scan(&d.ID, &d.OrigID, &d.Command, &d.Attempts, &d.MaxRetries, &d.CreatedAt, &d.FailedAt, &d.LastError); err != nil {
+		d, err := scanDeadJob(rows)
+		if err != nil {
 			return nil, err
 		}
-		out = append(out, d)
+		out = append(out, *d)
 	}
 	return out, nil
 }
 
+// GetDeadJob fetches a single DLQ entry by its dead_jobs id, replayed
+// or not.
+func GetDeadJob(db *sql.DB, id int64) (*DeadJob, error) {
+	return scanDeadJob(db.QueryRow(`SELECT `+deadJobColumns+` FROM dead_jobs WHERE id = ?`, id))
+}
 
-func RetryDeadJob(db *sql.DB, deadJobID int) error {
-	// Fetch dead job
-	row := db.QueryRow(`SELECT orig_id, command, max_retries FROM dead_jobs WHERE id = ?`, deadJobID)
+// GetDeadJobByOrigID fetches the DLQ entry of a job that was moved there.
+func GetDeadJobByOrigID(db *sql.DB, origID int64) (*DeadJob, error) {
+	return scanDeadJob(db.QueryRow(`SELECT `+deadJobColumns+` FROM dead_jobs
+		WHERE orig_id = ? AND replayed_as IS NULL ORDER BY id DESC LIMIT 1`, origID))
+}
+
+// DeleteDeadJob removes a DLQ entry without retrying it.
+func DeleteDeadJob(db queryer, id int64) error {
+	res, err := db.Exec(`DELETE FROM dead_jobs WHERE id = ? AND replayed_as IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("dead job id %d not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+
+// RetryDeadJob requeues a DLQ entry as a pending job and returns its id.
+// The job gets its original id back when that is still free, so its
+// logs and events stay attached, and remembers which DLQ entry it came
+// from. The entry stays behind, marked with the job it was replayed as,
+// so that link never dangles. The job starts from zero attempts unless
+// keepAttempts is set. evs are recorded as the requeued events. Run it
+// in a transaction so the insert, the mark and the events commit
+// together.
+func RetryDeadJob(tx queryer, deadJobID int, keepAttempts bool, evs ...Event) (int64, error) {
+	// Claiming the entry first takes the write lock straight away, so
+	// when two processes retry the same entry the second one waits and
+	// then finds nothing to requeue. 0 stands in for the job id until
+	// the insert below picks it.
+	row := tx.QueryRow(`UPDATE dead_jobs SET replayed_as = 0 WHERE id = ? AND replayed_as IS NULL
+		RETURNING orig_id, command, attempts, max_retries, created_at, queue, backoff, retry_on, no_retry_on, retry_later_on, replays, tags`, deadJobID)
 
 	var origID sql.NullInt64
-	var cmd string
-	var maxRetries int
+	var cmd, queue, backoff, retryOn, noRetryOn, retryLaterOn, tags string
+	var attempts, maxRetries, replays int
+	var createdAt time.Time
 
-	if err := row.Scan(&origID, &cmd, &maxRetries); err != nil {
-		return fmt.Errorf("dead job id %d not found: %w", deadJobID, err)
+	if err := row.Scan(&origID, &cmd, &attempts, &maxRetries, &createdAt, &queue, &backoff, &retryOn, &noRetryOn, &retryLaterOn, &replays, &tags); err != nil {
+		return 0, fmt.Errorf("dead job id %d not found: %w", deadJobID, err)
+	}
+	if !keepAttempts {
+		attempts = 0
 	}
 
-	// If orig_id not stored, assign new ID (auto)
-	insert := `
-	INSERT INTO jobs (command, state, attempts, max_retries, scheduled_at, created_at, updated_at)
-	VALUES (?, 'pending', 0, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`
-	_, err := db.Exec(insert, cmd, maxRetries)
-	if err != nil {
-		return fmt.Errorf("requeue failed: %w", err)
+	// Reuse the original id unless the job somehow still exists; a
+	// NULL id lets AUTOINCREMENT pick a fresh one.
+	id := origID
+	if id.Valid {
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM jobs WHERE id = ?`, id.Int64).Scan(&n); err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			id = sql.NullInt64{}
+		}
 	}
 
-	// Remove from dead queue
-	_, _ = db.Exec(`DELETE FROM dead_jobs WHERE id = ?`, deadJobID)
+	now := formatTime(time.Now())
+	res, err := tx.Exec(`
+	INSERT INTO jobs (id, command, state, attempts, max_retries, scheduled_at, created_at, updated_at, queue, backoff,
+		retry_on, no_retry_on, retry_later_on, retried_from, replays, tags)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, cmd, string(job.Pending), attempts, maxRetries, now, formatTime(createdAt), now, queue, backoff,
+		retryOn, noRetryOn, retryLaterOn, deadJobID, replays+1, tags)
+	if err != nil {
+		return 0, fmt.Errorf("requeue failed: %w", err)
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE dead_jobs SET replayed_as = ? WHERE id = ?`, newID, deadJobID); err != nil {
+		return 0, err
+	}
+	return newID, insertEvents(tx, newID, requeued(origID.Int64, newID, evs))
+}
 
+// UpdateDeadJob saves an edited command, queue and retry limit of a
+// DLQ entry so it can be fixed before being replayed.
+func UpdateDeadJob(db queryer, d *DeadJob) error {
+	res, err := db.Exec(`UPDATE dead_jobs SET command = ?, queue = ?, max_retries = ? WHERE id = ? AND replayed_as IS NULL`,
+		d.Command, d.Queue, d.MaxRetries, d.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("dead job id %d not found: %w", d.ID, sql.ErrNoRows)
+	}
 	return nil
 }
 
+// MarkEscalated flags a DLQ entry as escalated. It reports false when
+// the entry is gone or another process escalated it first.
+func MarkEscalated(db queryer, id int64) (bool, error) {
+	res, err := db.Exec(`UPDATE dead_jobs SET escalated_at = ? WHERE id = ? AND escalated_at IS NULL AND replayed_as IS NULL`,
+		formatTime(time.Now()), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
 
+// nullID stores 0 as NULL for optional id columns.
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
 
 func FlushPending(db *sql.DB) error {
 	_, err := db.Exec(`DELETE FROM jobs WHERE state = ?`, "pending")
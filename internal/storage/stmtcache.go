@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// queryer is what the hot-path job, event and worker functions need.
+// *sql.DB satisfies it; SQLiteStore passes a stmtCache instead.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// stmtCache prepares each distinct query once and reuses the statement,
+// so a claim or an event insert skips SQLite's parser on every call.
+// Queries are fixed strings, so the cache stays small.
+type stmtCache struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: map[string]*sql.Stmt{}}
+}
+
+// prepare returns the cached statement for query, preparing it on first
+// use. c.mu is not held while preparing: that waits for a connection,
+// and the transaction holding the writer's only one may need c.mu
+// before it lets go.
+func (c *stmtCache) prepare(query string) (*sql.Stmt, error) {
+	if st := c.cached(query); st != nil {
+		return st, nil
+	}
+	st, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.stmts[query]; ok {
+		// another caller prepared it meanwhile
+		st.Close()
+		return prev, nil
+	}
+	c.stmts[query] = st
+	return st, nil
+}
+
+func (c *stmtCache) Exec(query string, args ...any) (sql.Result, error) {
+	st, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return st.Exec(args...)
+}
+
+func (c *stmtCache) Query(query string, args ...any) (*sql.Rows, error) {
+	st, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return st.Query(args...)
+}
+
+// QueryRow falls back to an unprepared query when preparing fails, so
+// the error surfaces from Scan like it would without the cache.
+func (c *stmtCache) QueryRow(query string, args ...any) *sql.Row {
+	st, err := c.prepare(query)
+	if err != nil {
+		return c.db.QueryRow(query, args...)
+	}
+	return st.QueryRow(args...)
+}
+
+// Close releases every prepared statement.
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for q, st := range c.stmts {
+		st.Close()
+		delete(c.stmts, q)
+	}
+	return nil
+}
+
+// cached returns the prepared statement for query, or nil if it has not
+// been prepared yet.
+func (c *stmtCache) cached(query string) *sql.Stmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stmts[query]
+}
+
+// in returns a queryer that runs statements inside tx, which must belong
+// to the cache's database. It reuses statements the cache already holds
+// but never prepares new ones: preparing needs a connection of its own,
+// and the single writer connection is the one tx is holding.
+func (c *stmtCache) in(tx *sql.Tx) queryer { return txStmts{c, tx} }
+
+// txStmts binds a stmtCache to a transaction.
+type txStmts struct {
+	c  *stmtCache
+	tx *sql.Tx
+}
+
+func (t txStmts) Exec(query string, args ...any) (sql.Result, error) {
+	if st := t.c.cached(query); st != nil {
+		return t.tx.Stmt(st).Exec(args...)
+	}
+	return t.tx.Exec(query, args...)
+}
+
+func (t txStmts) Query(query string, args ...any) (*sql.Rows, error) {
+	if st := t.c.cached(query); st != nil {
+		return t.tx.Stmt(st).Query(args...)
+	}
+	return t.tx.Query(query, args...)
+}
+
+func (t txStmts) QueryRow(query string, args ...any) *sql.Row {
+	if st := t.c.cached(query); st != nil {
+		return t.tx.Stmt(st).QueryRow(args...)
+	}
+	return t.tx.QueryRow(query, args...)
+}
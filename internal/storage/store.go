@@ -0,0 +1,370 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"queuectl/internal/job"
+)
+
+// Store is the storage a Queue runs on: jobs, the DLQ, config, the audit
+// log, attempt logs and worker status. SQLiteStore is the default,
+// PostgresStore serves many worker hosts and MemoryStore keeps everything
+// in the process for tests. All of them must pass the storetest
+// conformance suite.
+//
+// Lookups of missing jobs and DLQ entries fail with an error wrapping
+// sql.ErrNoRows, and ClaimJob returns ErrNoJob when nothing is due.
+//
+// Methods that change state take the audit events of the change and
+// write them in the same transaction, so the events table never misses
+// or invents a transition. Events with a JobID of 0 are about the job
+// the change created, claimed or requeued.
+type Store interface {
+	InsertJob(j *job.Job, evs ...Event) (int64, error)
+	GetJob(id int64) (*job.Job, error)
+	// ClaimJob marks the oldest due job running, owned by workerID, and
+	// returns it: pending, or failed with its retry delay elapsed. The
+	// same transaction records the job as the worker's current one. Claim
+	// events without a From get the state the job was claimed from.
+	ClaimJob(workerID int, evs ...Event) (*job.Job, error)
+	// ClaimJobs claims up to n due jobs for workerID in one step, oldest
+	// first, recording evs for each. It returns an empty slice, not
+	// ErrNoJob, when nothing is due.
+	ClaimJobs(n, workerID int, evs ...Event) ([]*job.Job, error)
+	// UpdateJob saves j. Its WorkerID is kept only while it is running.
+	UpdateJob(j *job.Job, evs ...Event) error
+	// StaleJobs returns the running jobs claimed before cutoff whose
+	// worker has not heartbeat since, so they can be reclaimed.
+	StaleJobs(cutoff time.Time) ([]job.Job, error)
+	ListJobs(state job.JobState) ([]job.Job, error)
+	// FindJobs returns the jobs matching f, sorted and paged as f says.
+	FindJobs(f JobFilter) ([]job.Job, error)
+	// NextScheduledJob returns the pending job scheduled soonest.
+	NextScheduledJob() (*job.Job, error)
+	// CountJobs counts jobs in state; job.Dead counts DLQ entries.
+	CountJobs(state job.JobState) (int, error)
+	CountJobsByQueue() (map[string]map[job.JobState]int, error)
+	FlushPending() error
+	FlushAll() error
+
+	// MoveToDead atomically moves j into the DLQ. It returns
+	// sql.ErrNoRows if j is no longer a job, so only one caller wins.
+	MoveToDead(j *job.Job, reason job.DeadReason, evs ...Event) error
+	// GetDeadJob finds replayed entries too; every other DLQ method
+	// only sees entries still in the DLQ.
+	GetDeadJob(id int64) (*DeadJob, error)
+	FindDeadJobs(f DeadJobFilter) ([]DeadJob, error)
+	// RetryDeadJob requeues a DLQ entry and returns the job's id. The
+	// entry is kept, marked with that id, for the job's retried_from
+	// chain. The job restarts from zero attempts unless keepAttempts is
+	// set. evs are recorded against the requeued job and, when it could
+	// not keep its original id, against the original job as well.
+	RetryDeadJob(id int64, keepAttempts bool, evs ...Event) (int64, error)
+	UpdateDeadJob(d *DeadJob, evs ...Event) error
+	DeleteDeadJob(id int64, evs ...Event) error
+	// MarkEscalated records evs only when this call escalated the entry.
+	MarkEscalated(id int64, evs ...Event) (bool, error)
+	FlushDead() error
+
+	ConfigGet(key string) (string, error) // "" for unset keys
+	ConfigSet(key, value string) error
+	ConfigList() (map[string]string, error)
+
+	InsertEvent(e Event) error
+	ListEvents(f EventFilter) ([]Event, error)
+
+	InsertJobLog(jobID int64, attempt, workerID int, output string) error
+	ListJobLogs(jobID int64) ([]JobLog, error)
+
+	// RegisterWorker allocates a worker id no other process holds and
+	// records the worker as idle.
+	RegisterWorker() (int, error)
+	UpdateWorkerStatus(id int, state string, jobID int64) error
+	ListWorkers() ([]WorkerStatus, error)
+
+	Close() error
+}
+
+// Notifier is implemented by stores that can announce new work, so idle
+// workers wake up at once instead of on their next poll.
+type Notifier interface {
+	// Wakeups returns a channel that receives whenever a job may have
+	// become due, until ctx is done.
+	Wakeups(ctx context.Context) <-chan struct{}
+}
+
+// SQLiteStore is the Store backed by a queue database. Writes go through
+// writer, which OpenSQLiteStore limits to a single connection: writers in
+// one process then queue in Go instead of spinning on SQLite's busy
+// timeout. Hot statements on both pools are prepared once.
+type SQLiteStore struct {
+	db     *sql.DB
+	writer *sql.DB
+	reads  *stmtCache
+	writes *stmtCache
+}
+
+// NewSQLiteStore wraps a database opened with OpenDB, using it for both
+// reads and writes.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	c := newStmtCache(db)
+	return &SQLiteStore{db: db, writer: db, reads: c, writes: c}
+}
+
+// OpenSQLiteStore opens and migrates the database at path with a
+// separate single-connection pool for writes.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := OpenWriter(path)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db, writer: writer, reads: newStmtCache(db), writes: newStmtCache(writer)}, nil
+}
+
+// DB returns the underlying database for the reads Store does not
+// cover, such as inspect, the dashboard, archive exports and backups.
+func (s *SQLiteStore) DB() *sql.DB { return s.db }
+
+// Writer returns the store's write connection for the writes Store does
+// not cover, such as archive deletes and restores, so they queue behind
+// the store's own writes instead of competing with them for the lock.
+func (s *SQLiteStore) Writer() *sql.DB { return s.writer }
+
+// inTx runs fn in one transaction on the writer, with the prepared
+// statements of the write pool.
+func (s *SQLiteStore) inTx(fn func(q queryer) error) error {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(s.writes.in(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) InsertJob(j *job.Job, evs ...Event) (id int64, err error) {
+	if len(evs) == 0 {
+		return InsertJob(s.writes, j)
+	}
+	err = s.inTx(func(q queryer) error {
+		if id, err = InsertJob(q, j); err != nil {
+			return err
+		}
+		return insertEvents(q, id, evs)
+	})
+	return id, err
+}
+
+func (s *SQLiteStore) GetJob(id int64) (*job.Job, error) { return GetJobByID(s.reads, id) }
+
+func (s *SQLiteStore) UpdateJob(j *job.Job, evs ...Event) error {
+	if len(evs) == 0 {
+		return UpdateJob(s.writes, j)
+	}
+	return s.inTx(func(q queryer) error {
+		if err := UpdateJob(q, j); err != nil {
+			return err
+		}
+		return insertEvents(q, j.ID, evs)
+	})
+}
+
+func (s *SQLiteStore) ClaimJob(workerID int, evs ...Event) (j *job.Job, err error) {
+	err = s.inTx(func(q queryer) error {
+		if j, err = PullPendingJob(q, workerID); err != nil {
+			return err
+		}
+		if workerID != 0 {
+			if err := UpdateWorkerStatus(q, workerID, "running", j.ID); err != nil {
+				return err
+			}
+		}
+		return insertEvents(q, j.ID, claimed(j, evs))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (s *SQLiteStore) ClaimJobs(n, workerID int, evs ...Event) (jobs []*job.Job, err error) {
+	if len(evs) == 0 {
+		return PullPendingJobs(s.writes, n, workerID)
+	}
+	err = s.inTx(func(q queryer) error {
+		if jobs, err = PullPendingJobs(q, n, workerID); err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if err := insertEvents(q, j.ID, claimed(j, evs)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *SQLiteStore) StaleJobs(cutoff time.Time) ([]job.Job, error) { return StaleJobs(s.db, cutoff) }
+
+func (s *SQLiteStore) ListJobs(state job.JobState) ([]job.Job, error) {
+	return GetJobsByState(s.db, state)
+}
+
+func (s *SQLiteStore) FindJobs(f JobFilter) ([]job.Job, error) { return FindJobs(s.db, f) }
+
+func (s *SQLiteStore) NextScheduledJob() (*job.Job, error) { return GetNextScheduledJob(s.db) }
+
+func (s *SQLiteStore) CountJobs(state job.JobState) (int, error) {
+	return CountJobsByState(s.db, state)
+}
+
+func (s *SQLiteStore) CountJobsByQueue() (map[string]map[job.JobState]int, error) {
+	return CountJobsByQueue(s.db)
+}
+
+func (s *SQLiteStore) FlushPending() error { return FlushPending(s.writer) }
+func (s *SQLiteStore) FlushAll() error     { return FlushAll(s.writer) }
+
+func (s *SQLiteStore) MoveToDead(j *job.Job, reason job.DeadReason, evs ...Event) error {
+	return s.inTx(func(q queryer) error {
+		if err := moveToDead(q, j, reason); err != nil {
+			return err
+		}
+		return insertEvents(q, j.ID, evs)
+	})
+}
+
+func (s *SQLiteStore) GetDeadJob(id int64) (*DeadJob, error) { return GetDeadJob(s.db, id) }
+
+func (s *SQLiteStore) FindDeadJobs(f DeadJobFilter) ([]DeadJob, error) {
+	return FindDeadJobs(s.db, f)
+}
+
+func (s *SQLiteStore) RetryDeadJob(id int64, keepAttempts bool, evs ...Event) (newID int64, err error) {
+	err = s.inTx(func(q queryer) error {
+		newID, err = RetryDeadJob(q, int(id), keepAttempts, evs...)
+		return err
+	})
+	return newID, err
+}
+
+func (s *SQLiteStore) UpdateDeadJob(d *DeadJob, evs ...Event) error {
+	return s.inTx(func(q queryer) error {
+		if err := UpdateDeadJob(q, d); err != nil {
+			return err
+		}
+		return insertEvents(q, 0, evs)
+	})
+}
+
+func (s *SQLiteStore) DeleteDeadJob(id int64, evs ...Event) error {
+	return s.inTx(func(q queryer) error {
+		if err := DeleteDeadJob(q, id); err != nil {
+			return err
+		}
+		return insertEvents(q, 0, evs)
+	})
+}
+
+func (s *SQLiteStore) MarkEscalated(id int64, evs ...Event) (won bool, err error) {
+	err = s.inTx(func(q queryer) error {
+		if won, err = MarkEscalated(q, id); err != nil || !won {
+			return err
+		}
+		return insertEvents(q, 0, evs)
+	})
+	return won, err
+}
+
+func (s *SQLiteStore) FlushDead() error { return FlushDead(s.writer) }
+
+func (s *SQLiteStore) ConfigGet(key string) (string, error)   { return ConfigGet(s.reads, key) }
+func (s *SQLiteStore) ConfigSet(key, value string) error      { return ConfigSet(s.writer, key, value) }
+func (s *SQLiteStore) ConfigList() (map[string]string, error) { return ConfigList(s.db) }
+
+func (s *SQLiteStore) InsertEvent(e Event) error                 { return InsertEvent(s.writes, e) }
+func (s *SQLiteStore) ListEvents(f EventFilter) ([]Event, error) { return ListEvents(s.db, f) }
+
+func (s *SQLiteStore) InsertJobLog(jobID int64, attempt, workerID int, output string) error {
+	return InsertJobLog(s.writes, jobID, attempt, workerID, output)
+}
+
+func (s *SQLiteStore) ListJobLogs(jobID int64) ([]JobLog, error) { return ListJobLogs(s.db, jobID) }
+
+func (s *SQLiteStore) RegisterWorker() (int, error) { return RegisterWorker(s.writer) }
+
+func (s *SQLiteStore) UpdateWorkerStatus(id int, state string, jobID int64) error {
+	return UpdateWorkerStatus(s.writes, id, state, jobID)
+}
+
+func (s *SQLiteStore) ListWorkers() ([]WorkerStatus, error) { return GetAllWorkerStatus(s.db) }
+
+func (s *SQLiteStore) JobsEnqueued() (int64, error) { return JobsEnqueuedTotal(s.db) }
+
+func (s *SQLiteStore) OutcomesSince(since time.Time) (map[string]QueueOutcomes, error) {
+	return OutcomesSince(s.db, since)
+}
+
+func (s *SQLiteStore) CountCompletedBefore(t time.Time) (int, error) {
+	return CountCompletedBefore(s.db, t)
+}
+
+func (s *SQLiteStore) CountDeadBefore(t time.Time) (int, error) { return CountDeadBefore(s.db, t) }
+
+func (s *SQLiteStore) PruneCompletedBatch(t time.Time, limit int) (int, error) {
+	return PruneCompletedBatch(s.writer, t, limit)
+}
+
+func (s *SQLiteStore) PruneDeadBatch(t time.Time, limit int) (int, error) {
+	return PruneDeadBatch(s.writer, t, limit)
+}
+
+func (s *SQLiteStore) InsertSink(sink Sink) (int64, error) { return InsertSink(s.writer, sink) }
+func (s *SQLiteStore) ListSinks() ([]Sink, error)          { return ListSinks(s.db) }
+func (s *SQLiteStore) DeleteSink(id int64) error           { return DeleteSink(s.writer, id) }
+
+func (s *SQLiteStore) RecordNotification(sinkID int64, key string, at time.Time) error {
+	return RecordNotification(s.writer, sinkID, key, at)
+}
+
+func (s *SQLiteStore) NotificationSent(sinkID int64, key string, since time.Time) (bool, error) {
+	return NotificationSent(s.db, sinkID, key, since)
+}
+
+func (s *SQLiteStore) CountNotifications(sinkID int64, since time.Time) (int, error) {
+	return CountNotifications(s.db, sinkID, since)
+}
+
+// Close closes the underlying databases.
+func (s *SQLiteStore) Close() error {
+	s.reads.Close()
+	s.writes.Close()
+	if s.writer != s.db {
+		s.writer.Close()
+	}
+	return s.db.Close()
+}
+
+var (
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*PostgresStore)(nil)
+
+	_ Pruner    = (*SQLiteStore)(nil)
+	_ Pruner    = (*PostgresStore)(nil)
+	_ SinkStore = (*SQLiteStore)(nil)
+	_ SinkStore = (*PostgresStore)(nil)
+)
@@ -0,0 +1,119 @@
+package storage_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+	"queuectl/internal/storage/storetest"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.OpenSQLiteStore(filepath.Join(t.TempDir(), "queue.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewMemoryStore()
+	})
+}
+
+func TestSQLiteReadsDuringWrite(t *testing.T) {
+	s, err := storage.OpenSQLiteStore(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	w, err := s.Writer().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Rollback()
+	if _, err := w.Exec(`INSERT INTO config(key, value) VALUES('k', 'v')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// a read transaction must not queue for the write lock held above
+	start := time.Now()
+	r, err := s.DB().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Rollback()
+	var n int
+	if err := r.QueryRow(`SELECT COUNT(*) FROM config WHERE key = 'k'`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("read during a write: %d rows, %v", n, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("read transaction waited %s for the writer", d)
+	}
+}
+
+// BenchmarkSQLiteJobCycle runs the store calls of a short job (insert,
+// claim, event, complete) from parallel workers, comparing the original
+// connection settings with OpenSQLiteStore:
+//
+//	go test -bench SQLiteJobCycle -cpu 4 ./internal/storage
+func BenchmarkSQLiteJobCycle(b *testing.B) {
+	stores := []struct {
+		name string
+		open func(path string) (storage.Store, error)
+	}{
+		{"rollback-journal", func(path string) (storage.Store, error) {
+			db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_foreign_keys=on")
+			if err != nil {
+				return nil, err
+			}
+			if err := storage.Migrate(db); err != nil {
+				return nil, err
+			}
+			return storage.NewSQLiteStore(db), nil
+		}},
+		{"tuned", func(path string) (storage.Store, error) {
+			return storage.OpenSQLiteStore(path)
+		}},
+	}
+	for _, st := range stores {
+		b.Run(st.name, func(b *testing.B) {
+			s, err := st.open(filepath.Join(b.TempDir(), "queue.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer s.Close()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := s.InsertJob(job.NewJob("true", 0)); err != nil {
+						b.Error(err)
+						return
+					}
+					j, err := s.ClaimJob(0)
+					if err == storage.ErrNoJob {
+						continue
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					_ = s.InsertEvent(storage.Event{JobID: j.ID, From: "pending", To: "running", Actor: "bench"})
+					j.State = job.Completed
+					if err := s.UpdateJob(j); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,1013 @@
+// Package storetest is the conformance suite every storage.Store must
+// pass, so the queue behaves the same whichever store it runs on.
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/storage"
+)
+
+// Run runs the suite. newStore must return an empty, ready to use store
+// and is called once per subtest.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, storage.Store)
+	}{
+		{"InsertGet", testInsertGet},
+		{"Claim", testClaim},
+		{"ClaimConcurrent", testClaimConcurrent},
+		{"ClaimBatch", testClaimBatch},
+		{"SubSecond", testSubSecond},
+		{"Update", testUpdate},
+		{"ListCount", testListCount},
+		{"FindJobs", testFindJobs},
+		{"FindJobsPaging", testFindJobsPaging},
+		{"Dead", testDead},
+		{"DeadConcurrent", testDeadConcurrent},
+		{"Flush", testFlush},
+		{"Config", testConfig},
+		{"Events", testEvents},
+		{"TransitionEvents", testTransitionEvents},
+		{"Logs", testLogs},
+		{"Workers", testWorkers},
+		{"Owner", testOwner},
+		{"StaleJobs", testStaleJobs},
+		{"Enqueued", testEnqueued},
+		{"Prune", testPrune},
+		{"Sinks", testSinks},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// sameMilli compares timestamps at the precision every store keeps.
+func sameMilli(a, b time.Time) bool {
+	return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+}
+
+func insert(t *testing.T, s storage.Store, cmd string, mutate func(*job.Job)) *job.Job {
+	t.Helper()
+	j := job.NewJob(cmd, job.InheritRetries)
+	if mutate != nil {
+		mutate(j)
+	}
+	id, err := s.InsertJob(j)
+	if err != nil {
+		t.Fatalf("insert %s: %v", cmd, err)
+	}
+	j.ID = id
+	return j
+}
+
+func testInsertGet(t *testing.T, s storage.Store) {
+	j := insert(t, s, "echo a", func(j *job.Job) {
+		j.Queue = "emails"
+		j.MaxRetries = 4
+		j.Backoff = "fixed:5s"
+		j.Retry = job.RetryPolicy{NoRetryOn: []int{2}, RetryLaterOn: []int{75}}
+		j.Tags = []string{"nightly", "mail"}
+	})
+	got, err := s.GetJob(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != "echo a" || got.State != job.Pending || got.Queue != "emails" || got.MaxRetries != 4 ||
+		got.Backoff != "fixed:5s" || job.FormatExitCodes(got.Retry.NoRetryOn) != "2" || job.FormatExitCodes(got.Retry.RetryLaterOn) != "75" ||
+		job.FormatTags(got.Tags) != "nightly,mail" {
+		t.Errorf("got %+v", got)
+	}
+	if !sameMilli(got.CreatedAt, j.CreatedAt) {
+		t.Errorf("created_at %v, want %v", got.CreatedAt, j.CreatedAt)
+	}
+
+	second := insert(t, s, "echo b", nil)
+	if second.ID <= j.ID {
+		t.Errorf("ids not increasing: %d then %d", j.ID, second.ID)
+	}
+	if _, err := s.GetJob(second.ID + 100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing job: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testClaim(t *testing.T, s storage.Store) {
+	if _, err := s.ClaimJob(0); !errors.Is(err, storage.ErrNoJob) {
+		t.Fatalf("claim on empty store: %v, want ErrNoJob", err)
+	}
+	later := insert(t, s, "later", func(j *job.Job) { j.ScheduledAt = time.Now().Add(time.Hour) })
+	first := insert(t, s, "first", nil)
+	second := insert(t, s, "second", nil)
+
+	got, err := s.ClaimJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != first.ID || got.State != job.Running {
+		t.Errorf("claimed %d in %s, want %d running", got.ID, got.State, first.ID)
+	}
+	if stored, _ := s.GetJob(first.ID); stored.State != job.Running {
+		t.Errorf("stored state %s, want running", stored.State)
+	}
+
+	// a failed job whose retry delay passed is due again
+	got.State, got.Attempts = job.Failed, 1
+	got.ScheduledAt = time.Now().Add(-time.Minute)
+	if err := s.UpdateJob(got); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []int64{first.ID, second.ID} {
+		got, err := s.ClaimJob(0)
+		if err != nil || got.ID != want {
+			t.Fatalf("claimed %v, %v; want job %d", got, err, want)
+		}
+	}
+	if got, err := s.ClaimJob(0); !errors.Is(err, storage.ErrNoJob) {
+		t.Errorf("claimed %v before it was due (%d), err %v", got, later.ID, err)
+	}
+}
+
+func testClaimBatch(t *testing.T, s storage.Store) {
+	if got, err := s.ClaimJobs(5, 0); err != nil || len(got) != 0 {
+		t.Fatalf("batch on empty store: %v, %v; want none", got, err)
+	}
+	insert(t, s, "later", func(j *job.Job) { j.ScheduledAt = time.Now().Add(time.Hour) })
+	var want []int64
+	for i := 0; i < 4; i++ {
+		want = append(want, insert(t, s, "echo", nil).ID)
+	}
+
+	check := func(got []*job.Job, ids []int64) {
+		t.Helper()
+		if len(got) != len(ids) {
+			t.Fatalf("claimed %d jobs, want %d", len(got), len(ids))
+		}
+		for i, j := range got {
+			if j.ID != ids[i] || j.State != job.Running {
+				t.Errorf("job %d: got %d in %s, want %d running", i, j.ID, j.State, ids[i])
+			}
+		}
+	}
+	got, err := s.ClaimJobs(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(got, want[:3])
+	got, err = s.ClaimJobs(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(got, want[3:])
+	if n, _ := s.CountJobs(job.Running); n != 4 {
+		t.Errorf("%d running, want 4", n)
+	}
+}
+
+// testSubSecond schedules jobs less than a second apart and checks they
+// come due, and sort, at their own times.
+func testSubSecond(t *testing.T, s storage.Store) {
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Second)
+	soon := insert(t, s, "soon", func(j *job.Job) { j.ScheduledAt = time.Now().Add(300 * time.Millisecond) })
+	// inserted later but due 250ms earlier within the same second
+	a := insert(t, s, "a", func(j *job.Job) { j.ScheduledAt = base.Add(750 * time.Millisecond) })
+	b := insert(t, s, "b", func(j *job.Job) { j.ScheduledAt = base.Add(500 * time.Millisecond) })
+
+	got, err := s.GetJob(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ScheduledAt.Equal(a.ScheduledAt) {
+		t.Errorf("scheduled_at %s, want %s", got.ScheduledAt, a.ScheduledAt)
+	}
+	next, err := s.NextScheduledJob()
+	if err != nil || next.ID != b.ID {
+		t.Fatalf("next scheduled %v, %v; want job %d", next, err, b.ID)
+	}
+
+	for _, want := range []int64{a.ID, b.ID} {
+		if _, err := s.ClaimJob(0); err != nil {
+			t.Fatalf("claim job %d: %v", want, err)
+		}
+	}
+	if j, err := s.ClaimJob(0); !errors.Is(err, storage.ErrNoJob) {
+		t.Fatalf("claimed %v 300ms early, err %v", j, err)
+	}
+	time.Sleep(time.Until(soon.ScheduledAt) + 20*time.Millisecond)
+	if j, err := s.ClaimJob(0); err != nil || j.ID != soon.ID {
+		t.Fatalf("claimed %v, %v once due; want job %d", j, err, soon.ID)
+	}
+}
+
+func testClaimConcurrent(t *testing.T, s storage.Store) {
+	const jobs, workers = 30, 6
+	for i := 0; i < jobs; i++ {
+		insert(t, s, "echo", nil)
+	}
+
+	var mu sync.Mutex
+	claimed := map[int64]int{}
+	ids := map[int]bool{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := s.RegisterWorker()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			if ids[id] {
+				t.Errorf("worker id %d registered twice", id)
+			}
+			ids[id] = true
+			mu.Unlock()
+			for {
+				j, err := s.ClaimJob(id)
+				if errors.Is(err, storage.ErrNoJob) {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if j.WorkerID != id {
+					t.Errorf("job %d claimed by worker %d has owner %d", j.ID, id, j.WorkerID)
+				}
+				mu.Lock()
+				claimed[j.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != jobs {
+		t.Errorf("claimed %d distinct jobs, want %d", len(claimed), jobs)
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Errorf("job %d claimed %d times", id, n)
+		}
+	}
+}
+
+// testDeadConcurrent moves one job to the DLQ from several goroutines,
+// as a worker and the lease reaper can: exactly one move may win.
+func testDeadConcurrent(t *testing.T, s storage.Store) {
+	const movers = 6
+	j := insert(t, s, "false", nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, movers)
+	for i := 0; i < movers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cp := *j
+			errs <- s.MoveToDead(&cp, job.ReasonMaxRetries)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	moved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			moved++
+		case !errors.Is(err, sql.ErrNoRows):
+			t.Errorf("move: %v", err)
+		}
+	}
+	if moved != 1 {
+		t.Errorf("%d moves succeeded, want 1", moved)
+	}
+	if n, err := s.CountJobs(job.Dead); err != nil || n != 1 {
+		t.Errorf("%d DLQ entries, %v; want 1", n, err)
+	}
+	if _, err := s.GetJob(j.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("job still readable after the move: %v", err)
+	}
+	if err := s.MoveToDead(j, job.ReasonMaxRetries); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("moving a dead job again: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testUpdate(t *testing.T, s storage.Store) {
+	j := insert(t, s, "flaky", nil)
+	sched := time.Now().Add(30 * time.Second).UTC()
+	j.State, j.Attempts, j.LastError = job.Failed, 2, "boom"
+	j.ScheduledAt, j.RetryDelay = sched, 1500*time.Millisecond
+	if err := s.UpdateJob(j); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetJob(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != job.Failed || got.Attempts != 2 || got.LastError != "boom" || got.RetryDelay != 1500*time.Millisecond ||
+		!sameMilli(got.ScheduledAt, sched) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func testListCount(t *testing.T, s storage.Store) {
+	a := insert(t, s, "a", nil)
+	b := insert(t, s, "b", func(j *job.Job) { j.Queue = "reports" })
+	c := insert(t, s, "c", nil)
+	c.State = job.Completed
+	if err := s.UpdateJob(c); err != nil {
+		t.Fatal(err)
+	}
+	d := insert(t, s, "d", func(j *job.Job) { j.Queue = "reports" })
+	if err := s.MoveToDead(d, job.ReasonMaxRetries); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := s.ListJobs(job.Pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != a.ID || pending[1].ID != b.ID {
+		t.Errorf("pending jobs %+v, want %d and %d", pending, a.ID, b.ID)
+	}
+	for state, want := range map[job.JobState]int{job.Pending: 2, job.Completed: 1, job.Running: 0, job.Dead: 1} {
+		if n, err := s.CountJobs(state); err != nil || n != want {
+			t.Errorf("count %s = %d, %v; want %d", state, n, err, want)
+		}
+	}
+	byQueue, err := s.CountJobsByQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byQueue["default"][job.Pending] != 1 || byQueue["default"][job.Completed] != 1 ||
+		byQueue["reports"][job.Pending] != 1 || byQueue["reports"][job.Dead] != 1 {
+		t.Errorf("counts by queue %v", byQueue)
+	}
+
+	next, err := s.NextScheduledJob()
+	if err != nil || next.ID != a.ID {
+		t.Errorf("next scheduled %v, %v; want %d", next, err, a.ID)
+	}
+}
+
+func testFindJobs(t *testing.T, s storage.Store) {
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+	backup := insert(t, s, "pg_dump shop", func(j *job.Job) {
+		j.Queue, j.Tags = "db", []string{"nightly", "db"}
+		j.CreatedAt, j.UpdatedAt = at(0), at(0)
+	})
+	mail := insert(t, s, "send-mail --to ops", func(j *job.Job) {
+		j.Tags = []string{"nightly"}
+		j.CreatedAt, j.UpdatedAt = at(10), at(10)
+	})
+	flaky := insert(t, s, "curl -f example.com", func(j *job.Job) {
+		j.State, j.Attempts, j.LastError = job.Failed, 2, "exit status 22"
+		j.Tags = []string{"nightly-extra"}
+		j.CreatedAt, j.UpdatedAt = at(20), at(30)
+	})
+
+	ids := func(js []job.Job) []int64 {
+		out := []int64{}
+		for _, j := range js {
+			out = append(out, j.ID)
+		}
+		return out
+	}
+	for name, tt := range map[string]struct {
+		f    storage.JobFilter
+		want []int64
+	}{
+		"all":            {storage.JobFilter{}, []int64{backup.ID, mail.ID, flaky.ID}},
+		"state":          {storage.JobFilter{State: job.Failed}, []int64{flaky.ID}},
+		"queue":          {storage.JobFilter{Queue: "db"}, []int64{backup.ID}},
+		"command":        {storage.JobFilter{Command: "mail"}, []int64{mail.ID}},
+		"regexp":         {storage.JobFilter{CommandRegexp: "^(pg_dump|curl) "}, []int64{backup.ID, flaky.ID}},
+		"error":          {storage.JobFilter{Error: "status 22"}, []int64{flaky.ID}},
+		"tag":            {storage.JobFilter{Tag: "nightly"}, []int64{backup.ID, mail.ID}},
+		"attempts":       {storage.JobFilter{MinAttempts: 1}, []int64{flaky.ID}},
+		"created after":  {storage.JobFilter{CreatedAfter: at(10)}, []int64{mail.ID, flaky.ID}},
+		"created before": {storage.JobFilter{CreatedBefore: at(10)}, []int64{backup.ID}},
+		"updated range":  {storage.JobFilter{UpdatedAfter: at(5), UpdatedBefore: at(30)}, []int64{mail.ID}},
+		"combined":       {storage.JobFilter{Tag: "nightly", Command: "pg_"}, []int64{backup.ID}},
+		"none":           {storage.JobFilter{Queue: "missing"}, []int64{}},
+		"sort desc":      {storage.JobFilter{Sort: storage.JobSort{Desc: true}}, []int64{flaky.ID, mail.ID, backup.ID}},
+		"sort updated":   {storage.JobFilter{Sort: storage.JobSort{Field: "updated", Desc: true}}, []int64{flaky.ID, mail.ID, backup.ID}},
+		"sort attempts":  {storage.JobFilter{Sort: storage.JobSort{Field: "attempts", Desc: true}}, []int64{flaky.ID, mail.ID, backup.ID}},
+		"limit":          {storage.JobFilter{Limit: 2}, []int64{backup.ID, mail.ID}},
+	} {
+		got, err := s.FindJobs(tt.f)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if g := ids(got); !slices.Equal(g, tt.want) {
+			t.Errorf("%s: got %v, want %v", name, g, tt.want)
+		}
+	}
+
+	if _, err := s.FindJobs(storage.JobFilter{CommandRegexp: "("}); err == nil {
+		t.Error("invalid regexp accepted")
+	}
+	if _, err := s.FindJobs(storage.JobFilter{Sort: storage.JobSort{Field: "command"}}); err == nil {
+		t.Error("unknown sort field accepted")
+	}
+}
+
+// testFindJobsPaging walks every sort order a page at a time and checks
+// the pages add up to the unpaged result, with ties on the sort key.
+func testFindJobsPaging(t *testing.T, s storage.Store) {
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	for i := 0; i < 7; i++ {
+		insert(t, s, "echo page", func(j *job.Job) {
+			j.Attempts = i % 3
+			j.CreatedAt = base.Add(time.Duration(i/2) * time.Second) // pairs share a timestamp
+			j.UpdatedAt = base.Add(time.Duration(7-i) * time.Second)
+			j.ScheduledAt = j.CreatedAt
+		})
+	}
+	for _, field := range storage.JobSortFields {
+		for _, desc := range []bool{false, true} {
+			sort := storage.JobSort{Field: field, Desc: desc}
+			all, err := s.FindJobs(storage.JobFilter{Sort: sort})
+			if err != nil || len(all) != 7 {
+				t.Fatalf("%s: %d jobs, %v", sort, len(all), err)
+			}
+			var paged []job.Job
+			f := storage.JobFilter{Sort: sort, Limit: 3}
+			for pages := 0; pages < 5; pages++ {
+				page, err := s.FindJobs(f)
+				if err != nil {
+					t.Fatalf("%s: %v", sort, err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				paged = append(paged, page...)
+				f.After = sort.Cursor(&page[len(page)-1])
+			}
+			var want, got []int64
+			for i := range all {
+				want = append(want, all[i].ID)
+			}
+			for i := range paged {
+				got = append(got, paged[i].ID)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: pages %v, want %v", sort, got, want)
+			}
+		}
+	}
+
+	cursor := storage.JobSort{Field: "created"}.Cursor(&job.Job{ID: 1})
+	if _, err := s.FindJobs(storage.JobFilter{After: cursor}); err == nil {
+		t.Error("cursor for another sort accepted")
+	}
+	if _, err := s.FindJobs(storage.JobFilter{After: "not a cursor"}); err == nil {
+		t.Error("garbage cursor accepted")
+	}
+	// a comma would match across two stored tags
+	for _, tag := range []string{"a,b", "a b"} {
+		if _, err := s.FindJobs(storage.JobFilter{Tag: tag}); err == nil {
+			t.Errorf("tag %q accepted", tag)
+		}
+	}
+}
+
+func testDead(t *testing.T, s storage.Store) {
+	j := insert(t, s, "curl example.com", func(j *job.Job) {
+		j.Queue = "http"
+		j.Backoff = "fixed:1s"
+		j.Tags = []string{"probe"}
+	})
+	j.State, j.Attempts, j.LastError = job.Dead, 3, "exit status 7"
+	if err := s.MoveToDead(j, job.ReasonMaxRetries); err != nil {
+		t.Fatal(err)
+	}
+	other := insert(t, s, "false", nil)
+	if err := s.MoveToDead(other, job.ReasonPermanent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetJob(j.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("job still live after MoveToDead: %v", err)
+	}
+
+	all, err := s.FindDeadJobs(storage.DeadJobFilter{})
+	if err != nil || len(all) != 2 {
+		t.Fatalf("dead jobs %+v, %v", all, err)
+	}
+	d := all[0]
+	if d.OrigID.Int64 != j.ID || d.Command != j.Command || d.Attempts != 3 || d.Queue != "http" ||
+		d.LastError.String != "exit status 7" || d.Reason != job.ReasonMaxRetries || d.Escalated || job.FormatTags(d.Tags) != "probe" {
+		t.Errorf("dead entry %+v", d)
+	}
+	if got, err := s.GetDeadJob(d.ID); err != nil || got.OrigID != d.OrigID {
+		t.Errorf("get dead %d: %+v, %v", d.ID, got, err)
+	}
+
+	filters := map[string]storage.DeadJobFilter{
+		"command": {Command: "example"},
+		"queue":   {Queue: "http"},
+		"error":   {Error: "status 7"},
+		"reason":  {Reason: job.ReasonMaxRetries},
+	}
+	for name, f := range filters {
+		got, err := s.FindDeadJobs(f)
+		if err != nil || len(got) != 1 || got[0].ID != d.ID {
+			t.Errorf("filter by %s: %+v, %v", name, got, err)
+		}
+	}
+	if got, _ := s.FindDeadJobs(storage.DeadJobFilter{Since: time.Now().Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("filter by since matched %+v", got)
+	}
+
+	d.Command, d.MaxRetries = "curl example.org", 5
+	if err := s.UpdateDeadJob(&d); err != nil {
+		t.Fatal(err)
+	}
+	if won, err := s.MarkEscalated(d.ID); !won || err != nil {
+		t.Errorf("first escalation: %v, %v", won, err)
+	}
+	if won, _ := s.MarkEscalated(d.ID); won {
+		t.Error("escalated twice")
+	}
+
+	id, err := s.RetryDeadJob(d.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != j.ID {
+		t.Errorf("requeued as %d, want original id %d", id, j.ID)
+	}
+	got, err := s.GetJob(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != job.Pending || got.Attempts != 0 || got.Command != "curl example.org" || got.MaxRetries != 5 ||
+		got.Queue != "http" || got.Backoff != "fixed:1s" || got.RetriedFrom != d.ID || got.Replays != 1 ||
+		job.FormatTags(got.Tags) != "probe" {
+		t.Errorf("requeued job %+v", got)
+	}
+	if _, err := s.RetryDeadJob(d.ID, false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second retry: %v, want sql.ErrNoRows", err)
+	}
+	if err := s.UpdateDeadJob(&d); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("update of a retried entry: %v, want sql.ErrNoRows", err)
+	}
+	if err := s.DeleteDeadJob(d.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete of a retried entry: %v, want sql.ErrNoRows", err)
+	}
+
+	// the retried entry stays as history for the job's retried_from
+	kept, err := s.GetDeadJob(d.ID)
+	if err != nil || kept.ReplayedAs.Int64 != id || kept.Command != "curl example.org" {
+		t.Errorf("retried entry %+v, %v; want it kept and replayed as %d", kept, err, id)
+	}
+	if live, _ := s.FindDeadJobs(storage.DeadJobFilter{}); len(live) != 1 || live[0].ID == d.ID {
+		t.Errorf("retried entry still listed: %+v", live)
+	}
+	if n, _ := s.CountJobs(job.Dead); n != 1 {
+		t.Errorf("%d DLQ entries after the retry, want 1", n)
+	}
+
+	// moving it back to the DLQ keeps the replay history
+	got.Attempts = 4
+	if err := s.MoveToDead(got, job.ReasonTimeout); err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.FindDeadJobs(storage.DeadJobFilter{Reason: job.ReasonTimeout})
+	if err != nil || len(again) != 1 || again[0].Replays != 1 || again[0].RetriedFrom.Int64 != d.ID {
+		t.Fatalf("dead again: %+v, %v", again, err)
+	}
+
+	// keeping attempts carries the count over to the requeued job
+	if _, err := s.RetryDeadJob(again[0].ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.GetJob(id); err != nil || got.Attempts != 4 || got.Replays != 2 || got.RetriedFrom != again[0].ID {
+		t.Fatalf("requeued keeping attempts: %+v, %v", got, err)
+	}
+	if err := s.MoveToDead(got, job.ReasonTimeout); err != nil {
+		t.Fatal(err)
+	}
+	again, _ = s.FindDeadJobs(storage.DeadJobFilter{Reason: job.ReasonTimeout})
+	if len(again) != 1 {
+		t.Fatalf("dead jobs %+v", again)
+	}
+
+	if err := s.DeleteDeadJob(again[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteDeadJob(again[0].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second delete: %v, want sql.ErrNoRows", err)
+	}
+	if n, _ := s.CountJobs(job.Dead); n != 1 {
+		t.Errorf("%d DLQ entries left, want 1", n)
+	}
+}
+
+func testFlush(t *testing.T, s storage.Store) {
+	insert(t, s, "pending", nil)
+	insert(t, s, "claimed", nil)
+	dead := insert(t, s, "dead", nil)
+	if err := s.MoveToDead(dead, job.ReasonMaxRetries); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ClaimJob(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.FlushPending(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CountJobs(job.Pending); n != 0 {
+		t.Errorf("%d pending left after FlushPending", n)
+	}
+	if n, _ := s.CountJobs(job.Running); n != 1 {
+		t.Errorf("FlushPending removed running jobs")
+	}
+	if err := s.FlushDead(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CountJobs(job.Dead); n != 0 {
+		t.Errorf("%d dead left after FlushDead", n)
+	}
+	if err := s.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CountJobs(job.Running); n != 0 {
+		t.Errorf("%d running left after FlushAll", n)
+	}
+}
+
+func testConfig(t *testing.T, s storage.Store) {
+	if v, err := s.ConfigGet("storetest.unset"); v != "" || err != nil {
+		t.Errorf("unset key: %q, %v", v, err)
+	}
+	for _, v := range []string{"1", "2"} {
+		if err := s.ConfigSet("storetest.key", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := s.ConfigGet("storetest.key"); v != "2" || err != nil {
+		t.Errorf("get after overwrite: %q, %v", v, err)
+	}
+	all, err := s.ConfigList()
+	if err != nil || all["storetest.key"] != "2" {
+		t.Errorf("list: %v, %v", all, err)
+	}
+}
+
+func testEvents(t *testing.T, s storage.Store) {
+	for _, e := range []storage.Event{
+		{JobID: 1, To: "pending", Actor: "cli"},
+		{JobID: 2, To: "pending", Actor: "cli"},
+		{JobID: 1, From: "pending", To: "running", Actor: "worker-1", Reason: "claimed"},
+	} {
+		if err := s.InsertEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mine, err := s.ListEvents(storage.EventFilter{JobID: 1})
+	if err != nil || len(mine) != 2 || mine[1].To != "running" || mine[1].Reason != "claimed" || mine[1].CreatedAt.IsZero() {
+		t.Fatalf("events of job 1: %+v, %v", mine, err)
+	}
+	after, err := s.ListEvents(storage.EventFilter{AfterID: mine[0].ID})
+	if err != nil || len(after) != 2 || after[0].JobID != 2 {
+		t.Errorf("events after %d: %+v, %v", mine[0].ID, after, err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := s.InsertEvent(storage.Event{JobID: 1, To: "completed", Actor: "cli", CreatedAt: old}); err != nil {
+		t.Fatal(err)
+	}
+	recent, err := s.ListEvents(storage.EventFilter{JobID: 1, Since: time.Now().Add(-time.Hour)})
+	if err != nil || len(recent) != 2 {
+		t.Errorf("recent events of job 1: %+v, %v", recent, err)
+	}
+	if got, _ := s.ListEvents(storage.EventFilter{Since: old.Add(-time.Minute), AfterID: after[1].ID}); len(got) != 1 || !sameMilli(got[0].CreatedAt, old) {
+		t.Errorf("events since %v after %d: %+v", old, after[1].ID, got)
+	}
+}
+
+// testTransitionEvents checks that state changes write the events they
+// are given, filling in what the caller could not know, and write none
+// when the change does not happen.
+func testTransitionEvents(t *testing.T, s storage.Store) {
+	ev := func(jobID int64, from, to string) storage.Event {
+		return storage.Event{JobID: jobID, From: from, To: to, Actor: "storetest"}
+	}
+	id, err := s.InsertJob(job.NewJob("echo a", job.InheritRetries), ev(0, "", "pending"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := s.ClaimJob(0, ev(0, "", "running"))
+	if err != nil || j.ID != id {
+		t.Fatalf("claim: %+v, %v", j, err)
+	}
+	j.State, j.Attempts, j.LastError = job.Failed, 1, "boom"
+	if err := s.UpdateJob(j, ev(id, "running", "failed")); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := s.ClaimJobs(5, 0, ev(0, "", "running"))
+	if err != nil || len(batch) != 1 {
+		t.Fatalf("claim batch: %+v, %v", batch, err)
+	}
+	j = batch[0]
+	j.State = job.Dead
+	if err := s.MoveToDead(j, job.ReasonMaxRetries, ev(id, "running", "dead")); err != nil {
+		t.Fatal(err)
+	}
+	// a move that loses the race must not log a second transition
+	if err := s.MoveToDead(j, job.ReasonMaxRetries, ev(id, "running", "dead")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second move: %v, want sql.ErrNoRows", err)
+	}
+
+	dead, _ := s.FindDeadJobs(storage.DeadJobFilter{})
+	if len(dead) != 1 {
+		t.Fatalf("dead jobs %+v", dead)
+	}
+	if won, err := s.MarkEscalated(dead[0].ID, ev(id, "dead", "dead")); !won || err != nil {
+		t.Fatalf("escalate: %v, %v", won, err)
+	}
+	if won, _ := s.MarkEscalated(dead[0].ID, ev(id, "dead", "dead")); won {
+		t.Error("escalated twice")
+	}
+	if err := s.DeleteDeadJob(dead[0].ID+100, ev(id, "dead", "deleted")); err == nil {
+		t.Error("deleted a missing DLQ entry")
+	}
+
+	if back, err := s.RetryDeadJob(dead[0].ID, false, ev(0, "dead", "pending")); err != nil || back != id {
+		t.Fatalf("retry: %d, %v; want job %d back", back, err, id)
+	}
+
+	got, err := s.ListEvents(storage.EventFilter{JobID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-/pending", "pending/running", "running/failed", "failed/running", "running/dead", "dead/dead", "dead/pending"}
+	var trail []string
+	for _, e := range got {
+		from := e.From
+		if from == "" {
+			from = "-"
+		}
+		trail = append(trail, from+"/"+e.To)
+	}
+	if strings.Join(trail, " ") != strings.Join(want, " ") {
+		t.Errorf("events of job %d: %v, want %v", id, trail, want)
+	}
+}
+
+func testLogs(t *testing.T, s storage.Store) {
+	for i, out := range []string{"first try", "second try"} {
+		if err := s.InsertJobLog(7, i+1, 2, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.InsertJobLog(8, 1, 1, "other job"); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := s.ListJobLogs(7)
+	if err != nil || len(logs) != 2 || logs[0].Attempt != 1 || logs[1].Output != "second try" || logs[1].WorkerID != 2 {
+		t.Errorf("logs of job 7: %+v, %v", logs, err)
+	}
+}
+
+func testWorkers(t *testing.T, s storage.Store) {
+	for _, w := range []struct {
+		id    int
+		state string
+		job   int64
+	}{{2, "idle", 0}, {1, "running", 7}, {2, "running", 8}} {
+		if err := s.UpdateWorkerStatus(w.id, w.state, w.job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := s.ListWorkers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws) != 2 || ws[0].ID != 1 || ws[1].ID != 2 || ws[1].State != "running" || ws[1].CurrentJobID != 8 {
+		t.Errorf("workers %+v", ws)
+	}
+	if time.Since(ws[1].UpdatedAt) > time.Minute {
+		t.Errorf("worker updated_at %v", ws[1].UpdatedAt)
+	}
+}
+
+func testOwner(t *testing.T, s storage.Store) {
+	a := insert(t, s, "echo a", nil)
+	insert(t, s, "echo b", nil)
+	id, err := s.RegisterWorker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws, _ := s.ListWorkers(); len(ws) != 1 || ws[0].ID != id || ws[0].State != "idle" {
+		t.Fatalf("after register: %+v", ws)
+	}
+
+	j, err := s.ClaimJob(id)
+	if err != nil || j.ID != a.ID || j.WorkerID != id {
+		t.Fatalf("claim: %+v, %v", j, err)
+	}
+	// the claim also records what the worker is running
+	if ws, _ := s.ListWorkers(); len(ws) != 1 || ws[0].State != "running" || ws[0].CurrentJobID != a.ID {
+		t.Errorf("worker after claim: %+v", ws)
+	}
+	if got, _ := s.GetJob(a.ID); got.WorkerID != id {
+		t.Errorf("stored owner %d, want %d", got.WorkerID, id)
+	}
+	batch, err := s.ClaimJobs(5, id+1)
+	if err != nil || len(batch) != 1 || batch[0].WorkerID != id+1 {
+		t.Errorf("batch claim: %+v, %v", batch, err)
+	}
+
+	// leaving running drops the owner
+	j.State = job.Completed
+	if err := s.UpdateJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetJob(a.ID); got.WorkerID != 0 {
+		t.Errorf("completed job keeps owner %d", got.WorkerID)
+	}
+}
+
+func testStaleJobs(t *testing.T, s storage.Store) {
+	for i := 0; i < 3; i++ {
+		insert(t, s, "echo", nil)
+	}
+	quiet, _ := s.RegisterWorker()
+	alive, _ := s.RegisterWorker()
+	a, err := s.ClaimJob(quiet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ClaimJob(alive); err != nil {
+		t.Fatal(err)
+	}
+	// claimed for a worker that never registered, e.g. it crashed first
+	orphans, err := s.ClaimJobs(1, alive+100)
+	if err != nil || len(orphans) != 1 {
+		t.Fatalf("claim orphan: %v, %v", orphans, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	if err := s.UpdateWorkerStatus(alive, "running", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := s.StaleJobs(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 2 || stale[0].ID != a.ID || stale[1].ID != orphans[0].ID {
+		t.Errorf("stale jobs %+v, want %d and %d", stale, a.ID, orphans[0].ID)
+	}
+	// jobs claimed after the cutoff are never stale
+	if stale, _ := s.StaleJobs(cutoff.Add(-time.Hour)); len(stale) != 0 {
+		t.Errorf("stale before claims: %+v", stale)
+	}
+}
+
+// The remaining cases cover optional interfaces and skip stores without
+// them.
+
+func testEnqueued(t *testing.T, s storage.Store) {
+	c, ok := s.(interface{ JobsEnqueued() (int64, error) })
+	if !ok {
+		t.Skip("store does not count enqueued jobs")
+	}
+	for i := 0; i < 3; i++ {
+		insert(t, s, "true", nil)
+	}
+	if err := s.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.JobsEnqueued(); err != nil || n != 3 {
+		t.Errorf("enqueued after flush = %d, %v; want 3", n, err)
+	}
+}
+
+func testPrune(t *testing.T, s storage.Store) {
+	p, ok := s.(storage.Pruner)
+	if !ok {
+		t.Skip("store does not prune")
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	cutoff := time.Now().Add(-24 * time.Hour)
+	var completed []*job.Job
+	for i := 0; i < 3; i++ {
+		completed = append(completed, insert(t, s, "true", func(j *job.Job) { j.State, j.UpdatedAt = job.Completed, old }))
+	}
+	recent := insert(t, s, "true", func(j *job.Job) { j.State = job.Completed })
+	pending := insert(t, s, "true", func(j *job.Job) { j.UpdatedAt = old })
+	for _, j := range append(completed, recent, pending) {
+		if err := s.InsertJobLog(j.ID, 1, 1, "output"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := p.CountCompletedBefore(cutoff); err != nil || n != 3 {
+		t.Fatalf("count completed = %d, %v; want 3", n, err)
+	}
+	if n, err := p.PruneCompletedBatch(cutoff, 2); err != nil || n != 2 {
+		t.Fatalf("first batch = %d, %v; want 2", n, err)
+	}
+	if n, err := p.PruneCompletedBatch(cutoff, 2); err != nil || n != 1 {
+		t.Fatalf("second batch = %d, %v; want 1", n, err)
+	}
+	for _, j := range []*job.Job{recent, pending} {
+		if _, err := s.GetJob(j.ID); err != nil {
+			t.Errorf("job %d was pruned: %v", j.ID, err)
+		}
+		if logs, _ := s.ListJobLogs(j.ID); len(logs) != 1 {
+			t.Errorf("job %d lost its logs", j.ID)
+		}
+	}
+	if logs, _ := s.ListJobLogs(completed[0].ID); len(logs) != 0 {
+		t.Errorf("pruned job %d still has %d logs", completed[0].ID, len(logs))
+	}
+
+	// DLQ entries have just failed, so prune with a cutoff ahead of now
+	if err := s.MoveToDead(pending, job.ReasonMaxRetries); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if n, err := p.CountDeadBefore(later); err != nil || n != 1 {
+		t.Fatalf("count dead = %d, %v; want 1", n, err)
+	}
+	if n, err := p.PruneDeadBatch(cutoff, 10); err != nil || n != 0 {
+		t.Errorf("pruned %d fresh DLQ entries, %v", n, err)
+	}
+	if n, err := p.PruneDeadBatch(later, 10); err != nil || n != 1 {
+		t.Fatalf("prune dead = %d, %v; want 1", n, err)
+	}
+	if logs, _ := s.ListJobLogs(pending.ID); len(logs) != 0 {
+		t.Errorf("pruned DLQ entry still has %d logs", len(logs))
+	}
+}
+
+func testSinks(t *testing.T, s storage.Store) {
+	ss, ok := s.(storage.SinkStore)
+	if !ok {
+		t.Skip("store has no notification sinks")
+	}
+	hook, err := ss.InsertSink(storage.Sink{Kind: "webhook", Target: "http://example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail, err := ss.InsertSink(storage.Sink{Kind: "smtp", Target: "mail:25", EmailFrom: "q@example.com", EmailTo: "ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinks, err := ss.ListSinks()
+	if err != nil || len(sinks) != 2 || sinks[0].ID != hook || sinks[1].EmailTo != "ops@example.com" || sinks[1].CreatedAt.IsZero() {
+		t.Fatalf("sinks %+v, %v", sinks, err)
+	}
+
+	now := time.Now()
+	if err := ss.RecordNotification(hook, "dead:a", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.RecordNotification(hook, "dead:b", now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := ss.NotificationSent(hook, "dead:a", now.Add(-time.Minute)); err != nil || !sent {
+		t.Errorf("dead:a sent = %v, %v; want true", sent, err)
+	}
+	if sent, err := ss.NotificationSent(hook, "dead:b", now.Add(-time.Minute)); err != nil || sent {
+		t.Errorf("dead:b sent in the last minute = %v, %v; want false", sent, err)
+	}
+	if sent, _ := ss.NotificationSent(mail, "dead:a", now.Add(-time.Minute)); sent {
+		t.Error("dead:a counted as sent to the other sink")
+	}
+	if n, err := ss.CountNotifications(hook, now.Add(-2*time.Hour)); err != nil || n != 2 {
+		t.Errorf("count = %d, %v; want 2", n, err)
+	}
+
+	if err := ss.DeleteSink(hook); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ss.CountNotifications(hook, now.Add(-2*time.Hour)); n != 0 {
+		t.Errorf("deleted sink keeps %d log rows", n)
+	}
+	if err := ss.DeleteSink(hook); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete missing sink: %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package wakeup tells idle workers about new jobs so they do not have
+// to poll the database for them. Waiters in the same process are woken
+// through a channel; other processes on the same database each listen
+// on a Unix datagram socket in a directory next to it.
+package wakeup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// sendTimeout bounds how long Notify waits on a listener whose queue is
+// full; that listener already has a wakeup pending.
+const sendTimeout = 50 * time.Millisecond
+
+// maxSocketPath is the shortest sun_path limit among supported systems.
+const maxSocketPath = 104
+
+var socketSeq atomic.Int64
+
+// Signal wakes the workers of one database.
+type Signal struct {
+	dir string // "" when there is no directory to share, e.g. Postgres
+
+	mu   sync.Mutex
+	ch   chan struct{}
+	conn *net.UnixConn
+	path string
+}
+
+// New returns the signal for the SQLite database at dbPath. Its sockets
+// live in dbPath+".wake". An empty dbPath gives a signal that only
+// reaches this process.
+func New(dbPath string) *Signal {
+	s := &Signal{ch: make(chan struct{})}
+	if dbPath != "" {
+		if abs, err := filepath.Abs(dbPath); err == nil {
+			s.dir = abs + ".wake"
+		}
+	}
+	return s
+}
+
+// C returns a channel that is closed on the next wakeup. Take a fresh
+// one before every wait.
+func (s *Signal) C() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ch
+}
+
+// Wake wakes every waiter in this process.
+func (s *Signal) Wake() {
+	s.mu.Lock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// Notify wakes every waiter in this process and every process listening
+// on the same database. Listeners that went away without cleaning up
+// are removed. Failures are only logged: workers fall back to polling.
+func (s *Signal) Notify() {
+	s.Wake()
+	if s.dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("list wakeup sockets", "dir", s.dir, "err", err)
+		}
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(s.dir, e.Name())
+		if !strings.HasSuffix(path, ".sock") || path == s.ownPath() {
+			continue
+		}
+		if err := send(path); err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+				_ = os.Remove(path) // its process exited without Close
+				continue
+			}
+			slog.Debug("send wakeup", "socket", path, "err", err)
+		}
+	}
+}
+
+func send(path string) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	_, err = conn.Write([]byte{1})
+	return err
+}
+
+func (s *Signal) ownPath() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.path
+}
+
+// Listen makes Notify calls from other processes wake this one's
+// waiters until Close.
+func (s *Signal) Listen() error {
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%d-%d.sock", os.Getpid(), socketSeq.Add(1)))
+	if len(path) >= maxSocketPath {
+		return fmt.Errorf("wakeup socket path %s is too long", path)
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.conn, s.path = conn, path
+	s.mu.Unlock()
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, _, err := conn.ReadFromUnix(buf); err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Warn("wakeup socket", "err", err)
+				}
+				return
+			}
+			s.Wake()
+		}
+	}()
+	return nil
+}
+
+// Close stops listening and removes this process's socket.
+func (s *Signal) Close() error {
+	s.mu.Lock()
+	conn, path := s.conn, s.path
+	s.conn, s.path = nil, ""
+	s.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	err := conn.Close()
+	if rmErr := os.Remove(path); err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package wakeup
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// shortDir returns a temp dir whose socket paths fit in sun_path.
+func shortDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "qw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func woken(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestWakeInProcess(t *testing.T) {
+	s := New("")
+	a, b := s.C(), s.C()
+	s.Notify()
+	if !woken(a) || !woken(b) {
+		t.Fatal("waiters were not woken")
+	}
+	select {
+	case <-s.C():
+		t.Fatal("a fresh channel fired before the next wakeup")
+	default:
+	}
+}
+
+func TestNotifyOtherListeners(t *testing.T) {
+	db := filepath.Join(shortDir(t), "q.db")
+	listener, sender := New(db), New(db)
+	if err := listener.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ch := listener.C()
+	start := time.Now()
+	sender.Notify()
+	if !woken(ch) {
+		t.Fatal("listener was not woken")
+	}
+	t.Logf("cross-process wakeup after %v", time.Since(start))
+}
+
+func TestNotifyRemovesStaleSockets(t *testing.T) {
+	db := filepath.Join(shortDir(t), "q.db")
+	dir := db + ".wake"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// a listener that died without Close leaves its socket file behind
+	stale := filepath.Join(dir, "1-1.sock")
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrUnix{Name: stale}); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+
+	New(db).Notify()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale socket still there: %v", err)
+	}
+}
+
+func TestCloseRemovesSocket(t *testing.T) {
+	db := filepath.Join(shortDir(t), "q.db")
+	s := New(db)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	path := s.ownPath()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket still there after Close: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Package web serves the read-mostly dashboard embedded in `queuectl serve`.
+package web
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+// States is the column order used for per-state counts.
+var States = []job.JobState{job.Pending, job.Running, job.Failed, job.Completed, job.Dead}
+
+var funcs = template.FuncMap{
+	"fmtTime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+var pages = map[string]*template.Template{}
+
+func init() {
+	for _, name := range []string{"index.html", "dlq.html", "job.html"} {
+		pages[name] = template.Must(template.New("layout.html").Funcs(funcs).
+			ParseFS(templateFS, "templates/layout.html", "templates/"+name))
+	}
+}
+
+type queueCounts struct {
+	Name   string
+	Counts map[job.JobState]int
+}
+
+type overviewPage struct {
+	States   []job.JobState
+	Totals   map[job.JobState]int
+	Queues   []queueCounts
+	Next     *job.Job
+	Workers  []storage.WorkerStatus
+	Failures []job.Job
+	Config   [][2]string
+}
+
+type dlqPage struct {
+	Dead []storage.DeadJob
+}
+
+type jobPage struct {
+	Job         *job.Job
+	Dead        *storage.DeadJob
+	Logs        []storage.JobLog
+	MaxRetries  int
+	RetriesFrom string
+}
+
+type handler struct {
+	db *sql.DB
+	q  *queue.Queue
+}
+
+// Handler returns the dashboard routes. The DLQ buttons change state, so
+// their POSTs are refused when a browser sends them from another site,
+// which could otherwise replay the user's basic-auth credentials.
+func Handler(db *sql.DB, q *queue.Queue) http.Handler {
+	h := &handler{db: db, q: q}
+	mux := http.NewServeMux()
+	mux.Handle("GET /static/", http.FileServerFS(staticFS))
+	mux.HandleFunc("GET /{$}", h.overview)
+	mux.HandleFunc("GET /dlq", h.dlq)
+	mux.HandleFunc("POST /dlq/{id}/retry", h.dlqRetry)
+	mux.HandleFunc("POST /dlq/{id}/delete", h.dlqDelete)
+	mux.HandleFunc("GET /jobs/{id}", h.jobDetail)
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+func (h *handler) overview(w http.ResponseWriter, r *http.Request) {
+	byQueue, err := storage.CountJobsByQueue(h.db)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	p := overviewPage{States: States, Totals: map[job.JobState]int{}}
+	for name, counts := range byQueue {
+		p.Queues = append(p.Queues, queueCounts{Name: name, Counts: counts})
+		for s, n := range counts {
+			p.Totals[s] += n
+		}
+	}
+	sort.Slice(p.Queues, func(i, j int) bool { return p.Queues[i].Name < p.Queues[j].Name })
+
+	p.Next, err = storage.GetNextScheduledJob(h.db)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		serverError(w, err)
+		return
+	}
+	if p.Workers, err = storage.GetAllWorkerStatus(h.db); err != nil {
+		serverError(w, err)
+		return
+	}
+	if p.Failures, err = storage.RecentFailures(h.db, 20); err != nil {
+		serverError(w, err)
+		return
+	}
+	cfg, err := storage.ConfigList(h.db)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	for k, v := range cfg {
+		p.Config = append(p.Config, [2]string{k, v})
+	}
+	sort.Slice(p.Config, func(i, j int) bool { return p.Config[i][0] < p.Config[j][0] })
+
+	render(w, "index.html", p)
+}
+
+func (h *handler) dlq(w http.ResponseWriter, r *http.Request) {
+	dead, err := storage.ListDeadJobs(h.db)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	render(w, "dlq.html", dlqPage{Dead: dead})
+}
+
+func (h *handler) dlqRetry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid dead job id", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.as(r).RetryDead(id, false); err != nil {
+		serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/dlq", http.StatusSeeOther)
+}
+
+func (h *handler) dlqDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid dead job id", http.StatusBadRequest)
+		return
+	}
+	if err := h.as(r).DeleteDead(id); err != nil {
+		serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/dlq", http.StatusSeeOther)
+}
+
+func (h *handler) jobDetail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	var p jobPage
+	p.Job, err = storage.GetJobByID(h.db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// jobs that exhausted their retries only live in the DLQ
+		p.Dead, err = storage.GetDeadJobByOrigID(h.db, id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	effective := p.Job
+	if effective == nil {
+		effective = &job.Job{MaxRetries: p.Dead.MaxRetries, Queue: p.Dead.Queue}
+	}
+	p.MaxRetries, p.RetriesFrom = h.q.EffectiveMaxRetries(effective)
+
+	if p.Logs, err = storage.ListJobLogs(h.db, id); err != nil {
+		serverError(w, err)
+		return
+	}
+	render(w, "job.html", p)
+}
+
+// as attributes DLQ actions to the dashboard user in the events table.
+func (h *handler) as(r *http.Request) *queue.Queue {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return h.q.WithActor("web:" + user)
+	}
+	return h.q.WithActor("web")
+}
+
+func render(w http.ResponseWriter, page string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pages[page].Execute(w, data); err != nil {
+		slog.Error("render page", "page", page, "err", err)
+	}
+}
+
+func serverError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,169 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+// newTestDashboard serves the dashboard for a fresh database holding one
+// pending job and one DLQ entry, whose id it returns.
+func newTestDashboard(t *testing.T) (*storage.SQLiteStore, *httptest.Server, int64) {
+	t.Helper()
+	store, err := storage.OpenSQLiteStore(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	q := queue.NewQueue(store)
+
+	if _, err := q.Push("echo waiting", 3); err != nil {
+		t.Fatal(err)
+	}
+	j, err := q.Push("backup.sh", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.State = job.Running
+	if err := q.Reject(j, "disk full"); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := store.FindDeadJobs(storage.DeadJobFilter{})
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("dead jobs %+v, %v", dead, err)
+	}
+
+	hs := httptest.NewServer(Handler(store.DB(), q))
+	t.Cleanup(hs.Close)
+	return store, hs, dead[0].ID
+}
+
+// get fetches path and returns the page, failing unless it is a 200.
+func get(t *testing.T, hs *httptest.Server, path string) string {
+	t.Helper()
+	resp, err := hs.Client().Get(hs.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s\n%s", path, resp.Status, body)
+	}
+	return string(body)
+}
+
+// post submits a DLQ form the way a browser on the dashboard would,
+// without following the redirect.
+func post(t *testing.T, hs *httptest.Server, path, fetchSite string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, hs.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Sec-Fetch-Site", fetchSite)
+	req.SetBasicAuth("alice", "")
+	client := *hs.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestOverview(t *testing.T) {
+	_, hs, _ := newTestDashboard(t)
+
+	page := get(t, hs, "/")
+	for _, want := range []string{"<td>default</td>", `<td class="num">1</td>`, "Next scheduled job:", "No workers have reported yet."} {
+		if !strings.Contains(page, want) {
+			t.Errorf("overview lacks %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestDLQList(t *testing.T) {
+	_, hs, id := newTestDashboard(t)
+
+	page := get(t, hs, "/dlq")
+	for _, want := range []string{"<code>backup.sh</code>", "disk full", `action="/dlq/` + itoa(id) + `/retry"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("DLQ page lacks %q:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "echo waiting") {
+		t.Error("DLQ page lists a pending job")
+	}
+}
+
+func TestDLQRetry(t *testing.T) {
+	store, hs, id := newTestDashboard(t)
+
+	resp := post(t, hs, "/dlq/"+itoa(id)+"/retry", "same-origin")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/dlq" {
+		t.Fatalf("retry: %s to %q, want a redirect to /dlq", resp.Status, resp.Header.Get("Location"))
+	}
+	d, err := store.GetDeadJob(id)
+	if err != nil || !d.ReplayedAs.Valid {
+		t.Fatalf("DLQ entry %d after retry: %+v, %v", id, d, err)
+	}
+	j, err := store.GetJob(d.ReplayedAs.Int64)
+	if err != nil || j.State != job.Pending {
+		t.Fatalf("retried job: %+v, %v", j, err)
+	}
+	evs, err := store.ListEvents(storage.EventFilter{JobID: j.ID})
+	if err != nil || len(evs) == 0 || evs[len(evs)-1].Actor != "web:alice" {
+		t.Errorf("retry events %+v, %v; want the last by web:alice", evs, err)
+	}
+	if page := get(t, hs, "/dlq"); !strings.Contains(page, "No dead jobs.") {
+		t.Errorf("retried entry still listed:\n%s", page)
+	}
+
+	if resp := post(t, hs, "/dlq/"+itoa(id)+"/retry", "same-origin"); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("second retry: %s", resp.Status)
+	}
+	if resp := post(t, hs, "/dlq/abc/retry", "same-origin"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("retry of a bad id: %s", resp.Status)
+	}
+}
+
+func TestDLQDelete(t *testing.T) {
+	store, hs, id := newTestDashboard(t)
+
+	resp := post(t, hs, "/dlq/"+itoa(id)+"/delete", "same-origin")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("delete: %s", resp.Status)
+	}
+	if n, err := store.CountJobs(job.Dead); err != nil || n != 0 {
+		t.Errorf("%d DLQ entries after delete, %v", n, err)
+	}
+	if resp := post(t, hs, "/dlq/abc/delete", "same-origin"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("delete of a bad id: %s", resp.Status)
+	}
+}
+
+func TestDLQRefusesCrossSite(t *testing.T) {
+	store, hs, id := newTestDashboard(t)
+
+	for _, action := range []string{"retry", "delete"} {
+		resp := post(t, hs, "/dlq/"+itoa(id)+"/"+action, "cross-site")
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("cross-site %s: %s, want 403", action, resp.Status)
+		}
+	}
+	if d, err := store.GetDeadJob(id); err != nil || d.ReplayedAs.Valid {
+		t.Errorf("DLQ entry %d after refused requests: %+v, %v", id, d, err)
+	}
+}
+
+func itoa(id int64) string { return strconv.FormatInt(id, 10) }
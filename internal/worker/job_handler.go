@@ -1,21 +1,36 @@
 package worker
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"os/signal"
-	"queuectl/internal/queue"
+	"sync"
 	"syscall"
 	"time"
+
+	"queuectl/internal/metrics"
 )
 
 
 
 const stopFile = ".queuectl_workers.stop"
 
+// HeartbeatInterval is how often a busy worker refreshes its status row so
+// the server does not treat its lease as expired.
+const HeartbeatInterval = 10 * time.Second
+
+// Idle workers poll again after minIdlePoll, doubling the wait up to
+// maxIdlePoll while the queue stays empty. Wakeups cover new jobs;
+// polling still finds retries whose delay has passed.
+const (
+	minIdlePoll = 50 * time.Millisecond
+	maxIdlePoll = 2 * time.Second
+)
+
 // check if stop file exists
 func shouldStop() bool {
 	_, err := os.Stat(stopFile)
@@ -35,78 +50,216 @@ func ClearStopSignal() {
 
 
 
-func Start(db *sql.DB, q *queue.Queue, concurrency int) {
-    fmt.Println("Starting worker.........Press Ctrl + C to stop")
+// stopFilePoll is how often Start checks for the `worker stop` file when
+// no wakeup arrives, e.g. because the wakeup socket could not be bound.
+const stopFilePoll = 250 * time.Millisecond
+
+// Start runs workers until Ctrl+C, SIGTERM or `queuectl worker stop`.
+// It is Run plus the process concerns: the stop file, signals and exiting
+// on a registration error. `worker stop` also sends a wakeup, so the stop
+// file is checked at once instead of at the next poll.
+func Start(src Source, concurrency int) {
+    slog.Info("starting workers, press Ctrl+C to stop", "concurrency", concurrency)
     ClearStopSignal()
 
-    stop := make(chan os.Signal, 1)
-    signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+    wakeups := func() <-chan struct{} { return nil }
+    if w, ok := src.(Waker); ok {
+        wakeups = w.Wakeups
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    interrupt := make(chan os.Signal, 1)
+    signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+    go func() {
+        t := time.NewTicker(stopFilePoll)
+        defer t.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-interrupt:
+                // a second Ctrl+C kills the process
+                signal.Stop(interrupt)
+                slog.Info("shutting down all workers, waiting for running jobs")
+                _ = SignalStop()
+                cancel()
+                return
+            case <-wakeups():
+            case <-t.C:
+            }
+            if shouldStop() {
+                slog.Info("stop file found, shutting down all workers")
+                cancel()
+                return
+            }
+        }
+    }()
+
+    if err := Run(ctx, src, concurrency); err != nil {
+        slog.Error("register worker", "err", err)
+        os.Exit(1)
+    }
+}
 
+// Run runs concurrency workers against src until ctx is done, then hands
+// back prefetched jobs and waits for running jobs to finish. It is the
+// loop behind Start without the stop file or signal handling, so callers
+// such as bench can run workers in-process and stop them with ctx
+// without touching the stop file other workers in the directory watch.
+func Run(ctx context.Context, src Source, concurrency int) error {
+    wakeups := func() <-chan struct{} { return nil }
+    if w, ok := src.(Waker); ok {
+        wakeups = w.Wakeups
+    }
+
+    var wg sync.WaitGroup
     for i := 0; i < concurrency; i++ {
-        workerID := i + 1
-        _ = UpdateWorkerStatus(db, workerID, "idle", 0)
+        workerID, err := src.Register()
+        if err != nil {
+            return err
+        }
+        _ = src.Heartbeat(workerID, "idle", 0)
+        metrics.Workers.Add(1, "idle")
 
+        wg.Add(1)
         go func(id int) {
+            defer wg.Done()
+            defer metrics.Workers.Add(-1, "idle")
+            lastBeat := time.Now()
+            idlePoll := minIdlePoll
             for {
-                if shouldStop() {
-                    fmt.Printf("Worker %d stopping...\n", id)
-                    _ = UpdateWorkerStatus(db, id, "stopped", 0)
+                if ctx.Err() != nil {
+                    slog.Info("worker stopping", "worker_id", id)
+                    _ = src.Heartbeat(id, "stopped", 0)
                     return
                 }
 
-                select {
-                case <-stop:
-                    fmt.Printf("Worker %d received interrupt\n", id)
-                    _ = UpdateWorkerStatus(db, id, "stopped", 0)
-                    return
-                default:
-                    job, err := q.Pull()
-                    if err != nil {
-                        time.Sleep(500 * time.Millisecond)
-                        continue
+                // take the channel before pulling so a job enqueued
+                // in between still wakes us
+                wake := wakeups()
+                job, err := src.Pull(id)
+                if err != nil {
+                    slog.Warn("pull job", "worker_id", id, "err", err)
+                    sleep(ctx, 500*time.Millisecond)
+                    continue
+                }
+                if job == nil {
+                    // idle workers heartbeat too, so a fresh row
+                    // means the process is alive
+                    if time.Since(lastBeat) >= HeartbeatInterval {
+                        _ = src.Heartbeat(id, "idle", 0)
+                        lastBeat = time.Now()
                     }
-                    if job == nil {
-                        time.Sleep(300 * time.Millisecond)
-                        continue
+                    select {
+                    case <-ctx.Done():
+                    case <-wake:
+                        idlePoll = minIdlePoll
+                    case <-time.After(idlePoll):
+                        idlePoll = min(2*idlePoll, maxIdlePoll)
                     }
+                    continue
+                }
+                idlePoll = minIdlePoll
 
-                    _ = UpdateWorkerStatus(db, id, "running", job.ID)
+                _ = src.Heartbeat(id, "running", job.ID)
+                metrics.Workers.Add(-1, "idle")
+                metrics.Workers.Add(1, "busy")
+                done := make(chan struct{})
+                go heartbeat(src, id, job.ID, done)
 
-                    err = runJob(job.Command)
-                    if err != nil {
-                        log.Printf("job %d failed: %v", job.ID, err)
-                        _ = q.Reject(job, err.Error())
-                    } else {
-                        log.Printf("job %d completed", job.ID)
-                        _ = q.Ack(job)
-                    }
+                started := time.Now()
+                metrics.ClaimLatency.Observe(started.Sub(job.ScheduledAt).Seconds(), job.Queue)
+                res := runJob(job.Command)
+                duration := time.Since(started)
+                metrics.JobDuration.Observe(duration.Seconds(), job.Queue)
+                close(done)
 
-                    _ = UpdateWorkerStatus(db, id, "idle", 0)
+                logger := slog.With("job_id", job.ID, "worker_id", id, "queue", job.Queue,
+                    "attempt", job.Attempts+1, "duration", duration)
+                logger.Debug("job output", "output", res.Output)
+                if err := src.Log(job, id, res.Output); err != nil {
+                    logger.Warn("store job log", "err", err)
                 }
+                if res.Err != nil {
+                    logger.Warn("job failed", "exit_code", res.ExitCode, "err", res.Err)
+                    if err := src.Reject(id, job, res.ExitCode, res.Err.Error()); err != nil {
+                        logger.Error("reject job", "err", err)
+                    }
+                } else {
+                    logger.Info("job completed")
+                    if err := src.Ack(id, job); err != nil {
+                        logger.Error("ack job", "err", err)
+                    }
+                }
+
+                _ = src.Heartbeat(id, "idle", 0)
+                lastBeat = time.Now()
+                metrics.Workers.Add(-1, "busy")
+                metrics.Workers.Add(1, "idle")
             }
         }(workerID)
     }
 
-    <-stop
-    fmt.Println("Shutting down all workers")
-    _ = SignalStop()
-    time.Sleep(1 * time.Second)
+    <-ctx.Done()
+    // nobody will start the prefetched jobs; Pull returns nothing after this
+    if r, ok := src.(Releaser); ok {
+        if err := r.Release(); err != nil {
+            slog.Error("release prefetched jobs", "err", err)
+        }
+    }
+    wg.Wait()
+    return nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+    select {
+    case <-ctx.Done():
+    case <-time.After(d):
+    }
+}
+
+// heartbeat keeps a running worker's status fresh until done is closed.
+func heartbeat(src Source, workerID int, jobID int64, done <-chan struct{}) {
+    t := time.NewTicker(HeartbeatInterval)
+    defer t.Stop()
+    for {
+        select {
+        case <-done:
+            return
+        case <-t.C:
+            _ = src.Heartbeat(workerID, "running", jobID)
+        }
+    }
 }
 
 
 
 
-func runJob (cmd string) error{
+// Result is the outcome of running a job's command.
+type Result struct {
+    ExitCode int // -1 when the command could not be started or was killed
+    Output   string
+    Err      error // nil on success
+}
+
+func runJob (cmd string) Result{
 
     c := exec.Command("sh", "-c", cmd)
 
     output, err := c.CombinedOutput()
 
     if err != nil {
-        return fmt.Errorf("error: %v | output: %s", err, output)
+        code := -1
+        var exitErr *exec.ExitError
+        if errors.As(err, &exitErr) {
+            code = exitErr.ExitCode()
+        }
+        return Result{ExitCode: code, Output: string(output), Err: fmt.Errorf("error: %v | output: %s", err, output)}
     }
 
-    fmt.Printf("job output: %s\n", output)
-    return nil
+    return Result{Output: string(output)}
 
-}
\ No newline at end of file
+}
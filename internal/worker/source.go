@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+	"queuectl/internal/wakeup"
+)
+
+// Source is where workers lease jobs from and report results to.
+// Local workers talk to the store directly; remote agents go through the
+// HTTP API exposed by `queuectl serve`.
+type Source interface {
+	Register() (int, error)
+	Pull(workerID int) (*job.Job, error)
+	Ack(workerID int, j *job.Job) error
+	Reject(workerID int, j *job.Job, exitCode int, lastError string) error
+	Log(j *job.Job, workerID int, output string) error
+	Heartbeat(workerID int, state string, jobID int64) error
+}
+
+// Waker is implemented by sources that can tell idle workers about new
+// jobs. Wakeups returns a channel that fires on the next one, so workers
+// ask for a fresh channel before every wait. Workers still poll, so a
+// missed wakeup only costs latency.
+type Waker interface {
+	Wakeups() <-chan struct{}
+}
+
+// Releaser is implemented by sources that hold jobs no worker has
+// started yet. Start calls Release on shutdown to hand them back.
+type Releaser interface {
+	Release() error
+}
+
+// LocalSource is a Source backed by the shared queue store.
+type LocalSource struct {
+	store storage.Store
+	q     *queue.Queue
+
+	sig *wakeup.Signal
+
+	// prefetch buffer, see SetPrefetch
+	fetchMu  sync.Mutex
+	prefetch int
+	buffered []*job.Job
+	released bool
+}
+
+// NewLocalSource creates a Source for workers running next to the store.
+// Idle workers wake on sig, which may be nil, and on the store's own
+// notifications when it sends any.
+func NewLocalSource(store storage.Store, q *queue.Queue, sig *wakeup.Signal) *LocalSource {
+	if n, ok := store.(storage.Notifier); ok {
+		if sig == nil {
+			sig = wakeup.New("")
+		}
+		go func() {
+			for range n.Wakeups(context.Background()) {
+				sig.Wake()
+			}
+		}()
+	}
+	return &LocalSource{store: store, q: q, sig: sig}
+}
+
+// Register allocates a worker id from the store, so workers on other
+// hosts sharing it never get the same one.
+func (s *LocalSource) Register() (int, error) {
+	return s.store.RegisterWorker()
+}
+
+// SetPrefetch makes Pull claim up to n jobs at once and hand the rest to
+// the next callers, so a batch costs one claim. n <= 1 claims one job
+// per Pull.
+func (s *LocalSource) SetPrefetch(n int) {
+	s.prefetch = n
+}
+
+func (s *LocalSource) Pull(workerID int) (*job.Job, error) {
+	if s.prefetch <= 1 {
+		return s.as(workerID).Pull(workerID)
+	}
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	if s.released {
+		return nil, nil
+	}
+	if len(s.buffered) == 0 {
+		jobs, err := s.as(workerID).PullN(s.prefetch, workerID)
+		if err != nil {
+			return nil, err
+		}
+		s.buffered = jobs
+	}
+	if len(s.buffered) == 0 {
+		return nil, nil
+	}
+	j := s.buffered[0]
+	s.buffered = s.buffered[1:]
+	return j, nil
+}
+
+// Release hands prefetched jobs back to the queue. Pull returns nothing
+// afterwards.
+func (s *LocalSource) Release() error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	s.released = true
+	jobs := s.buffered
+	s.buffered = nil
+	return s.q.Release(jobs)
+}
+
+func (s *LocalSource) Ack(workerID int, j *job.Job) error {
+	return s.as(workerID).Ack(j)
+}
+
+func (s *LocalSource) Reject(workerID int, j *job.Job, exitCode int, lastError string) error {
+	return s.as(workerID).Fail(j, exitCode, lastError)
+}
+
+// as attributes queue operations to the given worker in the events table.
+func (s *LocalSource) as(workerID int) *queue.Queue {
+	return s.q.WithActor(fmt.Sprintf("worker-%d", workerID))
+}
+
+func (s *LocalSource) Log(j *job.Job, workerID int, output string) error {
+	return s.store.InsertJobLog(j.ID, j.Attempts+1, workerID, output)
+}
+
+func (s *LocalSource) Heartbeat(workerID int, state string, jobID int64) error {
+	return s.store.UpdateWorkerStatus(workerID, state, jobID)
+}
+
+// Wakeups fires on the next wakeup signal; without one it returns a nil
+// channel, which never fires.
+func (s *LocalSource) Wakeups() <-chan struct{} {
+	if s.sig == nil {
+		return nil
+	}
+	return s.sig.C()
+}
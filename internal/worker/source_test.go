@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"queuectl/internal/job"
+	"queuectl/internal/queue"
+	"queuectl/internal/storage"
+)
+
+func newPrefetchSource(t *testing.T, cmds ...string) (*LocalSource, *queue.Queue, storage.Store) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	q := queue.NewQueue(store)
+	for _, cmd := range cmds {
+		if _, err := q.Push(cmd, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := NewLocalSource(store, q, nil)
+	src.SetPrefetch(len(cmds))
+	return src, q, store
+}
+
+// TestReleaseOnStop stops a worker while its prefetch buffer is full: the
+// running job finishes and the buffered ones go back to pending.
+func TestReleaseOnStop(t *testing.T) {
+	src, _, store := newPrefetchSource(t, "sleep 0.2", "true", "true", "true")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Run(ctx, src, 1) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ws, _ := store.ListWorkers()
+		if len(ws) == 1 && ws[0].State == "running" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("worker never started a job")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := store.CountJobs(job.Completed); n != 1 {
+		t.Errorf("completed %d jobs, want the one that was running", n)
+	}
+	pending, _ := store.ListJobs(job.Pending)
+	if len(pending) != 3 {
+		t.Fatalf("%d jobs back in pending, want 3", len(pending))
+	}
+	for _, j := range pending {
+		if j.Attempts != 0 || j.WorkerID != 0 {
+			t.Errorf("released job %d: attempts %d, owner %d", j.ID, j.Attempts, j.WorkerID)
+		}
+	}
+	if j, _ := src.Pull(1); j != nil {
+		t.Errorf("Pull after Release returned job %d", j.ID)
+	}
+}
+
+// TestPrefetchCrash leaves a full buffer behind as a crash would: the
+// jobs are owned by the worker that claimed them, so Reclaim finds them
+// once that worker stops heartbeating.
+func TestPrefetchCrash(t *testing.T) {
+	src, q, store := newPrefetchSource(t, "true", "true", "true")
+	id, err := src.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := src.Pull(id)
+	if err != nil || first == nil {
+		t.Fatalf("pull: %v, %v", first, err)
+	}
+	running, _ := store.ListJobs(job.Running)
+	if len(running) != 3 {
+		t.Fatalf("%d jobs claimed, want 3", len(running))
+	}
+	for _, j := range running {
+		if j.WorkerID != id {
+			t.Errorf("job %d owned by %d, want %d", j.ID, j.WorkerID, id)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if n, err := q.Reclaim(20 * time.Millisecond); err != nil || n != 3 {
+		t.Errorf("reclaimed %d, %v; want 3", n, err)
+	}
+	if n, _ := store.CountJobs(job.Running); n != 0 {
+		t.Errorf("%d jobs still running", n)
+	}
+}
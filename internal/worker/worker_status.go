@@ -3,45 +3,27 @@ package worker
 import (
     "database/sql"
     "time"
+
+    "queuectl/internal/storage"
 )
 
-// WorkerStatus represents current state of a worker
-type WorkerStatus struct {
-    ID           int
-    State        string
-    CurrentJobID int64
-    UpdatedAt    time.Time
-}
+// StaleAfter is how long a worker row may go without a heartbeat before
+// the worker is considered gone.
+const StaleAfter = 3 * HeartbeatInterval
 
-// UpdateWorkerStatus persists the worker status in DB
-func UpdateWorkerStatus(db *sql.DB, id int, state string, jobID int64) error {
-    now := time.Now().UTC()
-    _, err := db.Exec(`
-        INSERT INTO workers(id, state, current_job_id, updated_at)
-        VALUES(?, ?, ?, ?)
-        ON CONFLICT(id) DO UPDATE SET
-            state=excluded.state,
-            current_job_id=excluded.current_job_id,
-            updated_at=excluded.updated_at
-    `, id, state, jobID, now)
-    return err
-}
-
-// GetAllWorkerStatus fetches all workers from DB
-func GetAllWorkerStatus(db *sql.DB) ([]WorkerStatus, error) {
-    rows, err := db.Query(`SELECT id, state, current_job_id, updated_at FROM workers ORDER BY id`)
+// AliveWorkers returns the workers that are neither stopped nor lost and
+// heartbeated within StaleAfter.
+func AliveWorkers(db *sql.DB) ([]storage.WorkerStatus, error) {
+    all, err := storage.GetAllWorkerStatus(db)
     if err != nil {
         return nil, err
     }
-    defer rows.Close()
-
-    var out []WorkerStatus
-    for rows.Next() {
-        var w WorkerStatus
-        if err := rows.Scan(&w.ID, &w.State, &w.CurrentJobID, &w.UpdatedAt); err != nil {
-            return nil, err
+    cutoff := time.Now().Add(-StaleAfter)
+    var out []storage.WorkerStatus
+    for _, w := range all {
+        if w.State != "stopped" && w.State != "lost" && w.UpdatedAt.After(cutoff) {
+            out = append(out, w)
         }
-        out = append(out, w)
     }
     return out, nil
 }